@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strconv"
+)
+
+// ParseAVIFile decodes the XSUB (DivX) streams (DXSB or DXSA) of an AVI file, the streams are identified
+// by their index. Only the header and the chunks of the subtitles streams are read.
+func ParseAVIFile(filePath string) (streams map[int]SubtitleStream, err error) {
+	fd, err := os.Open(filePath)
+	if err != nil {
+		err = fmt.Errorf("failed to open file: %w", err)
+		return
+	}
+	defer fd.Close()
+	var (
+		compressions []string // strf biCompression of each stream, for video and subtitles streams
+		screenSize   image.Point
+	)
+	streams = make(map[int]SubtitleStream)
+	err = walkRIFF(fd, func(list, id string, read func() ([]byte, error)) (err error) {
+		var data []byte
+		switch {
+		case list == "hdrl" && id == "avih":
+			if data, err = read(); err != nil || len(data) < 40 {
+				return
+			}
+			screenSize = image.Pt(int(binary.LittleEndian.Uint32(data[32:36])), int(binary.LittleEndian.Uint32(data[36:40])))
+		case list == "strl" && id == "strh":
+			compressions = append(compressions, "")
+		case list == "strl" && id == "strf" && len(compressions) > 0:
+			// BITMAPINFOHEADER for video and subtitles streams
+			if data, err = read(); err != nil || len(data) < 20 {
+				return
+			}
+			compressions[len(compressions)-1] = string(data[16:20])
+		case (list == "movi" || list == "rec ") && len(id) == 4:
+			// data chunks: stream index (2 digits) then the data type (eg. "02sb")
+			index, parseErr := strconv.Atoi(id[0:2])
+			if parseErr != nil || index >= len(compressions) {
+				return
+			}
+			compression := compressions[index]
+			if compression != "DXSB" && compression != "DXSA" {
+				return
+			}
+			if data, err = read(); err != nil {
+				return
+			}
+			sub, decodeErr := decodeXSUB(data, compression == "DXSA")
+			if decodeErr != nil {
+				// Some bad packets can be found in the wild, other tools skip them too
+				fmt.Printf("WARNING: stream %d: skipping invalid XSUB packet: %s\n", index, decodeErr)
+				return
+			}
+			sub.ScreenSize = screenSize
+			stream := streams[index]
+			stream.ID = index
+			stream.Subtitles = append(stream.Subtitles, sub)
+			streams[index] = stream
+		}
+		return
+	})
+	if err == nil && len(streams) == 0 {
+		err = errors.New("no XSUB stream found")
+	}
+	return
+}
+
+// walkRIFF calls fn for each chunk of a RIFF file, with the type of the list holding it. The chunk data
+// is only read when fn calls read. RIFF and LIST chunks are walked recursively.
+func walkRIFF(reader io.ReadSeeker, fn func(list, id string, read func() ([]byte, error)) error) (err error) {
+	header := make([]byte, 12)
+	if _, err = io.ReadFull(reader, header); err != nil {
+		return fmt.Errorf("failed to read RIFF header: %w", err)
+	}
+	if string(header[0:4]) != "RIFF" {
+		return errors.New("invalid RIFF header")
+	}
+	// Files bigger than 1GB (OpenDML) have several RIFF chunks: read them all
+	end, err := reader.Seek(0, io.SeekEnd)
+	if err != nil {
+		return
+	}
+	if _, err = reader.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	return walkRIFFList(reader, "", end, fn)
+}
+
+func walkRIFFList(reader io.ReadSeeker, list string, end int64, fn func(list, id string, read func() ([]byte, error)) error) (err error) {
+	header := make([]byte, 8)
+	for {
+		var position int64
+		if position, err = reader.Seek(0, io.SeekCurrent); err != nil {
+			return
+		}
+		if position+8 > end {
+			return nil
+		}
+		if _, err = io.ReadFull(reader, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				// truncated file
+				err = nil
+			}
+			return
+		}
+		id := string(header[0:4])
+		size := int64(binary.LittleEndian.Uint32(header[4:8]))
+		// chunks are word aligned
+		next := position + 8 + size + size%2
+		if id == "RIFF" || id == "LIST" {
+			listType := make([]byte, 4)
+			if _, err = io.ReadFull(reader, listType); err != nil {
+				return nil
+			}
+			if err = walkRIFFList(reader, string(listType), min(end, position+8+size), fn); err != nil {
+				return
+			}
+		} else {
+			read := func() (data []byte, err error) {
+				data = make([]byte, size)
+				if _, err = io.ReadFull(reader, data); err != nil {
+					err = fmt.Errorf("failed to read chunk %q: %w", id, err)
+				}
+				return
+			}
+			if err = fn(list, id, read); err != nil {
+				return
+			}
+		}
+		if _, err = reader.Seek(next, io.SeekStart); err != nil {
+			return
+		}
+	}
+}
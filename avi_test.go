@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// aviTestChunk returns a RIFF chunk, padded to be word aligned
+func aviTestChunk(id string, data []byte) []byte {
+	chunk := binary.LittleEndian.AppendUint32([]byte(id), uint32(len(data)))
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// aviTestList returns a RIFF or LIST chunk holding the chunks
+func aviTestList(id, listType string, chunks ...[]byte) []byte {
+	return aviTestChunk(id, append([]byte(listType), bytes.Join(chunks, nil)...))
+}
+
+func TestWalkRIFF(t *testing.T) {
+	file := aviTestList("RIFF", "AVI ",
+		aviTestList("LIST", "hdrl", aviTestChunk("avih", []byte{1, 2, 3})),
+		aviTestList("LIST", "movi", aviTestChunk("00dc", []byte{4}), aviTestChunk("01sb", []byte{5, 6})),
+	)
+	// OpenDML: a second RIFF chunk, then a truncated chunk header
+	file = append(file, aviTestList("RIFF", "AVIX", aviTestList("LIST", "movi", aviTestChunk("01sb", []byte{7})))...)
+	file = append(file, "JUNK"...)
+	var chunks []string
+	var data [][]byte
+	err := walkRIFF(bytes.NewReader(file), func(list, id string, read func() ([]byte, error)) (err error) {
+		chunks = append(chunks, list+"/"+id)
+		if id == "01sb" {
+			var chunk []byte
+			if chunk, err = read(); err != nil {
+				return
+			}
+			data = append(data, chunk)
+		}
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"hdrl/avih", "movi/00dc", "movi/01sb", "movi/01sb"}; !reflect.DeepEqual(chunks, expected) {
+		t.Errorf("got chunks %v, expected %v", chunks, expected)
+	}
+	if expected := [][]byte{{5, 6}, {7}}; !reflect.DeepEqual(data, expected) {
+		t.Errorf("got data %v, expected %v", data, expected)
+	}
+	if err = walkRIFF(bytes.NewReader([]byte("RIFX\x04\x00\x00\x00AVI ")), nil); err == nil {
+		t.Error("an invalid header must fail")
+	}
+}
+
+func TestParseAVIFile(t *testing.T) {
+	avih := make([]byte, 56)
+	binary.LittleEndian.PutUint32(avih[32:], 720)
+	binary.LittleEndian.PutUint32(avih[36:], 576)
+	strf := func(compression string) []byte {
+		data := make([]byte, 40)
+		copy(data[16:], compression)
+		return data
+	}
+	file := aviTestList("RIFF", "AVI ",
+		aviTestList("LIST", "hdrl",
+			aviTestChunk("avih", avih),
+			aviTestList("LIST", "strl", aviTestChunk("strh", make([]byte, 56)), aviTestChunk("strf", strf("XVID"))),
+			aviTestList("LIST", "strl", aviTestChunk("strh", make([]byte, 56)), aviTestChunk("strf", strf("DXSB"))),
+		),
+		aviTestList("LIST", "movi",
+			aviTestChunk("00dc", []byte{1, 2, 3}),
+			aviTestChunk("01sb", xsubTestPacket("[00:00:01.000-00:00:02.000]", false)),
+			// invalid packets are skipped
+			aviTestChunk("01sb", []byte("[00:00:02.000-00:00:03.000]")),
+			aviTestList("LIST", "rec ", aviTestChunk("01sb", xsubTestPacket("[00:00:04.000-00:00:05.000]", false))),
+		),
+	)
+	filePath := filepath.Join(t.TempDir(), "video.avi")
+	if err := os.WriteFile(filePath, file, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	streams, err := ParseAVIFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, found := streams[1]
+	if len(streams) != 1 || !found || stream.ID != 1 || len(stream.Subtitles) != 2 {
+		t.Fatalf("got streams %+v", streams)
+	}
+	for index, start := range []time.Duration{time.Second, 4 * time.Second} {
+		if sub := stream.Subtitles[index]; sub.StartTime != start || sub.ScreenSize != image.Pt(720, 576) {
+			t.Errorf("subtitle #%d: got start %v and screen size %v", index, sub.StartTime, sub.ScreenSize)
+		}
+	}
+	// without subtitles stream
+	if err = os.WriteFile(filePath, aviTestList("RIFF", "AVI ", aviTestList("LIST", "hdrl", aviTestChunk("avih", avih))), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ParseAVIFile(filePath); err == nil {
+		t.Error("a file without XSUB stream must fail")
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	m2tsPacketSize      = 192 // BDAV packets: 4 bytes timecode + transport stream packet
+	bdStreamTypePGS     = 0x90
+	bdTimeClock         = 45000 // playlists and clips information times ticks per second
+	bdPlayItemMinLength = 32
+)
+
+// bdPlayItem is a part of a playlist: a clip played from its IN time to its OUT time
+type bdPlayItem struct {
+	Clip          string // clip name, eg. "00001" for STREAM/00001.m2ts
+	In, Out       time.Duration
+	PGSLanguages  map[uint16]string // PGS streams of the clip declared by the play item, by PID
+	PGSStreamPIDs []uint16          // PGS streams PIDs in the playlist order
+}
+
+// bdPlaylist is a movie playlist (.mpls)
+type bdPlaylist struct {
+	Name  string
+	Items []bdPlayItem
+}
+
+// Duration returns the total duration of the play items
+func (playlist bdPlaylist) Duration() (duration time.Duration) {
+	for _, item := range playlist.Items {
+		duration += item.Out - item.In
+	}
+	return
+}
+
+// ParseBDMVFolder decodes the PGS streams of the main title of a Blu-ray folder (the BDMV folder or its
+// parent). The main title is the longest playlist, its clips are demuxed in order and the subtitles are
+// timed from the start of the playlist. Streams are identified by their PID. Multi-angle and seamless
+// branching playlists are not supported: only the first angle is read and the branches are not followed.
+func ParseBDMVFolder(folderPath string, debug bool) (streams map[int]SubtitleStream, err error) {
+	bdmvPath := folderPath
+	if _, err = os.Stat(filepath.Join(bdmvPath, "PLAYLIST")); err != nil {
+		bdmvPath = filepath.Join(folderPath, "BDMV")
+	}
+	playlist, err := bdMainPlaylist(filepath.Join(bdmvPath, "PLAYLIST"))
+	if err != nil {
+		err = fmt.Errorf("failed to find the main title: %w", err)
+		return
+	}
+	fmt.Printf("Main title: playlist %s (%v, %d clip(s))\n", playlist.Name, playlist.Duration().Round(time.Second), len(playlist.Items))
+	streams = make(map[int]SubtitleStream)
+	var offset time.Duration
+	for _, item := range playlist.Items {
+		pids := make(map[uint16]bool, len(item.PGSStreamPIDs))
+		for _, pid := range item.PGSStreamPIDs {
+			pids[pid] = true
+		}
+		var clipSubs map[uint16][]ImageSubtitle
+		if clipSubs, _, err = demuxPGSStreams(filepath.Join(bdmvPath, "STREAM", item.Clip+".m2ts"), pids, debug); err != nil {
+			err = fmt.Errorf("clip %s: %w", item.Clip, err)
+			return
+		}
+		for _, pid := range item.PGSStreamPIDs {
+			stream, found := streams[int(pid)]
+			if !found {
+				stream = SubtitleStream{ID: int(pid), Language: item.PGSLanguages[pid]}
+			}
+			stream.Subtitles = append(stream.Subtitles, bdPlayItemSubtitles(clipSubs[pid], item, offset)...)
+			streams[int(pid)] = stream
+		}
+		offset += item.Out - item.In
+	}
+	return
+}
+
+// bdPlayItemSubtitles converts the clip times of the subtitles to playlist times, the item being played from
+// offset in the playlist. Only the part of the clip played by the item is kept.
+func bdPlayItemSubtitles(clipSubs []ImageSubtitle, item bdPlayItem, offset time.Duration) (subs []ImageSubtitle) {
+	for _, sub := range clipSubs {
+		if sub.EndTime <= item.In || sub.StartTime >= item.Out {
+			continue
+		}
+		sub.StartTime = offset + max(sub.StartTime, item.In) - item.In
+		sub.EndTime = offset + min(sub.EndTime, item.Out) - item.In
+		subs = append(subs, sub)
+	}
+	return
+}
+
+// ParseM2TSFile decodes the PGS streams of a Blu-ray transport stream, timed from the start of the
+// transport stream. Languages are read from the clip information file when it is found next to the
+// STREAM folder. Streams are identified by their PID.
+func ParseM2TSFile(filePath string, debug bool) (streams map[int]SubtitleStream, err error) {
+	clipSubs, start, err := demuxPGSStreams(filePath, nil, debug)
+	if err != nil {
+		return
+	}
+	clipName := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	languages, err := readCLPILanguages(filepath.Join(filepath.Dir(filePath), "..", "CLIPINF", clipName+".clpi"))
+	if err != nil {
+		// standalone transport stream
+		languages, err = nil, nil
+	}
+	streams = make(map[int]SubtitleStream, len(clipSubs))
+	for pid, subs := range clipSubs {
+		for index := range subs {
+			subs[index].StartTime -= start
+			subs[index].EndTime -= start
+		}
+		streams[int(pid)] = SubtitleStream{
+			ID:        int(pid),
+			Language:  languages[pid],
+			Subtitles: subs,
+		}
+	}
+	return
+}
+
+// demuxPGSStreams decodes the PGS streams of a BDAV transport stream (all of them if pids is nil), the
+// subtitles are timed with their PTS. start is the first PTS of the transport stream.
+func demuxPGSStreams(filePath string, pids map[uint16]bool, debug bool) (subs map[uint16][]ImageSubtitle, start time.Duration, err error) {
+	fd, err := os.Open(filePath)
+	if err != nil {
+		err = fmt.Errorf("failed to open file: %w", err)
+		return
+	}
+	defer fd.Close()
+	trackers := make(map[uint16]*screenTracker)
+	decoders := make(map[uint16]*pgsDecoder)
+	startPTS, err := demuxTS(fd, m2tsPacketSize,
+		func(stream tsElementaryStream) bool {
+			return stream.StreamType == bdStreamTypePGS && (pids == nil || pids[stream.PID])
+		},
+		func(stream tsElementaryStream, pts uint64, payload []byte) (err error) {
+			decoder, found := decoders[stream.PID]
+			if !found {
+				tracker := &screenTracker{}
+				trackers[stream.PID] = tracker
+				decoder = newPGSDecoder(func(displaySet PGSDisplaySet) error {
+					tracker.display(displaySet.PTS, displaySet.ScreenSize, displaySet.Objects, displaySet.PaletteUpdate, 0)
+					return nil
+				}, debug)
+				decoders[stream.PID] = decoder
+			}
+			// A PES packet holds whole segments: type (1 byte), size (2 bytes) and data
+			timestamp := time.Duration(pts) * time.Second / tsTimestampClock
+			for len(payload) >= 3 {
+				size := int(binary.BigEndian.Uint16(payload[1:3]))
+				if 3+size > len(payload) {
+					return errors.New("truncated PGS segment")
+				}
+				if err = decoder.decodeSegment(payload[0], timestamp, payload[3:3+size]); err != nil {
+					return
+				}
+				payload = payload[3+size:]
+			}
+			return
+		},
+	)
+	if err != nil {
+		err = fmt.Errorf("failed to demux the transport stream: %w", err)
+		return
+	}
+	start = time.Duration(startPTS) * time.Second / tsTimestampClock
+	subs = make(map[uint16][]ImageSubtitle, len(trackers))
+	for pid, tracker := range trackers {
+		tracker.finish()
+		subs[pid] = tracker.subs
+	}
+	return
+}
+
+// bdMainPlaylist returns the longest playlist of a PLAYLIST folder
+func bdMainPlaylist(playlistFolder string) (longest bdPlaylist, err error) {
+	entries, err := os.ReadDir(playlistFolder)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".mpls") {
+			continue
+		}
+		playlist, err := readMPLS(filepath.Join(playlistFolder, entry.Name()))
+		if err != nil {
+			fmt.Printf("WARNING: skipping playlist %s: %s\n", entry.Name(), err)
+			continue
+		}
+		if playlist.Duration() > longest.Duration() {
+			longest = playlist
+		}
+	}
+	if len(longest.Items) == 0 {
+		err = errors.New("no valid playlist found")
+	}
+	return
+}
+
+// readMPLS reads the play items of a movie playlist file and the PGS streams of their STN table
+func readMPLS(filePath string) (playlist bdPlaylist, err error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return
+	}
+	if len(data) < 20 || string(data[0:4]) != "MPLS" {
+		err = errors.New("invalid playlist header")
+		return
+	}
+	playlist.Name = filepath.Base(filePath)
+	start := int(binary.BigEndian.Uint32(data[8:12]))
+	if start+10 > len(data) {
+		err = errors.New("invalid playlist start address")
+		return
+	}
+	itemsCount := int(binary.BigEndian.Uint16(data[start+6 : start+8]))
+	items := data[start+10:]
+	for range itemsCount {
+		if len(items) < 2 {
+			err = errors.New("truncated play item")
+			return
+		}
+		length := int(binary.BigEndian.Uint16(items[0:2]))
+		if length < bdPlayItemMinLength || 2+length > len(items) {
+			err = errors.New("invalid play item length")
+			return
+		}
+		var item bdPlayItem
+		if item, err = readMPLSPlayItem(items[2 : 2+length]); err != nil {
+			return
+		}
+		playlist.Items = append(playlist.Items, item)
+		items = items[2+length:]
+	}
+	return
+}
+
+func readMPLSPlayItem(data []byte) (item bdPlayItem, err error) {
+	item.Clip = string(data[0:5])
+	multiAngle := data[10]&0x10 != 0
+	item.In = time.Duration(binary.BigEndian.Uint32(data[12:16])) * time.Second / bdTimeClock
+	item.Out = time.Duration(binary.BigEndian.Uint32(data[16:20])) * time.Second / bdTimeClock
+	stn := data[bdPlayItemMinLength:]
+	if multiAngle {
+		if len(stn) < 2 {
+			err = errors.New("truncated play item angles")
+			return
+		}
+		// the other angles: clip name, codec identifier and STC id
+		angles := int(stn[0])
+		if 2+(angles-1)*10 > len(stn) {
+			err = errors.New("truncated play item angles")
+			return
+		}
+		stn = stn[2+max(0, angles-1)*10:]
+	}
+	// STN table: length, reserved, the number of streams of each kind then the streams
+	if len(stn) < 16 {
+		err = errors.New("truncated STN table")
+		return
+	}
+	counts := stn[4:11]
+	streams := stn[16:]
+	item.PGSLanguages = make(map[uint16]string)
+	// primary video, primary audio then PG streams
+	for kind := range 3 {
+		for range int(counts[kind]) {
+			var (
+				pid      uint16
+				language string
+			)
+			if pid, language, streams, err = readSTNStream(streams); err != nil {
+				return
+			}
+			if kind == 2 {
+				item.PGSLanguages[pid] = normalizeLanguageCode(language)
+				item.PGSStreamPIDs = append(item.PGSStreamPIDs, pid)
+			}
+		}
+	}
+	return
+}
+
+// readSTNStream reads a stream entry and its attributes. The language is only set for PG, IG and text streams.
+func readSTNStream(data []byte) (pid uint16, language string, remaining []byte, err error) {
+	if len(data) < 1 || 1+int(data[0]) > len(data) {
+		err = errors.New("truncated stream entry")
+		return
+	}
+	entry := data[1 : 1+int(data[0])]
+	data = data[1+int(data[0]):]
+	if len(entry) < 3 {
+		err = errors.New("invalid stream entry")
+		return
+	}
+	switch entry[0] {
+	case 1:
+		// stream of the play item clip
+		pid = binary.BigEndian.Uint16(entry[1:3])
+	case 2, 4:
+		// sub path: sub path id, sub clip id then PID
+		if len(entry) < 5 {
+			err = errors.New("invalid stream entry")
+			return
+		}
+		pid = binary.BigEndian.Uint16(entry[3:5])
+	case 3:
+		// in-mux sub path: sub path id then PID
+		if len(entry) < 4 {
+			err = errors.New("invalid stream entry")
+			return
+		}
+		pid = binary.BigEndian.Uint16(entry[2:4])
+	}
+	if len(data) < 1 || 1+int(data[0]) > len(data) {
+		err = errors.New("truncated stream attributes")
+		return
+	}
+	attributes := data[1 : 1+int(data[0])]
+	remaining = data[1+int(data[0]):]
+	if len(attributes) >= 4 && (attributes[0] == 0x90 || attributes[0] == 0x91) {
+		language = string(attributes[1:4])
+	} else if len(attributes) >= 5 && attributes[0] == 0x92 {
+		language = string(attributes[2:5])
+	}
+	return
+}
+
+// readCLPILanguages returns the language of the PGS streams declared by a clip information file, by PID
+func readCLPILanguages(filePath string) (languages map[uint16]string, err error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return
+	}
+	if len(data) < 16 || string(data[0:4]) != "HDMV" {
+		err = errors.New("invalid clip information header")
+		return
+	}
+	// program info: length, reserved, number of program sequences then the sequences
+	programInfo := int(binary.BigEndian.Uint32(data[12:16]))
+	if programInfo+6 > len(data) {
+		err = errors.New("invalid program info address")
+		return
+	}
+	sequences := int(data[programInfo+5])
+	data = data[programInfo+6:]
+	languages = make(map[uint16]string)
+	for range sequences {
+		// SPN start, program map PID, number of streams and number of groups
+		if len(data) < 8 {
+			err = errors.New("truncated program sequence")
+			return
+		}
+		streams := int(data[6])
+		data = data[8:]
+		for range streams {
+			// PID then the stream coding info
+			if len(data) < 3 || 3+int(data[2]) > len(data) {
+				err = errors.New("truncated stream coding info")
+				return
+			}
+			pid := binary.BigEndian.Uint16(data[0:2])
+			info := data[3 : 3+int(data[2])]
+			if len(info) >= 4 && info[0] == bdStreamTypePGS {
+				languages[pid] = normalizeLanguageCode(string(info[1:4]))
+			}
+			data = data[3+int(data[2]):]
+		}
+	}
+	return
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// bdTestStream is a PG stream of a play item STN table
+type bdTestStream struct {
+	pid      uint16
+	language string
+}
+
+// bdTestPlayItem returns a play item (with its length) declaring a video stream, an audio stream and the PG streams
+func bdTestPlayItem(clip string, in, out time.Duration, pgStreams ...bdTestStream) []byte {
+	item := []byte(clip + "M2TS")
+	item = append(item, 0x00, 0x01, 0x00) // not multi angle, connection condition, STC id
+	item = binary.BigEndian.AppendUint32(item, uint32(in*bdTimeClock/time.Second))
+	item = binary.BigEndian.AppendUint32(item, uint32(out*bdTimeClock/time.Second))
+	item = append(item, make([]byte, 12)...) // UO mask, random access, still mode and time
+	streams := []byte{
+		// primary video: PID 0x1011, MPEG-4 AVC 1080p
+		9, 1, 0x10, 0x11, 0, 0, 0, 0, 0, 0, 5, 0x1b, 0x61, 0, 0, 0,
+		// primary audio: PID 0x1100, AC-3 in English
+		9, 1, 0x11, 0x00, 0, 0, 0, 0, 0, 0, 5, 0x81, 0x61, 'e', 'n', 'g',
+	}
+	for _, stream := range pgStreams {
+		streams = append(streams, 9, 1, byte(stream.pid>>8), byte(stream.pid), 0, 0, 0, 0, 0, 0)
+		streams = append(streams, 5, 0x90)
+		streams = append(streams, stream.language...)
+		streams = append(streams, 0)
+	}
+	stn := binary.BigEndian.AppendUint16(nil, uint16(14+len(streams)))
+	stn = append(stn, 0, 0, 1, 1, byte(len(pgStreams)), 0, 0, 0, 0, 0, 0, 0, 0, 0)
+	item = append(item, append(stn, streams...)...)
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(item))), item...)
+}
+
+// bdTestMPLS returns a movie playlist file made of the play items
+func bdTestMPLS(items ...[]byte) []byte {
+	data := []byte("MPLS0200")
+	data = binary.BigEndian.AppendUint32(data, 20)
+	data = append(data, make([]byte, 8)...)
+	var playlist []byte
+	for _, item := range items {
+		playlist = append(playlist, item...)
+	}
+	data = binary.BigEndian.AppendUint32(data, uint32(6+len(playlist)))
+	data = append(data, 0, 0)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(items)))
+	data = append(data, 0, 0)
+	return append(data, playlist...)
+}
+
+func TestReadMPLS(t *testing.T) {
+	folder := t.TempDir()
+	filePath := filepath.Join(folder, "00800.mpls")
+	err := os.WriteFile(filePath, bdTestMPLS(
+		bdTestPlayItem("00001", 10*time.Second, 40*time.Minute, bdTestStream{0x1200, "fre"}, bdTestStream{0x1201, "eng"}),
+		bdTestPlayItem("00002", 5*time.Minute, 50*time.Minute, bdTestStream{0x1201, "eng"}),
+	), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	playlist, err := readMPLS(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := bdPlaylist{
+		Name: "00800.mpls",
+		Items: []bdPlayItem{
+			{
+				Clip:          "00001",
+				In:            10 * time.Second,
+				Out:           40 * time.Minute,
+				PGSLanguages:  map[uint16]string{0x1200: normalizeLanguageCode("fre"), 0x1201: normalizeLanguageCode("eng")},
+				PGSStreamPIDs: []uint16{0x1200, 0x1201},
+			},
+			{
+				Clip:          "00002",
+				In:            5 * time.Minute,
+				Out:           50 * time.Minute,
+				PGSLanguages:  map[uint16]string{0x1201: normalizeLanguageCode("eng")},
+				PGSStreamPIDs: []uint16{0x1201},
+			},
+		},
+	}
+	if !reflect.DeepEqual(playlist, expected) {
+		t.Errorf("got %+v, expected %+v", playlist, expected)
+	}
+	if duration := playlist.Duration(); duration != 40*time.Minute-10*time.Second+45*time.Minute {
+		t.Errorf("got a duration of %v", duration)
+	}
+	// truncated STN table
+	data := bdTestMPLS(bdTestPlayItem("00001", 0, time.Minute, bdTestStream{0x1200, "fre"}))
+	if err = os.WriteFile(filePath, data[:len(data)-8], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readMPLS(filePath); err == nil {
+		t.Error("a truncated playlist must fail")
+	}
+}
+
+func TestReadSTNStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		pid      uint16
+		language string
+	}{
+		{name: "play item clip PG", data: []byte{9, 1, 0x12, 0x00, 0, 0, 0, 0, 0, 0, 5, 0x90, 'j', 'p', 'n', 0}, pid: 0x1200, language: "jpn"},
+		{name: "sub path PG", data: []byte{9, 2, 0, 0, 0x12, 0x01, 0, 0, 0, 0, 5, 0x90, 'f', 'r', 'a', 0}, pid: 0x1201, language: "fra"},
+		{name: "in-mux sub path IG", data: []byte{9, 3, 0, 0x14, 0x00, 0, 0, 0, 0, 0, 5, 0x91, 'e', 'n', 'g', 0}, pid: 0x1400, language: "eng"},
+		{name: "text subtitle", data: []byte{9, 1, 0x18, 0x00, 0, 0, 0, 0, 0, 0, 5, 0x92, 1, 'd', 'e', 'u'}, pid: 0x1800, language: "deu"},
+		{name: "video", data: []byte{9, 1, 0x10, 0x11, 0, 0, 0, 0, 0, 0, 5, 0x1b, 0x61, 0, 0, 0}, pid: 0x1011},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := append(test.data, 0xaa)
+			pid, language, remaining, err := readSTNStream(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pid != test.pid || language != test.language || !reflect.DeepEqual(remaining, []byte{0xaa}) {
+				t.Errorf("got PID 0x%x, language %q and %v remaining", pid, language, remaining)
+			}
+		})
+	}
+	if _, _, _, err := readSTNStream([]byte{9, 1, 0x12, 0x00, 0, 0, 0, 0, 0, 0, 5, 0x90}); err == nil {
+		t.Error("truncated attributes must fail")
+	}
+}
+
+func TestReadCLPILanguages(t *testing.T) {
+	data := []byte("HDMV0200")
+	data = binary.BigEndian.AppendUint32(data, 0)
+	data = binary.BigEndian.AppendUint32(data, 16) // program info
+	data = append(data, 0, 0, 0, 0, 0, 1)          // length, reserved and one program sequence
+	data = append(data, 0, 0, 0, 0, 0x01, 0x00, 3, 0)
+	data = append(data, 0x10, 0x11, 5, 0x1b, 0x61, 0, 0, 0)
+	data = append(data, 0x12, 0x00, 5, 0x90, 'f', 'r', 'e', 0)
+	data = append(data, 0x12, 0x01, 5, 0x90, 'e', 'n', 'g', 0)
+	filePath := filepath.Join(t.TempDir(), "00001.clpi")
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	languages, err := readCLPILanguages(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[uint16]string{0x1200: normalizeLanguageCode("fre"), 0x1201: normalizeLanguageCode("eng")}
+	if !reflect.DeepEqual(languages, expected) {
+		t.Errorf("got %v, expected %v", languages, expected)
+	}
+}
+
+func TestBDMainPlaylist(t *testing.T) {
+	folder := t.TempDir()
+	playlists := map[string][]byte{
+		// menu loop
+		"00000.mpls": bdTestMPLS(bdTestPlayItem("00000", 0, time.Minute)),
+		// main title in two parts
+		"00001.mpls": bdTestMPLS(
+			bdTestPlayItem("00001", 0, 50*time.Minute, bdTestStream{0x1200, "eng"}),
+			bdTestPlayItem("00002", 0, 45*time.Minute, bdTestStream{0x1200, "eng"}),
+		),
+		// longest single clip, shorter than the main title
+		"00002.mpls": bdTestMPLS(bdTestPlayItem("00003", 0, 90*time.Minute)),
+		"00003.mpls": []byte("MPLS"),
+		"index.bdmv": []byte("INDX0200"),
+	}
+	for name, data := range playlists {
+		if err := os.WriteFile(filepath.Join(folder, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	playlist, err := bdMainPlaylist(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playlist.Name != "00001.mpls" || len(playlist.Items) != 2 {
+		t.Errorf("got playlist %s with %d item(s), expected 00001.mpls with 2 items", playlist.Name, len(playlist.Items))
+	}
+	if _, err = bdMainPlaylist(t.TempDir()); err == nil {
+		t.Error("a folder without playlist must fail")
+	}
+}
+
+func TestBDPlayItemSubtitles(t *testing.T) {
+	item := bdPlayItem{Clip: "00002", In: 10 * time.Minute, Out: 20 * time.Minute}
+	clipSubs := []ImageSubtitle{
+		{StartTime: 9 * time.Minute, EndTime: 9*time.Minute + 5*time.Second}, // before the IN time
+		{StartTime: 10*time.Minute - time.Second, EndTime: 10*time.Minute + time.Second},
+		{StartTime: 15 * time.Minute, EndTime: 15*time.Minute + 3*time.Second},
+		{StartTime: 20*time.Minute - time.Second, EndTime: 20*time.Minute + 2*time.Second},
+		{StartTime: 20 * time.Minute, EndTime: 20*time.Minute + time.Second}, // after the OUT time
+	}
+	offset := 45 * time.Minute
+	subs := bdPlayItemSubtitles(clipSubs, item, offset)
+	expected := [][2]time.Duration{
+		{offset, offset + time.Second},
+		{offset + 5*time.Minute, offset + 5*time.Minute + 3*time.Second},
+		{offset + 10*time.Minute - time.Second, offset + 10*time.Minute},
+	}
+	if len(subs) != len(expected) {
+		t.Fatalf("got %d subtitle(s), expected %d", len(subs), len(expected))
+	}
+	for index, sub := range subs {
+		if sub.StartTime != expected[index][0] || sub.EndTime != expected[index][1] {
+			t.Errorf("subtitle #%d: got %v --> %v, expected %v --> %v", index, sub.StartTime, sub.EndTime, expected[index][0], expected[index][1])
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bdnDocument is a BDN XML index (BDSup2Sub, SubtitleEdit...), its events reference PNG images
+type bdnDocument struct {
+	Description struct {
+		Language struct {
+			Code string `xml:"Code,attr"`
+		} `xml:"Language"`
+		Format struct {
+			VideoFormat string `xml:"VideoFormat,attr"`
+			FrameRate   string `xml:"FrameRate,attr"`
+		} `xml:"Format"`
+	} `xml:"Description"`
+	Events []struct {
+		InTC     string `xml:"InTC,attr"`
+		OutTC    string `xml:"OutTC,attr"`
+		Forced   string `xml:"Forced,attr"`
+		Graphics []struct {
+			Width  int    `xml:"Width,attr"`
+			Height int    `xml:"Height,attr"`
+			X      int    `xml:"X,attr"`
+			Y      int    `xml:"Y,attr"`
+			File   string `xml:",chardata"`
+		} `xml:"Graphic"`
+	} `xml:"Events>Event"`
+}
+
+// bdnVideoFormats are the screen sizes of the BDN video formats
+var bdnVideoFormats = map[string]image.Point{
+	"1080p": image.Pt(1920, 1080),
+	"1080i": image.Pt(1920, 1080),
+	"720p":  image.Pt(1280, 720),
+	"576p":  image.Pt(720, 576),
+	"576i":  image.Pt(720, 576),
+	"480p":  image.Pt(720, 480),
+	"480i":  image.Pt(720, 480),
+}
+
+// ParseBDNFile reads a BDN XML file and the PNG images of its events, which are searched next to the
+// XML file. Each graphic of an event is a subtitle, in screen order (see ImageSubtitle.Region).
+func ParseBDNFile(filePath string) (streams map[int]SubtitleStream, err error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		err = fmt.Errorf("failed to read file: %w", err)
+		return
+	}
+	var document bdnDocument
+	if err = xml.Unmarshal(data, &document); err != nil {
+		err = fmt.Errorf("failed to parse XML: %w", err)
+		return
+	}
+	frameRate, err := strconv.ParseFloat(document.Description.Format.FrameRate, 64)
+	if err != nil || frameRate <= 0 {
+		return nil, fmt.Errorf("invalid frame rate %q", document.Description.Format.FrameRate)
+	}
+	screenSize, found := bdnVideoFormats[strings.ToLower(document.Description.Format.VideoFormat)]
+	if !found {
+		return nil, fmt.Errorf("unknown video format %q", document.Description.Format.VideoFormat)
+	}
+	stream := SubtitleStream{
+		Language: normalizeLanguageCode(document.Description.Language.Code),
+	}
+	for index, event := range document.Events {
+		var start, end time.Duration
+		if start, err = bdnTimecode(event.InTC, frameRate); err != nil {
+			return nil, fmt.Errorf("event #%d: invalid InTC: %w", index+1, err)
+		}
+		if end, err = bdnTimecode(event.OutTC, frameRate); err != nil {
+			return nil, fmt.Errorf("event #%d: invalid OutTC: %w", index+1, err)
+		}
+		graphics := event.Graphics
+		// Screen order: top to bottom, then left to right
+		sort.SliceStable(graphics, func(i, j int) bool {
+			if graphics[i].Y != graphics[j].Y {
+				return graphics[i].Y < graphics[j].Y
+			}
+			return graphics[i].X < graphics[j].X
+		})
+		for region, graphic := range graphics {
+			var img image.Image
+			if img, err = readPNGFile(filepath.Join(filepath.Dir(filePath), strings.TrimSpace(graphic.File))); err != nil {
+				return nil, fmt.Errorf("event #%d: %w", index+1, err)
+			}
+			stream.Subtitles = append(stream.Subtitles, ImageSubtitle{
+				Image:      img,
+				StartTime:  start,
+				EndTime:    end,
+				Screen:     image.Rect(graphic.X, graphic.Y, graphic.X+graphic.Width, graphic.Y+graphic.Height),
+				ScreenSize: screenSize,
+				Region:     region,
+				Forced:     strings.EqualFold(event.Forced, "true"),
+			})
+		}
+	}
+	streams = map[int]SubtitleStream{0: stream}
+	return
+}
+
+// bdnTimecode converts a HH:MM:SS:FF timecode, the frames are counted at the frame rate
+func bdnTimecode(timecode string, frameRate float64) (timestamp time.Duration, err error) {
+	parts := strings.Split(timecode, ":")
+	if len(parts) != 4 {
+		return 0, fmt.Errorf("%q is not a HH:MM:SS:FF timecode", timecode)
+	}
+	values := make([]int, len(parts))
+	for i, part := range parts {
+		if values[i], err = strconv.Atoi(part); err != nil {
+			return 0, fmt.Errorf("%q is not a HH:MM:SS:FF timecode", timecode)
+		}
+	}
+	timestamp = time.Duration(values[0])*time.Hour + time.Duration(values[1])*time.Minute + time.Duration(values[2])*time.Second
+	timestamp += time.Duration(float64(values[3]) / frameRate * float64(time.Second))
+	return
+}
+
+func readPNGFile(filePath string) (img image.Image, err error) {
+	fd, err := os.Open(filePath)
+	if err != nil {
+		err = fmt.Errorf("failed to open image: %w", err)
+		return
+	}
+	defer fd.Close()
+	if img, err = png.Decode(fd); err != nil {
+		err = fmt.Errorf("failed to decode image %q: %w", filepath.Base(filePath), err)
+	}
+	return
+}
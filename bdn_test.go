@@ -0,0 +1,97 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBDNTimecode(t *testing.T) {
+	for _, test := range []struct {
+		timecode  string
+		frameRate float64
+		expected  time.Duration
+	}{
+		{"00:00:00:00", 25, 0},
+		{"01:02:03:12", 25, time.Hour + 2*time.Minute + 3480*time.Millisecond},
+		{"00:00:10:12", 23.976, 10*time.Second + 500500500*time.Nanosecond},
+		{"00:00:00:59", 59.94, 984317650 * time.Nanosecond},
+	} {
+		timestamp, err := bdnTimecode(test.timecode, test.frameRate)
+		if err != nil {
+			t.Errorf("%s: %s", test.timecode, err)
+			continue
+		}
+		// the frame durations are not whole nanoseconds
+		if diff := timestamp - test.expected; diff < -time.Microsecond || diff > time.Microsecond {
+			t.Errorf("%s at %g fps: got %v, expected %v", test.timecode, test.frameRate, timestamp, test.expected)
+		}
+	}
+	for _, timecode := range []string{"00:00:01.00", "00:00:01", "00:00:aa:00", ""} {
+		if _, err := bdnTimecode(timecode, 25); err == nil {
+			t.Errorf("invalid timecode %q must fail", timecode)
+		}
+	}
+}
+
+func TestParseBDNFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"top.png", "bottom.png"} {
+		fd, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = png.Encode(fd, image.NewPaletted(image.Rect(0, 0, 4, 2), color.Palette{color.Transparent, color.White})); err != nil {
+			t.Fatal(err)
+		}
+		if err = fd.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the bottom graphic is listed first: the regions follow the screen order
+	document := `<?xml version="1.0" encoding="UTF-8"?>
+<BDN Version="0.93">
+	<Description>
+		<Language Code="fra"/>
+		<Format VideoFormat="1080p" FrameRate="25" DropFrame="false"/>
+	</Description>
+	<Events>
+		<Event InTC="00:00:01:00" OutTC="00:00:02:12" Forced="True">
+			<Graphic Width="4" Height="2" X="100" Y="900"> bottom.png </Graphic>
+			<Graphic Width="4" Height="2" X="200" Y="50">top.png</Graphic>
+		</Event>
+	</Events>
+</BDN>`
+	filePath := filepath.Join(dir, "subtitles.xml")
+	if err := os.WriteFile(filePath, []byte(document), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	streams, err := ParseBDNFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := streams[0]
+	if stream.Language != "fr" || len(stream.Subtitles) != 2 {
+		t.Fatalf("got language %q and %d subtitle(s)", stream.Language, len(stream.Subtitles))
+	}
+	for index, expected := range []image.Rectangle{image.Rect(200, 50, 204, 52), image.Rect(100, 900, 104, 902)} {
+		sub := stream.Subtitles[index]
+		if sub.Screen != expected || sub.Region != index || !sub.Forced || sub.ScreenSize != image.Pt(1920, 1080) {
+			t.Errorf("subtitle #%d: got screen %v, region %d, forced %v and screen size %v", index, sub.Screen, sub.Region, sub.Forced, sub.ScreenSize)
+		}
+		if sub.StartTime != time.Second || sub.EndTime != 2480*time.Millisecond {
+			t.Errorf("subtitle #%d: got %v --> %v", index, sub.StartTime, sub.EndTime)
+		}
+	}
+	// a missing image fails the file
+	if err = os.Remove(filepath.Join(dir, "top.png")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ParseBDNFile(filePath); err == nil {
+		t.Error("a missing image must fail")
+	}
+}
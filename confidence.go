@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/openai/openai-go/v3"
+)
+
+// NoConfidence is used when the backend did not return any log probabilities
+const NoConfidence = -1
+
+// TokensConfidence returns the lowest probability of the generated tokens, for the whole cue: a single doubtful
+// character is enough to make it wrong.
+func TokensConfidence(tokens []openai.ChatCompletionTokenLogprob) (confidence float64) {
+	if len(tokens) == 0 {
+		return NoConfidence
+	}
+	confidence = 1
+	for _, token := range tokens {
+		confidence = math.Min(confidence, math.Exp(token.Logprob))
+	}
+	return
+}
+
+// LowestConfidence returns the indexes of the n subtitles with the lowest confidence, lowest first.
+// Subtitles without confidence score are ignored.
+func LowestConfidence(srtSubs SRTSubtitles, n int) (indexes []int) {
+	indexes = make([]int, 0, len(srtSubs))
+	for index, sub := range srtSubs {
+		if sub.Confidence != NoConfidence {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return srtSubs[indexes[i]].Confidence < srtSubs[indexes[j]].Confidence
+	})
+	if len(indexes) > n {
+		indexes = indexes[:n]
+	}
+	return
+}
+
+func printLowConfidence(srtSubs SRTSubtitles, n int, sidecarPath string) (err error) {
+	indexes := LowestConfidence(srtSubs, n)
+	if len(indexes) == 0 {
+		fmt.Println("No confidence scores available: the backend did not return any log probabilities")
+		return
+	}
+	fmt.Printf("%d lowest confidence cue(s):\n", len(indexes))
+	writeLowConfidence(os.Stdout, srtSubs, indexes, "\t")
+	if sidecarPath == "" {
+		return
+	}
+	fd, err := os.Create(sidecarPath)
+	if err != nil {
+		err = fmt.Errorf("failed to create the confidence file: %w", err)
+		return
+	}
+	defer fd.Close()
+	if err = writeLowConfidence(fd, srtSubs, indexes, ""); err != nil {
+		err = fmt.Errorf("failed to write the confidence file: %w", err)
+		return
+	}
+	fmt.Printf("Lowest confidence cues written to %q\n", sidecarPath)
+	return
+}
+
+func writeLowConfidence(output io.Writer, srtSubs SRTSubtitles, indexes []int, prefix string) (err error) {
+	for _, index := range indexes {
+		sub := srtSubs[index]
+		if _, err = fmt.Fprintf(output, "%s#%d %s --> %s (%.1f%%): %s\n",
+			prefix, index+1, sub.Start, sub.End, sub.Confidence*100, strings.ReplaceAll(sub.Text, "\n", " / "),
+		); err != nil {
+			return
+		}
+	}
+	return
+}
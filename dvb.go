@@ -0,0 +1,615 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"sort"
+	"time"
+)
+
+// DVB subtitles (ETSI EN 300 743) segment types
+const (
+	dvbSegmentPage              = 0x10
+	dvbSegmentRegion            = 0x11
+	dvbSegmentCLUT              = 0x12
+	dvbSegmentObject            = 0x13
+	dvbSegmentDisplayDefinition = 0x14
+	dvbSegmentEndOfDisplaySet   = 0x80
+)
+
+const (
+	dvbStreamTypePrivate         = 0x06
+	dvbSubtitlingDescriptor      = 0x59
+	dvbSubtitlingDescriptorEntry = 8
+)
+
+// dvbCLUT holds the colors of a CLUT for each pixel depth
+type dvbCLUT struct {
+	Depth2 color.Palette
+	Depth4 color.Palette
+	Depth8 color.Palette
+}
+
+func (clut *dvbCLUT) palette(depth int) color.Palette {
+	switch depth {
+	case 2:
+		return clut.Depth2
+	case 4:
+		return clut.Depth4
+	default:
+		return clut.Depth8
+	}
+}
+
+type dvbRegionObject struct {
+	ObjectID uint16
+	Position image.Point
+}
+
+type dvbRegion struct {
+	Width, Height int
+	Depth         int // bits per pixel: 2, 4 or 8
+	CLUTID        byte
+	Objects       []dvbRegionObject
+	Pixels        []byte
+}
+
+type dvbPageRegion struct {
+	RegionID byte
+	Position image.Point
+}
+
+// dvbDecoder decodes the display sets of a DVB subtitles service. CLUTs, regions and objects are kept for
+// the whole epoch (until a page mode change).
+type dvbDecoder struct {
+	compositionPage, ancillaryPage uint16
+	screenSize                     image.Point
+	cluts                          map[byte]*dvbCLUT
+	regions                        map[byte]*dvbRegion
+	pageRegions                    []dvbPageRegion
+	pageTimeout                    time.Duration
+	pageUpdated                    bool
+	tracker                        screenTracker
+}
+
+func newDVBDecoder(compositionPage, ancillaryPage uint16) *dvbDecoder {
+	decoder := &dvbDecoder{
+		compositionPage: compositionPage,
+		ancillaryPage:   ancillaryPage,
+	}
+	decoder.reset()
+	return decoder
+}
+
+func (decoder *dvbDecoder) reset() {
+	decoder.screenSize = image.Pt(720, 576) // default display definition
+	decoder.cluts = make(map[byte]*dvbCLUT)
+	decoder.regions = make(map[byte]*dvbRegion)
+	decoder.pageRegions = nil
+}
+
+// decodePES decodes the segments of a PES packet payload, the screen is updated once they are all read
+func (decoder *dvbDecoder) decodePES(pts time.Duration, payload []byte) (err error) {
+	// data identifier (0x20) and subtitle stream id (0x00)
+	if len(payload) < 2 || payload[0] != 0x20 || payload[1] != 0x00 {
+		return
+	}
+	for data := payload[2:]; len(data) >= 6 && data[0] == 0x0f; {
+		segmentType := data[1]
+		pageID := binary.BigEndian.Uint16(data[2:4])
+		length := int(binary.BigEndian.Uint16(data[4:6]))
+		if 6+length > len(data) {
+			return errors.New("truncated segment")
+		}
+		segment := data[6 : 6+length]
+		data = data[6+length:]
+		if pageID != decoder.compositionPage && pageID != decoder.ancillaryPage {
+			continue
+		}
+		switch segmentType {
+		case dvbSegmentPage:
+			err = decoder.decodePage(segment)
+		case dvbSegmentRegion:
+			err = decoder.decodeRegion(segment)
+		case dvbSegmentCLUT:
+			err = decoder.decodeCLUT(segment)
+		case dvbSegmentObject:
+			err = decoder.decodeObject(segment)
+		case dvbSegmentDisplayDefinition:
+			if len(segment) >= 5 {
+				decoder.screenSize = image.Pt(int(binary.BigEndian.Uint16(segment[1:3]))+1, int(binary.BigEndian.Uint16(segment[3:5]))+1)
+			}
+		case dvbSegmentEndOfDisplaySet:
+			decoder.display(pts)
+		}
+		if err != nil {
+			return fmt.Errorf("segment 0x%02x at %v: %w", segmentType, pts, err)
+		}
+	}
+	// Not every broadcaster sends the end of display set segment: a PES packet holds a whole display set
+	decoder.display(pts)
+	return
+}
+
+func (decoder *dvbDecoder) decodePage(segment []byte) (err error) {
+	if len(segment) < 2 {
+		return errors.New("page composition segment too short")
+	}
+	if (segment[1]>>2)&0x3 == 2 {
+		// mode change: new epoch
+		decoder.reset()
+	}
+	decoder.pageTimeout = time.Duration(segment[0]) * time.Second
+	decoder.pageRegions = decoder.pageRegions[:0]
+	for regions := segment[2:]; len(regions) >= 6; regions = regions[6:] {
+		decoder.pageRegions = append(decoder.pageRegions, dvbPageRegion{
+			RegionID: regions[0],
+			Position: image.Pt(int(binary.BigEndian.Uint16(regions[2:4])), int(binary.BigEndian.Uint16(regions[4:6]))),
+		})
+	}
+	decoder.pageUpdated = true
+	return
+}
+
+func (decoder *dvbDecoder) decodeRegion(segment []byte) (err error) {
+	if len(segment) < 10 {
+		return errors.New("region composition segment too short")
+	}
+	regionID := segment[0]
+	fill := segment[1]&0x08 != 0
+	width := int(binary.BigEndian.Uint16(segment[2:4]))
+	height := int(binary.BigEndian.Uint16(segment[4:6]))
+	depth := 1 << ((segment[6] >> 2) & 0x7) // 1: 2 bits, 2: 4 bits, 3: 8 bits
+	var background byte
+	switch depth {
+	case 2:
+		background = (segment[9] >> 2) & 0x3
+	case 4:
+		background = segment[9] >> 4
+	default:
+		depth = 8
+		background = segment[8]
+	}
+	region, found := decoder.regions[regionID]
+	if !found || region.Width != width || region.Height != height || region.Depth != depth {
+		region = &dvbRegion{
+			Width:  width,
+			Height: height,
+			Depth:  depth,
+			Pixels: make([]byte, width*height),
+		}
+		decoder.regions[regionID] = region
+		fill = true
+	}
+	region.CLUTID = segment[7]
+	if fill {
+		for i := range region.Pixels {
+			region.Pixels[i] = background
+		}
+	}
+	region.Objects = region.Objects[:0]
+	for objects := segment[10:]; len(objects) >= 6; {
+		objectType := objects[2] >> 6
+		region.Objects = append(region.Objects, dvbRegionObject{
+			ObjectID: binary.BigEndian.Uint16(objects[0:2]),
+			Position: image.Pt(int(binary.BigEndian.Uint16(objects[2:4])&0x0fff), int(binary.BigEndian.Uint16(objects[4:6])&0x0fff)),
+		})
+		if objectType == 1 || objectType == 2 {
+			// character objects have their foreground and background pixel codes
+			objects = objects[min(8, len(objects)):]
+		} else {
+			objects = objects[6:]
+		}
+	}
+	decoder.pageUpdated = true
+	return
+}
+
+func (decoder *dvbDecoder) decodeCLUT(segment []byte) (err error) {
+	if len(segment) < 2 {
+		return errors.New("CLUT definition segment too short")
+	}
+	clut, found := decoder.cluts[segment[0]]
+	if !found {
+		clut = newDVBDefaultCLUT()
+	} else {
+		// Update a copy: the already decoded images must keep their colors
+		clut = &dvbCLUT{
+			Depth2: append(color.Palette(nil), clut.Depth2...),
+			Depth4: append(color.Palette(nil), clut.Depth4...),
+			Depth8: append(color.Palette(nil), clut.Depth8...),
+		}
+	}
+	decoder.cluts[segment[0]] = clut
+	for entries := segment[2:]; len(entries) >= 2; {
+		entryID, flags := entries[0], entries[1]
+		var y, cr, cb, t byte
+		if flags&0x01 != 0 {
+			if len(entries) < 6 {
+				break
+			}
+			y, cr, cb, t = entries[2], entries[3], entries[4], entries[5]
+			entries = entries[6:]
+		} else {
+			if len(entries) < 4 {
+				break
+			}
+			value := binary.BigEndian.Uint16(entries[2:4])
+			y, cr, cb, t = byte(value>>10)<<2, byte(value>>6&0xf)<<4, byte(value>>2&0xf)<<4, byte(value&0x3)<<6
+			entries = entries[4:]
+		}
+		entryColor := color.NRGBA{} // Y at 0 is a fully transparent color
+		if y != 0 {
+			entryColor = yCrCbToNRGBA(y, cr, cb, 255-t)
+		}
+		if flags&0x80 != 0 && entryID < 4 {
+			clut.Depth2[entryID] = entryColor
+		}
+		if flags&0x40 != 0 && entryID < 16 {
+			clut.Depth4[entryID] = entryColor
+		}
+		if flags&0x20 != 0 {
+			clut.Depth8[entryID] = entryColor
+		}
+	}
+	return
+}
+
+func (decoder *dvbDecoder) decodeObject(segment []byte) (err error) {
+	if len(segment) < 3 {
+		return errors.New("object data segment too short")
+	}
+	objectID := binary.BigEndian.Uint16(segment[0:2])
+	if codingMethod := (segment[2] >> 2) & 0x3; codingMethod != 0 {
+		// character strings: no bitmap to decode
+		return
+	}
+	if len(segment) < 7 {
+		return errors.New("object data segment too short")
+	}
+	topLength := int(binary.BigEndian.Uint16(segment[3:5]))
+	bottomLength := int(binary.BigEndian.Uint16(segment[5:7]))
+	if 7+topLength+bottomLength > len(segment) {
+		return errors.New("object data segment too short for its fields")
+	}
+	top := segment[7 : 7+topLength]
+	bottom := segment[7+topLength : 7+topLength+bottomLength]
+	if bottomLength == 0 {
+		bottom = top
+	}
+	// Draw the object in every region using it
+	for _, region := range decoder.regions {
+		for _, object := range region.Objects {
+			if object.ObjectID != objectID {
+				continue
+			}
+			dvbDrawField(region, object.Position, top, 0)
+			dvbDrawField(region, object.Position, bottom, 1)
+			decoder.pageUpdated = true
+		}
+	}
+	return
+}
+
+// display updates the screen with the regions of the page
+func (decoder *dvbDecoder) display(pts time.Duration) {
+	if !decoder.pageUpdated {
+		return
+	}
+	decoder.pageUpdated = false
+	objects := make([]ScreenObject, 0, len(decoder.pageRegions))
+	for _, pageRegion := range decoder.pageRegions {
+		region, found := decoder.regions[pageRegion.RegionID]
+		if !found || len(region.Objects) == 0 {
+			continue
+		}
+		clut, found := decoder.cluts[region.CLUTID]
+		if !found {
+			clut = newDVBDefaultCLUT()
+		}
+		img := image.NewPaletted(image.Rect(0, 0, region.Width, region.Height), clut.palette(region.Depth))
+		copy(img.Pix, region.Pixels)
+		if screenOpacity(img) == 0 {
+			continue
+		}
+		objects = append(objects, ScreenObject{
+			Image:  img,
+			Screen: img.Rect.Add(pageRegion.Position),
+			Window: img.Rect.Add(pageRegion.Position),
+		})
+	}
+	// Screen order: top to bottom, then left to right
+	sort.SliceStable(objects, func(i, j int) bool {
+		if objects[i].Screen.Min.Y != objects[j].Screen.Min.Y {
+			return objects[i].Screen.Min.Y < objects[j].Screen.Min.Y
+		}
+		return objects[i].Screen.Min.X < objects[j].Screen.Min.X
+	})
+	if len(objects) == 0 && len(decoder.tracker.current) == 0 {
+		// page refresh while nothing is displayed
+		return
+	}
+	decoder.tracker.display(pts, decoder.screenSize, objects, false, decoder.pageTimeout)
+}
+
+// dvbDrawField decodes the pixel data sub-blocks of a field (lines 0, 2, 4... or 1, 3, 5...) of an object
+func dvbDrawField(region *dvbRegion, position image.Point, data []byte, firstLine int) {
+	map2to4 := []byte{0x0, 0x7, 0x8, 0xf}
+	map2to8 := []byte{0x00, 0x77, 0x88, 0xff}
+	map4to8 := []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	x, y := position.X, position.Y+firstLine
+	draw := func(length int, code byte, depth int) {
+		switch {
+		case depth == 2 && region.Depth == 4:
+			code = map2to4[code]
+		case depth == 2 && region.Depth == 8:
+			code = map2to8[code]
+		case depth == 4 && region.Depth == 8:
+			code = map4to8[code]
+		}
+		for ; length > 0; length-- {
+			if x >= 0 && x < region.Width && y >= 0 && y < region.Height {
+				region.Pixels[y*region.Width+x] = code
+			}
+			x++
+		}
+	}
+	for index := 0; index < len(data); {
+		dataType := data[index]
+		index++
+		switch dataType {
+		case 0x10, 0x11, 0x12:
+			reader := &bitReader{data: data[index:]}
+			switch dataType {
+			case 0x10:
+				dvbDecode2Bits(reader, draw)
+			case 0x11:
+				dvbDecode4Bits(reader, draw)
+			case 0x12:
+				dvbDecode8Bits(reader, draw)
+			}
+			reader.align()
+			index += reader.bit / 8
+		case 0x20:
+			if index+2 > len(data) {
+				return
+			}
+			reader := &bitReader{data: data[index : index+2]}
+			map2to4 = make([]byte, 4)
+			for i := range map2to4 {
+				map2to4[i] = byte(reader.read(4))
+			}
+			index += 2
+		case 0x21:
+			if index+4 > len(data) {
+				return
+			}
+			map2to8 = append([]byte(nil), data[index:index+4]...)
+			index += 4
+		case 0x22:
+			if index+16 > len(data) {
+				return
+			}
+			map4to8 = append([]byte(nil), data[index:index+16]...)
+			index += 16
+		case 0xf0:
+			// end of object line
+			x, y = position.X, y+2
+		default:
+			return
+		}
+	}
+}
+
+func dvbDecode2Bits(reader *bitReader, draw func(length int, code byte, depth int)) {
+	for reader.bit/8 < len(reader.data) {
+		if code := reader.read(2); code != 0 {
+			draw(1, byte(code), 2)
+			continue
+		}
+		if reader.read(1) == 1 {
+			length := reader.read(3) + 3
+			draw(length, byte(reader.read(2)), 2)
+			continue
+		}
+		if reader.read(1) == 1 {
+			draw(1, 0, 2)
+			continue
+		}
+		switch reader.read(2) {
+		case 0:
+			return // end of string
+		case 1:
+			draw(2, 0, 2)
+		case 2:
+			length := reader.read(4) + 12
+			draw(length, byte(reader.read(2)), 2)
+		case 3:
+			length := reader.read(8) + 29
+			draw(length, byte(reader.read(2)), 2)
+		}
+	}
+}
+
+func dvbDecode4Bits(reader *bitReader, draw func(length int, code byte, depth int)) {
+	for reader.bit/8 < len(reader.data) {
+		if code := reader.read(4); code != 0 {
+			draw(1, byte(code), 4)
+			continue
+		}
+		if reader.read(1) == 0 {
+			length := reader.read(3)
+			if length == 0 {
+				return // end of string
+			}
+			draw(length+2, 0, 4)
+			continue
+		}
+		if reader.read(1) == 0 {
+			length := reader.read(2) + 4
+			draw(length, byte(reader.read(4)), 4)
+			continue
+		}
+		switch reader.read(2) {
+		case 0:
+			draw(1, 0, 4)
+		case 1:
+			draw(2, 0, 4)
+		case 2:
+			length := reader.read(4) + 9
+			draw(length, byte(reader.read(4)), 4)
+		case 3:
+			length := reader.read(8) + 25
+			draw(length, byte(reader.read(4)), 4)
+		}
+	}
+}
+
+func dvbDecode8Bits(reader *bitReader, draw func(length int, code byte, depth int)) {
+	for reader.bit/8 < len(reader.data) {
+		if code := reader.read(8); code != 0 {
+			draw(1, byte(code), 8)
+			continue
+		}
+		if reader.read(1) == 0 {
+			length := reader.read(7)
+			if length == 0 {
+				return // end of string
+			}
+			draw(length, 0, 8)
+			continue
+		}
+		length := reader.read(7)
+		draw(length, byte(reader.read(8)), 8)
+	}
+}
+
+// newDVBDefaultCLUT returns the default CLUT defined by the specification
+func newDVBDefaultCLUT() *dvbCLUT {
+	clut := &dvbCLUT{
+		Depth2: color.Palette{
+			color.NRGBA{},
+			color.NRGBA{R: 255, G: 255, B: 255, A: 255},
+			color.NRGBA{A: 255},
+			color.NRGBA{R: 127, G: 127, B: 127, A: 255},
+		},
+		Depth4: make(color.Palette, 16),
+		Depth8: make(color.Palette, 256),
+	}
+	bit := func(i, mask int, value uint8) uint8 {
+		if i&mask != 0 {
+			return value
+		}
+		return 0
+	}
+	clut.Depth4[0] = color.NRGBA{}
+	for i := 1; i < 16; i++ {
+		level := uint8(255)
+		if i >= 8 {
+			level = 127
+		}
+		clut.Depth4[i] = color.NRGBA{R: bit(i, 1, level), G: bit(i, 2, level), B: bit(i, 4, level), A: 255}
+	}
+	clut.Depth8[0] = color.NRGBA{}
+	for i := 1; i < 256; i++ {
+		switch {
+		case i < 8:
+			clut.Depth8[i] = color.NRGBA{R: bit(i, 1, 255), G: bit(i, 2, 255), B: bit(i, 4, 255), A: 63}
+		case i&0x88 == 0x00, i&0x88 == 0x08:
+			alpha := uint8(255)
+			if i&0x88 == 0x08 {
+				alpha = 127
+			}
+			clut.Depth8[i] = color.NRGBA{
+				R: bit(i, 0x01, 85) + bit(i, 0x10, 170),
+				G: bit(i, 0x02, 85) + bit(i, 0x20, 170),
+				B: bit(i, 0x04, 85) + bit(i, 0x40, 170),
+				A: alpha,
+			}
+		case i&0x88 == 0x80:
+			clut.Depth8[i] = color.NRGBA{
+				R: 127 + bit(i, 0x01, 43) + bit(i, 0x10, 85),
+				G: 127 + bit(i, 0x02, 43) + bit(i, 0x20, 85),
+				B: 127 + bit(i, 0x04, 43) + bit(i, 0x40, 85),
+				A: 255,
+			}
+		default:
+			clut.Depth8[i] = color.NRGBA{
+				R: bit(i, 0x01, 43) + bit(i, 0x10, 85),
+				G: bit(i, 0x02, 43) + bit(i, 0x20, 85),
+				B: bit(i, 0x04, 43) + bit(i, 0x40, 85),
+				A: 255,
+			}
+		}
+	}
+	return clut
+}
+
+// ParseDVBFile decodes the DVB subtitles streams of an MPEG transport stream, the streams are identified by
+// their PID
+func ParseDVBFile(filePath string) (streams map[int]SubtitleStream, err error) {
+	fd, err := os.Open(filePath)
+	if err != nil {
+		err = fmt.Errorf("failed to open file: %w", err)
+		return
+	}
+	defer fd.Close()
+	decoders := make(map[uint16]*dvbDecoder)
+	languages := make(map[uint16]string)
+	// PES timestamps are converted once the start of the transport stream is known
+	type dvbPES struct {
+		pid     uint16
+		pts     uint64
+		payload []byte
+	}
+	var packets []dvbPES
+	start, err := demuxTS(fd, tsPacketSize,
+		func(stream tsElementaryStream) bool {
+			if stream.StreamType != dvbStreamTypePrivate {
+				return false
+			}
+			if _, found := decoders[stream.PID]; found {
+				return true
+			}
+			// Subtitling descriptor: language (3 bytes), type, composition page and ancillary page of each service.
+			// Only the first service of a PID is decoded.
+			tsDescriptors(stream.Descriptors, func(tag byte, data []byte) {
+				if _, found := decoders[stream.PID]; found || tag != dvbSubtitlingDescriptor || len(data) < dvbSubtitlingDescriptorEntry {
+					return
+				}
+				languages[stream.PID] = normalizeLanguageCode(string(data[0:3]))
+				decoders[stream.PID] = newDVBDecoder(binary.BigEndian.Uint16(data[4:6]), binary.BigEndian.Uint16(data[6:8]))
+			})
+			_, found := decoders[stream.PID]
+			return found
+		},
+		func(stream tsElementaryStream, pts uint64, payload []byte) error {
+			packets = append(packets, dvbPES{pid: stream.PID, pts: pts, payload: payload})
+			return nil
+		},
+	)
+	if err != nil {
+		err = fmt.Errorf("failed to demux the transport stream: %w", err)
+		return
+	}
+	for _, packet := range packets {
+		if decodeErr := decoders[packet.pid].decodePES(tsTimestamp(packet.pts, start), packet.payload); decodeErr != nil {
+			// the rest of the PES packet is skipped, the next ones are still decoded
+			fmt.Printf("WARNING: PID %d: skipping the rest of an invalid PES packet: %s\n", packet.pid, decodeErr)
+		}
+	}
+	streams = make(map[int]SubtitleStream, len(decoders))
+	for pid, decoder := range decoders {
+		decoder.tracker.finish()
+		streams[int(pid)] = SubtitleStream{
+			ID:        int(pid),
+			Language:  languages[pid],
+			Subtitles: decoder.tracker.subs,
+		}
+	}
+	return
+}
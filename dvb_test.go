@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dvbTestBits packs a string of 0 and 1 (spaces are ignored) into bytes, the last byte is padded with zeros
+func dvbTestBits(bits string) (data []byte) {
+	bits = strings.ReplaceAll(bits, " ", "")
+	for index, bit := range bits {
+		if index%8 == 0 {
+			data = append(data, 0)
+		}
+		if bit == '1' {
+			data[len(data)-1] |= 0x80 >> (index % 8)
+		}
+	}
+	return
+}
+
+// dvbTestRun is a run of pixels drawn by a pixel-code string decoder
+type dvbTestRun struct {
+	length int
+	code   byte
+}
+
+func TestDVBPixelCodeStrings(t *testing.T) {
+	tests := []struct {
+		name     string
+		decode   func(reader *bitReader, draw func(length int, code byte, depth int))
+		depth    int
+		bits     string
+		expected []dvbTestRun
+	}{
+		{
+			name:   "2 bits",
+			decode: dvbDecode2Bits,
+			depth:  2,
+			bits: "01" + // 1 pixel in color 1
+				"00 1 010 11" + // 3+2 pixels in color 3
+				"00 0 1" + // 1 pixel in color 0
+				"00 0 0 01" + // 2 pixels in color 0
+				"00 0 0 10 0001 10" + // 12+1 pixels in color 2
+				"00 0 0 11 00000001 01" + // 29+1 pixels in color 1
+				"00 0 0 00", // end of string
+			expected: []dvbTestRun{{1, 1}, {5, 3}, {1, 0}, {2, 0}, {13, 2}, {30, 1}},
+		},
+		{
+			name:   "4 bits",
+			decode: dvbDecode4Bits,
+			depth:  4,
+			bits: "0101" + // 1 pixel in color 5
+				"0000 0 011" + // 3+2 pixels in color 0
+				"0000 1 0 10 1001" + // 2+4 pixels in color 9
+				"0000 1 1 00" + // 1 pixel in color 0
+				"0000 1 1 01" + // 2 pixels in color 0
+				"0000 1 1 10 0011 0111" + // 3+9 pixels in color 7
+				"0000 1 1 11 00000010 1111" + // 2+25 pixels in color 15
+				"0000 0 000", // end of string
+			expected: []dvbTestRun{{1, 5}, {5, 0}, {6, 9}, {1, 0}, {2, 0}, {12, 7}, {27, 15}},
+		},
+		{
+			name:   "8 bits",
+			decode: dvbDecode8Bits,
+			depth:  8,
+			bits: "00010010" + // 1 pixel in color 18
+				"00000000 0 0000101" + // 5 pixels in color 0
+				"00000000 1 0000011 11111111" + // 3 pixels in color 255
+				"00000000 0 0000000", // end of string
+			expected: []dvbTestRun{{1, 18}, {5, 0}, {3, 255}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var runs []dvbTestRun
+			reader := &bitReader{data: dvbTestBits(test.bits + "11111111")}
+			test.decode(reader, func(length int, code byte, depth int) {
+				if depth != test.depth {
+					t.Errorf("got depth %d, expected %d", depth, test.depth)
+				}
+				runs = append(runs, dvbTestRun{length, code})
+			})
+			if !reflect.DeepEqual(runs, test.expected) {
+				t.Errorf("got %v, expected %v", runs, test.expected)
+			}
+			// the bits after the end of string are not read
+			if length := len(strings.ReplaceAll(test.bits, " ", "")); reader.bit != length {
+				t.Errorf("read %d bits, expected %d", reader.bit, length)
+			}
+		})
+	}
+}
+
+func TestDVBDrawField(t *testing.T) {
+	region := &dvbRegion{Width: 4, Height: 4, Depth: 8, Pixels: make([]byte, 16)}
+	data := []byte{0x10}
+	// 2 bits: colors 1, 2, 3 then 1 pixel out of the region
+	data = append(data, dvbTestBits("01 10 11 01 00 0 0 00")...)
+	data = append(data, 0xf0)
+	// 4 bits: colors 1 and 15 on the next line of the field
+	data = append(data, 0x11)
+	data = append(data, dvbTestBits("0001 1111 0000 0 000")...)
+	data = append(data, 0xf0)
+	dvbDrawField(region, image.Pt(1, 0), data, 1)
+	expected := []byte{
+		0, 0, 0, 0,
+		0, 0x77, 0x88, 0xff,
+		0, 0, 0, 0,
+		0, 0x11, 0xff, 0,
+	}
+	if !bytes.Equal(region.Pixels, expected) {
+		t.Errorf("got %v, expected %v", region.Pixels, expected)
+	}
+}
+
+// dvbTestSegment returns a subtitling segment of the composition page 1
+func dvbTestSegment(segmentType byte, data ...byte) []byte {
+	return append([]byte{0x0f, segmentType, 0x00, 0x01, byte(len(data) >> 8), byte(len(data))}, data...)
+}
+
+func TestParseDVBFileInvalidPES(t *testing.T) {
+	pat := []byte{0x00, 0x00, 0xb0, 0x0d, 0x00, 0x01, 0xc1, 0x00, 0x00, 0x00, 0x01, 0xe0 | tsTestPMTPID>>8, tsTestPMTPID & 0xff, 0, 0, 0, 0}
+	pmt := []byte{0x00, 0x02, 0xb0, 0x1c, 0x00, 0x01, 0xc1, 0x00, 0x00, 0xe1, 0x00, 0xf0, 0x00,
+		dvbStreamTypePrivate, 0xe0 | tsTestStreamPID>>8, tsTestStreamPID & 0xff, 0xf0, 10,
+		dvbSubtitlingDescriptor, 8, 'e', 'n', 'g', 0x10, 0x00, 0x01, 0x00, 0x01, 0, 0, 0, 0}
+	stream := append(tsTestPacket(tsPIDPAT, true, 0, nil, pat), tsTestPacket(tsTestPMTPID, true, 0, nil, pmt)...)
+	pesPayloads := [][]byte{
+		// the page composition segment is truncated
+		append([]byte{0x20, 0x00}, dvbTestSegment(dvbSegmentPage, 5, 0x08)[:7]...),
+		// a 4x2 region with 4 opaque pixels on each line
+		slices.Concat([]byte{0x20, 0x00},
+			dvbTestSegment(dvbSegmentPage, 5, 0x08, 0x00, 0xff, 0x00, 0x64, 0x01, 0xf4),
+			dvbTestSegment(dvbSegmentRegion, 0x00, 0x08, 0x00, 0x04, 0x00, 0x02, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00),
+			dvbTestSegment(dvbSegmentCLUT, 0x00, 0x00, 0x01, 0x41, 235, 128, 128, 0),
+			dvbTestSegment(dvbSegmentObject, 0x00, 0x00, 0x00, 0x00, 0x05, 0x00, 0x00, 0x11, 0x11, 0x11, 0x00, 0xf0),
+			dvbTestSegment(dvbSegmentEndOfDisplaySet),
+		),
+		// the page is cleared
+		slices.Concat([]byte{0x20, 0x00}, dvbTestSegment(dvbSegmentPage, 5, 0x00), dvbTestSegment(dvbSegmentEndOfDisplaySet)),
+	}
+	for index, payload := range pesPayloads {
+		stream = append(stream, tsTestPacket(tsTestStreamPID, true, byte(index), nil, tsTestPES(uint64(index+1)*90000, payload))...)
+	}
+	filePath := filepath.Join(t.TempDir(), "dvb.ts")
+	if err := os.WriteFile(filePath, stream, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	streams, err := ParseDVBFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subs := streams[tsTestStreamPID].Subtitles
+	if len(subs) != 1 {
+		t.Fatalf("got %d subtitle(s), expected 1", len(subs))
+	}
+	if subs[0].StartTime != time.Second || subs[0].EndTime != 2*time.Second || subs[0].Screen != image.Rect(100, 500, 104, 502) {
+		t.Errorf("got %v --> %v at %v", subs[0].StartTime, subs[0].EndTime, subs[0].Screen)
+	}
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hekmon/go-vobsub"
+)
+
+const (
+	dvdSectorSize          = 2048
+	dvdReadSectors         = 512 // sectors read at once when demuxing
+	dvdSubpictureStreams   = 32
+	dvdTitleEntrySize      = 12
+	dvdCellEntrySize       = 24
+	dvdPaletteSize         = 16
+	dvdStreamIDPrivate1    = 0xbd
+	dvdStreamIDPrivate2    = 0xbf
+	dvdSubpictureSubstream = 0x20 // 0x20 to 0x3f
+)
+
+// dvdTitle is a title of a disc, played from the program chains of a video title set
+type dvdTitle struct {
+	Number    int
+	VTS       int
+	Chapters  int
+	Duration  time.Duration
+	Languages map[int]string // language of the subpicture streams, by stream ID
+	Palette   color.Palette
+	VideoSize image.Point
+	Cells     []dvdCell
+}
+
+// dvdCell is a part of a title: sectors of the title VOBs of the video title set
+type dvdCell struct {
+	FirstSector, LastSector int64
+	Duration                time.Duration
+}
+
+// dvdVideoTSFolder returns the VIDEO_TS folder of a DVD folder (the VIDEO_TS folder itself or its parent)
+func dvdVideoTSFolder(folderPath string) (videoTSPath string, found bool) {
+	for _, candidate := range []string{folderPath, filepath.Join(folderPath, "VIDEO_TS")} {
+		if _, err := os.Stat(filepath.Join(candidate, "VIDEO_TS.IFO")); err == nil {
+			return candidate, true
+		}
+	}
+	return
+}
+
+// ParseDVD decodes the subpicture streams of a title of a DVD (VIDEO_TS folder or ISO image file). The title
+// number starts at 1, 0 selects the longest title. The subtitles are timed from the start of the title.
+func ParseDVD(inputPath string, titleNumber int) (streams map[int]SubtitleStream, err error) {
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return
+	}
+	var fsys fs.FS
+	if !info.IsDir() {
+		// the registry detected an ISO image from its content, whatever its extension
+		var isoImage *os.File
+		if isoImage, err = os.Open(inputPath); err != nil {
+			err = fmt.Errorf("failed to open file: %w", err)
+			return
+		}
+		defer isoImage.Close()
+		if fsys, err = openISODirectory(isoImage, "VIDEO_TS"); err != nil {
+			err = fmt.Errorf("failed to read the ISO image: %w", err)
+			return
+		}
+	} else {
+		videoTSPath, found := dvdVideoTSFolder(inputPath)
+		if !found {
+			return nil, errors.New("no VIDEO_TS.IFO file found")
+		}
+		fsys = os.DirFS(videoTSPath)
+	}
+	titles, err := readDVDTitles(fsys)
+	if err != nil {
+		err = fmt.Errorf("failed to read the titles: %w", err)
+		return
+	}
+	if titleNumber > len(titles) {
+		return nil, fmt.Errorf("title %d does not exist (the disc has %d titles)", titleNumber, len(titles))
+	}
+	var title dvdTitle
+	fmt.Println("Titles:")
+	for _, candidate := range titles {
+		if (titleNumber == 0 && candidate.Duration > title.Duration) || candidate.Number == titleNumber {
+			title = candidate
+		}
+	}
+	for _, candidate := range titles {
+		selected := " "
+		if candidate.Number == title.Number {
+			selected = "*"
+		}
+		fmt.Printf(" %s #%d: %v, %d chapter(s), subtitles: %s\n", selected, candidate.Number,
+			candidate.Duration.Round(time.Second), candidate.Chapters, describeDVDLanguages(candidate.Languages))
+	}
+	packets, err := demuxDVDTitle(fsys, title)
+	if err != nil {
+		err = fmt.Errorf("failed to demux title %d: %w", title.Number, err)
+		return
+	}
+	metadata := vobsub.IdxMetadata{
+		Width:      title.VideoSize.X,
+		Height:     title.VideoSize.Y,
+		AlphaRatio: 1,
+		Palette:    title.Palette,
+	}
+	if streams, err = decodeVobSubPackets(packets, metadata); err != nil {
+		err = fmt.Errorf("failed to decode title %d subpictures: %w", title.Number, err)
+		return
+	}
+	for id, stream := range streams {
+		stream.Language = title.Languages[id]
+		streams[id] = stream
+	}
+	return
+}
+
+func describeDVDLanguages(languages map[int]string) string {
+	if len(languages) == 0 {
+		return "none"
+	}
+	descriptions := make([]string, 0, len(languages))
+	for id := range dvdSubpictureStreams {
+		if language, found := languages[id]; found {
+			if language == "" {
+				language = "unknown language"
+			}
+			descriptions = append(descriptions, fmt.Sprintf("#%d %s", id, language))
+		}
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// readDVDTitles reads the title search pointer table of the VIDEO_TS.IFO file then the program chains of
+// each title from its video title set IFO file
+func readDVDTitles(fsys fs.FS) (titles []dvdTitle, err error) {
+	vmg, err := fs.ReadFile(fsys, "VIDEO_TS.IFO")
+	if err != nil {
+		return
+	}
+	if len(vmg) < 0xc8 || string(vmg[0:12]) != "DVDVIDEO-VMG" {
+		return nil, errors.New("invalid VIDEO_TS.IFO header")
+	}
+	table := int(binary.BigEndian.Uint32(vmg[0xc4:0xc8])) * dvdSectorSize
+	if table+8 > len(vmg) {
+		return nil, errors.New("invalid title search pointer table address")
+	}
+	count := int(binary.BigEndian.Uint16(vmg[table : table+2]))
+	vtsIFOs := make(map[int][]byte)
+	for index := range count {
+		entry := table + 8 + index*dvdTitleEntrySize
+		if entry+dvdTitleEntrySize > len(vmg) {
+			return nil, errors.New("truncated title search pointer table")
+		}
+		title := dvdTitle{
+			Number:   index + 1,
+			Chapters: int(binary.BigEndian.Uint16(vmg[entry+2 : entry+4])),
+			VTS:      int(vmg[entry+6]),
+		}
+		vts, found := vtsIFOs[title.VTS]
+		if !found {
+			if vts, err = fs.ReadFile(fsys, fmt.Sprintf("VTS_%02d_0.IFO", title.VTS)); err != nil {
+				return
+			}
+			if len(vts) < 0x256+dvdSubpictureStreams*6 || string(vts[0:12]) != "DVDVIDEO-VTS" {
+				return nil, fmt.Errorf("invalid VTS_%02d_0.IFO header", title.VTS)
+			}
+			vtsIFOs[title.VTS] = vts
+		}
+		if err = readDVDTitle(vts, int(vmg[entry+7]), &title); err != nil {
+			return nil, fmt.Errorf("title %d: %w", title.Number, err)
+		}
+		titles = append(titles, title)
+	}
+	return
+}
+
+// readDVDTitle reads the program chains of a title of a video title set
+func readDVDTitle(vts []byte, vtsTitle int, title *dvdTitle) (err error) {
+	// Video attributes: TV standard and aspect ratio
+	title.VideoSize = image.Pt(720, 480)
+	if (vts[0x200]>>4)&0x3 == 1 {
+		title.VideoSize.Y = 576
+	}
+	widescreen := (vts[0x200]>>2)&0x3 == 3
+	// Part of title search pointer table: the program chain of each chapter
+	ptt := int(binary.BigEndian.Uint32(vts[0xc8:0xcc])) * dvdSectorSize
+	if ptt+8+vtsTitle*4 > len(vts) || vtsTitle == 0 {
+		return errors.New("invalid part of title search pointer table")
+	}
+	start := ptt + int(binary.BigEndian.Uint32(vts[ptt+8+(vtsTitle-1)*4:ptt+8+vtsTitle*4]))
+	end := ptt + int(binary.BigEndian.Uint32(vts[ptt+4:ptt+8])) + 1
+	if vtsTitle < int(binary.BigEndian.Uint16(vts[ptt:ptt+2])) {
+		end = ptt + int(binary.BigEndian.Uint32(vts[ptt+8+vtsTitle*4:ptt+12+vtsTitle*4]))
+	}
+	var pgcNumbers []int
+	for entry := start; entry+4 <= min(end, len(vts)); entry += 4 {
+		pgcNumber := int(binary.BigEndian.Uint16(vts[entry : entry+2]))
+		if len(pgcNumbers) == 0 || pgcNumbers[len(pgcNumbers)-1] != pgcNumber {
+			pgcNumbers = append(pgcNumbers, pgcNumber)
+		}
+	}
+	if len(pgcNumbers) == 0 {
+		return errors.New("no program chain")
+	}
+	// Program chains
+	pgci := int(binary.BigEndian.Uint32(vts[0xcc:0xd0])) * dvdSectorSize
+	if pgci+8 > len(vts) {
+		return errors.New("invalid program chain information table address")
+	}
+	title.Languages = make(map[int]string)
+	for index, pgcNumber := range pgcNumbers {
+		entry := pgci + 8 + (pgcNumber-1)*8
+		if pgcNumber == 0 || entry+8 > len(vts) {
+			return fmt.Errorf("invalid program chain number %d", pgcNumber)
+		}
+		pgc := pgci + int(binary.BigEndian.Uint32(vts[entry+4:entry+8]))
+		if pgc+0xec > len(vts) {
+			return fmt.Errorf("invalid program chain %d address", pgcNumber)
+		}
+		title.Duration += dvdDuration(vts[pgc+4 : pgc+8])
+		if index == 0 {
+			// Subpicture streams of the title: attributes (language) then the stream ID used by the program chain
+			streams := int(binary.BigEndian.Uint16(vts[0x254:0x256]))
+			for stream := range min(streams, dvdSubpictureStreams) {
+				control := vts[pgc+0x1c+stream*4 : pgc+0x1c+stream*4+4]
+				if control[0]&0x80 == 0 {
+					continue
+				}
+				id := int(control[0] & 0x1f)
+				if widescreen {
+					id = int(control[1] & 0x1f)
+				}
+				var language string
+				if attributes := vts[0x256+stream*6 : 0x256+stream*6+6]; attributes[0]&0x3 == 1 {
+					language = normalizeLanguageCode(strings.Trim(string(attributes[2:4]), "\x00 "))
+				}
+				title.Languages[id] = language
+			}
+			title.Palette = make(color.Palette, dvdPaletteSize)
+			for i := range dvdPaletteSize {
+				entry := vts[pgc+0xa4+i*4 : pgc+0xa4+i*4+4]
+				title.Palette[i] = yCrCbToNRGBA(entry[1], entry[2], entry[3], 255)
+			}
+		}
+		cells := pgc + int(binary.BigEndian.Uint16(vts[pgc+0xe8:pgc+0xea]))
+		for cell := range int(vts[pgc+3]) {
+			info := cells + cell*dvdCellEntrySize
+			if info+dvdCellEntrySize > len(vts) {
+				return fmt.Errorf("truncated program chain %d cells", pgcNumber)
+			}
+			// Only the first angle of an angle block is read
+			if blockMode, blockType := vts[info]>>6, (vts[info]>>4)&0x3; blockType == 1 && blockMode > 1 {
+				continue
+			}
+			title.Cells = append(title.Cells, dvdCell{
+				FirstSector: int64(binary.BigEndian.Uint32(vts[info+8 : info+12])),
+				LastSector:  int64(binary.BigEndian.Uint32(vts[info+20 : info+24])),
+				Duration:    dvdDuration(vts[info+4 : info+8]),
+			})
+		}
+	}
+	return
+}
+
+// dvdDuration decodes a BCD playback time: hours, minutes, seconds and frames (with the frame rate)
+func dvdDuration(data []byte) time.Duration {
+	bcd := func(value byte) time.Duration {
+		return time.Duration(value>>4)*10 + time.Duration(value&0xf)
+	}
+	duration := bcd(data[0])*time.Hour + bcd(data[1])*time.Minute + bcd(data[2])*time.Second
+	switch data[3] >> 6 {
+	case 1:
+		duration += bcd(data[3]&0x3f) * time.Second / 25
+	case 3:
+		duration += bcd(data[3]&0x3f) * time.Second * 1001 / 30000
+	}
+	return duration
+}
+
+// demuxDVDTitle returns the subpicture packets of the cells of a title, their PTS are rebased on the
+// start of the title
+func demuxDVDTitle(fsys fs.FS, title dvdTitle) (packets []vobsub.PESPacket, err error) {
+	vobs, err := openDVDTitleVOBs(fsys, title.VTS)
+	if err != nil {
+		return
+	}
+	defer vobs.Close()
+	var offset time.Duration
+	buffer := make([]byte, dvdReadSectors*dvdSectorSize)
+	for _, cell := range title.Cells {
+		cellStart := int64(-1) // PTS of the first video object unit of the cell
+		for sector := cell.FirstSector; sector <= cell.LastSector; sector += dvdReadSectors {
+			sectors := min(dvdReadSectors, cell.LastSector-sector+1)
+			var read int
+			if read, err = vobs.ReadAt(buffer[:sectors*dvdSectorSize], sector*dvdSectorSize); err != nil && err != io.EOF {
+				return
+			}
+			err = nil
+			for pack := 0; pack+dvdSectorSize <= read; pack += dvdSectorSize {
+				if err = dvdDemuxPack(buffer[pack:pack+dvdSectorSize], offset, &cellStart, &packets); err != nil {
+					return nil, fmt.Errorf("sector %d: %w", sector+int64(pack/dvdSectorSize), err)
+				}
+			}
+			if read < int(sectors)*dvdSectorSize {
+				break
+			}
+		}
+		offset += cell.Duration
+	}
+	return
+}
+
+// dvdDemuxPack extracts the subpicture packets of a program stream pack. The start of the cell is read
+// from the first navigation pack of the cell.
+func dvdDemuxPack(pack []byte, offset time.Duration, cellStart *int64, packets *[]vobsub.PESPacket) (err error) {
+	if pack[0] != 0 || pack[1] != 0 || pack[2] != 1 || pack[3] != 0xba || pack[4]>>6 != 1 {
+		// not a MPEG-2 pack
+		return
+	}
+	for index := 14 + int(pack[13]&0x7); index+6 <= len(pack) && pack[index] == 0 && pack[index+1] == 0 && pack[index+2] == 1; {
+		streamID := pack[index+3]
+		body := pack[index+6 : min(len(pack), index+6+int(binary.BigEndian.Uint16(pack[index+4:index+6])))]
+		index += 6 + len(body)
+		switch streamID {
+		case dvdStreamIDPrivate2:
+			// presentation control information: its start PTS is at offset 12
+			if *cellStart < 0 && len(body) >= 17 && body[0] == 0 {
+				*cellStart = int64(binary.BigEndian.Uint32(body[13:17]))
+			}
+		case dvdStreamIDPrivate1:
+			if len(body) < 3 || 3+int(body[2]) >= len(body) {
+				continue
+			}
+			if body[0]&0x30 != 0 {
+				return errors.New("scrambled packet: the disc must be decrypted (CSS) first")
+			}
+			payload := body[3+int(body[2]):]
+			if payload[0]&0xe0 != dvdSubpictureSubstream {
+				continue
+			}
+			packet := vobsub.PESPacket{
+				Header: vobsub.PESHeader{
+					MPH:         vobsub.MPEGHeader{0, 0, 1, dvdStreamIDPrivate1},
+					Extension:   &vobsub.PESExtension{},
+					SubStreamID: vobsub.SubStreamID{payload[0]},
+				},
+				Payload: append([]byte(nil), payload[1:]...),
+			}
+			if body[1]&0x80 != 0 && body[2] >= 5 {
+				pts := int64(body[3]>>1&0x07)<<30 | int64(binary.BigEndian.Uint16(body[4:6])>>1)<<15 | int64(binary.BigEndian.Uint16(body[6:8])>>1)
+				ticks := int64(offset)*tsTimestampClock/int64(time.Second) + pts - max(*cellStart, 0)
+				// a zero PTS marks the continuation of a subtitle split in several packets
+				packet.Header.Extension.Data.PTS = dvdEncodePTS(uint64(max(ticks, 1)))
+			}
+			*packets = append(*packets, packet)
+		}
+	}
+	return
+}
+
+// dvdEncodePTS encodes a PTS the way it is stored in a PES header
+func dvdEncodePTS(ticks uint64) []byte {
+	return []byte{
+		0x21 | byte(ticks>>29)&0x0e,
+		byte(ticks >> 22),
+		byte(ticks>>14) | 0x01,
+		byte(ticks >> 7),
+		byte(ticks<<1) | 0x01,
+	}
+}
+
+// dvdVOBs reads the title VOBs of a video title set (VTS_XX_1.VOB to VTS_XX_9.VOB) as a single file
+type dvdVOBs struct {
+	files []fs.File
+	sizes []int64
+}
+
+func openDVDTitleVOBs(fsys fs.FS, vts int) (vobs *dvdVOBs, err error) {
+	vobs = &dvdVOBs{}
+	for part := 1; part <= 9; part++ {
+		file, err := fsys.Open(fmt.Sprintf("VTS_%02d_%d.VOB", vts, part))
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		} else if err != nil {
+			vobs.Close()
+			return nil, err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			vobs.Close()
+			return nil, err
+		}
+		if _, ok := file.(io.ReaderAt); !ok {
+			file.Close()
+			vobs.Close()
+			return nil, errors.New("VOB files do not support random access")
+		}
+		vobs.files = append(vobs.files, file)
+		vobs.sizes = append(vobs.sizes, info.Size())
+	}
+	if len(vobs.files) == 0 {
+		return nil, fmt.Errorf("no title VOB found for the video title set %d", vts)
+	}
+	return
+}
+
+// ReadAt implements io.ReaderAt over the concatenation of the VOBs
+func (vobs *dvdVOBs) ReadAt(buffer []byte, offset int64) (read int, err error) {
+	for index, file := range vobs.files {
+		if offset >= vobs.sizes[index] {
+			offset -= vobs.sizes[index]
+			continue
+		}
+		var n int
+		n, err = file.(io.ReaderAt).ReadAt(buffer[read:min(len(buffer), read+int(vobs.sizes[index]-offset))], offset)
+		read += n
+		if err != nil && err != io.EOF {
+			return
+		}
+		err = nil
+		if read == len(buffer) {
+			return
+		}
+		offset = 0
+	}
+	return read, io.EOF
+}
+
+func (vobs *dvdVOBs) Close() error {
+	for _, file := range vobs.files {
+		file.Close()
+	}
+	return nil
+}
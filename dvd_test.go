@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/hekmon/go-vobsub"
+)
+
+func TestDVDDuration(t *testing.T) {
+	tests := []struct {
+		data     []byte
+		expected time.Duration
+	}{
+		{data: []byte{0x01, 0x23, 0x45, 0x40}, expected: time.Hour + 23*time.Minute + 45*time.Second},
+		// 12 frames at 25 fps
+		{data: []byte{0x00, 0x05, 0x30, 0x40 | 0x12}, expected: 5*time.Minute + 30*time.Second + 480*time.Millisecond},
+		// 15 frames at 29.97 fps
+		{data: []byte{0x00, 0x00, 0x59, 0xc0 | 0x15}, expected: 59*time.Second + 15*time.Second*1001/30000},
+		// illegal frame rate: frames are ignored
+		{data: []byte{0x10, 0x00, 0x00, 0x12}, expected: 10 * time.Hour},
+	}
+	for _, test := range tests {
+		if got := dvdDuration(test.data); got != test.expected {
+			t.Errorf("% x: got %v, expected %v", test.data, got, test.expected)
+		}
+	}
+}
+
+func TestDVDEncodePTS(t *testing.T) {
+	for _, ticks := range []uint64{1, 90000, 0x12345678, 1<<32 | 0x2468ace, tsTimestampWrap - 1} {
+		data := vobsub.PESExtensionData{PTS: dvdEncodePTS(ticks)}
+		if got, expected := data.ComputePTS(), time.Duration(ticks*uint64(time.Second)/tsTimestampClock); got != expected {
+			t.Errorf("%d ticks: got %v, expected %v", ticks, got, expected)
+		}
+		// the PES parsing of the transport streams reads the same layout
+		pes := append([]byte{0x00, 0x00, 0x01, 0xbd, 0, 0, 0x80, 0x80, 5}, dvdEncodePTS(ticks)...)
+		if got, ok := pesPTS(pes); !ok || got != ticks {
+			t.Errorf("%d ticks: PES PTS %d", ticks, got)
+		}
+	}
+}
+
+// dvdTestPack returns a 2048 bytes MPEG-2 pack holding the PES packets
+func dvdTestPack(pesPackets ...[]byte) []byte {
+	pack := []byte{0x00, 0x00, 0x01, 0xba, 0x44, 0, 0x04, 0, 0x04, 0x01, 0x01, 0x89, 0xc3, 0xf8}
+	for _, pes := range pesPackets {
+		pack = append(pack, pes...)
+	}
+	return append(pack, bytes.Repeat([]byte{0xff}, dvdSectorSize-len(pack))...)
+}
+
+// dvdTestNavigation returns the presentation control information packet of a navigation pack
+func dvdTestNavigation(startPTS uint32) []byte {
+	body := make([]byte, 0x3d4)
+	binary.BigEndian.PutUint32(body[13:17], startPTS)
+	return append([]byte{0x00, 0x00, 0x01, dvdStreamIDPrivate2, 0x03, 0xd4}, body...)
+}
+
+// dvdTestSubpicture returns a subpicture packet of the stream, without PTS if ticks is 0
+func dvdTestSubpicture(stream byte, ticks uint64, flags byte, payload []byte) []byte {
+	body := []byte{flags, 0x00, 0x00}
+	if ticks > 0 {
+		body = []byte{flags, 0x80, 5}
+		body = append(body, dvdEncodePTS(ticks)...)
+	}
+	body = append(body, dvdSubpictureSubstream|stream)
+	body = append(body, payload...)
+	return append([]byte{0x00, 0x00, 0x01, dvdStreamIDPrivate1, byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+func TestDVDDemuxPack(t *testing.T) {
+	var (
+		packets   []vobsub.PESPacket
+		cellStart int64 = -1
+	)
+	offset := 10 * time.Second // duration of the previous cells
+	packs := [][]byte{
+		dvdTestPack(dvdTestNavigation(100 * tsTimestampClock)),
+		dvdTestPack(dvdTestSubpicture(1, 101*tsTimestampClock, 0x81, []byte{1, 2, 3})),
+		// the navigation packs after the first one do not move the start of the cell
+		dvdTestPack(dvdTestNavigation(200 * tsTimestampClock)),
+		// continuation of the subtitle
+		dvdTestPack(dvdTestSubpicture(1, 0, 0x81, []byte{4, 5})),
+		// not a MPEG-2 pack
+		append([]byte{0x00, 0x00, 0x01, 0xba, 0x24}, make([]byte, dvdSectorSize-5)...),
+	}
+	audio := dvdTestSubpicture(0, 102*tsTimestampClock, 0x81, []byte{6})
+	audio[14] = 0x80 // AC-3 substream
+	packs = append(packs, dvdTestPack(audio))
+	for index, pack := range packs {
+		if err := dvdDemuxPack(pack, offset, &cellStart, &packets); err != nil {
+			t.Fatalf("pack #%d: %s", index, err)
+		}
+	}
+	if cellStart != 100*tsTimestampClock {
+		t.Errorf("cell start: got %d, expected %d", cellStart, 100*tsTimestampClock)
+	}
+	if len(packets) != 2 {
+		t.Fatalf("got %d packet(s), expected 2", len(packets))
+	}
+	// rebased on the start of the title: previous cells duration + PTS - start of the cell
+	if pts := packets[0].Header.Extension.Data.ComputePTS(); pts != 11*time.Second {
+		t.Errorf("first packet PTS: got %v, expected 11s", pts)
+	}
+	if id := packets[0].Header.SubStreamID.SubtitleID(); id != 1 {
+		t.Errorf("first packet stream: got %d, expected 1", id)
+	}
+	if !bytes.Equal(packets[0].Payload, []byte{1, 2, 3}) || !bytes.Equal(packets[1].Payload, []byte{4, 5}) {
+		t.Errorf("unexpected payloads %v and %v", packets[0].Payload, packets[1].Payload)
+	}
+	if pts := packets[1].Header.Extension.Data.ComputePTS(); pts != 0 {
+		t.Errorf("continuation packet PTS: got %v, expected none", pts)
+	}
+	scrambled := dvdTestPack(dvdTestSubpicture(1, 101*tsTimestampClock, 0xa1, []byte{1}))
+	if err := dvdDemuxPack(scrambled, offset, &cellStart, &packets); err == nil {
+		t.Error("a scrambled packet must fail")
+	}
+}
+
+// dvdTestIFOs returns the VIDEO_TS.IFO and VTS_01_0.IFO files of a disc with one widescreen PAL title
+// made of two program chains, the first one having an angle block
+func dvdTestIFOs() fstest.MapFS {
+	vmg := make([]byte, 2*dvdSectorSize)
+	copy(vmg, "DVDVIDEO-VMG")
+	binary.BigEndian.PutUint32(vmg[0xc4:0xc8], 1)
+	table := vmg[dvdSectorSize:]
+	binary.BigEndian.PutUint16(table[0:2], 1)
+	binary.BigEndian.PutUint32(table[4:8], 8+dvdTitleEntrySize-1)
+	copy(table[8:], []byte{0x3c, 1, 0, 3, 0, 0, 1, 1})
+
+	vts := make([]byte, 4*dvdSectorSize)
+	copy(vts, "DVDVIDEO-VTS")
+	binary.BigEndian.PutUint32(vts[0xc8:0xcc], 1) // part of title search pointer table
+	binary.BigEndian.PutUint32(vts[0xcc:0xd0], 2) // program chains
+	vts[0x200] = 0x1<<4 | 0x3<<2                  // PAL 16:9
+	binary.BigEndian.PutUint16(vts[0x254:0x256], 2)
+	copy(vts[0x256:], []byte{0x01, 0, 'e', 'n', 0, 0, 0x01, 0, 'f', 'r', 0, 0})
+	// chapters: two programs of the first program chain then the second one
+	ptt := vts[dvdSectorSize:]
+	binary.BigEndian.PutUint16(ptt[0:2], 1)
+	binary.BigEndian.PutUint32(ptt[4:8], 23)
+	binary.BigEndian.PutUint32(ptt[8:12], 12)
+	copy(ptt[12:], []byte{0, 1, 0, 1, 0, 1, 0, 2, 0, 2, 0, 1})
+	pgci := vts[2*dvdSectorSize:]
+	binary.BigEndian.PutUint16(pgci[0:2], 2)
+	binary.BigEndian.PutUint32(pgci[12:16], 0x100)
+	binary.BigEndian.PutUint32(pgci[20:24], 0x300)
+	writePGC := func(pgc []byte, duration []byte, cells ...[]byte) {
+		pgc[3] = byte(len(cells))
+		copy(pgc[4:8], duration)
+		// subpicture streams: 4:3 then widescreen IDs
+		copy(pgc[0x1c:], []byte{0x80 | 0, 1, 0, 0, 0x80 | 2, 3, 0, 0})
+		copy(pgc[0xa4:], []byte{0, 235, 128, 128})
+		binary.BigEndian.PutUint16(pgc[0xe8:0xea], 0xec)
+		for index, cell := range cells {
+			copy(pgc[0xec+index*dvdCellEntrySize:], cell)
+		}
+	}
+	dvdTestCell := func(category byte, duration []byte, first, last uint32) []byte {
+		cell := make([]byte, dvdCellEntrySize)
+		cell[0] = category
+		copy(cell[4:8], duration)
+		binary.BigEndian.PutUint32(cell[8:12], first)
+		binary.BigEndian.PutUint32(cell[20:24], last)
+		return cell
+	}
+	writePGC(pgci[0x100:], []byte{0x00, 0x20, 0x00, 0x40},
+		dvdTestCell(0x00, []byte{0x00, 0x10, 0x00, 0x40}, 0, 99),
+		// angle block: only its first cell is read
+		dvdTestCell(0x50, []byte{0x00, 0x10, 0x00, 0x40}, 100, 199),
+		dvdTestCell(0xd0, []byte{0x00, 0x10, 0x00, 0x40}, 200, 299),
+	)
+	writePGC(pgci[0x300:], []byte{0x00, 0x05, 0x30, 0x40 | 0x12},
+		dvdTestCell(0x00, []byte{0x00, 0x05, 0x30, 0x40 | 0x12}, 300, 399),
+	)
+	return fstest.MapFS{
+		"VIDEO_TS.IFO": &fstest.MapFile{Data: vmg},
+		"VTS_01_0.IFO": &fstest.MapFile{Data: vts},
+	}
+}
+
+func TestReadDVDTitles(t *testing.T) {
+	titles, err := readDVDTitles(dvdTestIFOs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(titles) != 1 {
+		t.Fatalf("got %d title(s), expected 1", len(titles))
+	}
+	title := titles[0]
+	if title.Number != 1 || title.VTS != 1 || title.Chapters != 3 {
+		t.Errorf("got title #%d of VTS %d with %d chapter(s), expected #1 of VTS 1 with 3 chapters", title.Number, title.VTS, title.Chapters)
+	}
+	if expected := 25*time.Minute + 30*time.Second + 480*time.Millisecond; title.Duration != expected {
+		t.Errorf("duration: got %v, expected %v", title.Duration, expected)
+	}
+	if title.VideoSize != image.Pt(720, 576) {
+		t.Errorf("video size: got %v, expected 720x576", title.VideoSize)
+	}
+	// widescreen stream IDs
+	if expected := map[int]string{1: normalizeLanguageCode("en"), 3: normalizeLanguageCode("fr")}; !reflect.DeepEqual(title.Languages, expected) {
+		t.Errorf("languages: got %v, expected %v", title.Languages, expected)
+	}
+	if len(title.Palette) != dvdPaletteSize || title.Palette[0] != yCrCbToNRGBA(235, 128, 128, 255) {
+		t.Errorf("unexpected palette %v", title.Palette)
+	}
+	expected := []dvdCell{
+		{FirstSector: 0, LastSector: 99, Duration: 10 * time.Minute},
+		{FirstSector: 100, LastSector: 199, Duration: 10 * time.Minute},
+		{FirstSector: 300, LastSector: 399, Duration: 5*time.Minute + 30*time.Second + 480*time.Millisecond},
+	}
+	if !reflect.DeepEqual(title.Cells, expected) {
+		t.Errorf("cells: got %+v, expected %+v", title.Cells, expected)
+	}
+
+	fsys := dvdTestIFOs()
+	delete(fsys, "VTS_01_0.IFO")
+	if _, err = readDVDTitles(fsys); err == nil {
+		t.Error("a missing video title set IFO must fail")
+	}
+}
+
+func TestDVDTitleVOBs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"VTS_01_1.VOB": &fstest.MapFile{Data: []byte("0123")},
+		"VTS_01_2.VOB": &fstest.MapFile{Data: []byte("4567")},
+		"VTS_01_4.VOB": &fstest.MapFile{Data: []byte("after a missing part")},
+	}
+	vobs, err := openDVDTitleVOBs(fsys, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vobs.Close()
+	buffer := make([]byte, 4)
+	if read, err := vobs.ReadAt(buffer, 2); err != nil || string(buffer[:read]) != "2345" {
+		t.Errorf("read across the parts: got %q (%v)", buffer[:read], err)
+	}
+	if read, err := vobs.ReadAt(buffer, 6); err == nil || string(buffer[:read]) != "67" {
+		t.Errorf("read at the end: got %q (%v), expected a short read", buffer[:read], err)
+	}
+	if _, err = openDVDTitleVOBs(fsys, 2); err == nil {
+		t.Error("a video title set without VOB must fail")
+	}
+}
+
+func TestOpenISODirectoryUDF(t *testing.T) {
+	data := make([]byte, (isoPrimaryVolumeSector+1)*isoSectorSize)
+	copy(data[isoPrimaryVolumeSector*isoSectorSize:], "\x00"+udfBeginningIdentifier)
+	filePath := filepath.Join(t.TempDir(), "udf.iso")
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	format, err := DetectInputFormat(filePath)
+	if err != nil || format.Name != "DVD" {
+		t.Fatalf("got format %q (%v), expected DVD", format.Name, err)
+	}
+	image, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer image.Close()
+	if _, err = openISODirectory(image, "VIDEO_TS"); err == nil || !strings.Contains(err.Error(), "UDF only") {
+		t.Errorf("got %v, expected an unsupported UDF only image error", err)
+	}
+}
+
+func TestParseDVDMisnamedISO(t *testing.T) {
+	// an image without the .iso extension is read as an image, not as a folder
+	data := make([]byte, (isoPrimaryVolumeSector+1)*isoSectorSize)
+	copy(data[isoPrimaryVolumeSector*isoSectorSize:], "\x00"+udfBeginningIdentifier)
+	filePath := filepath.Join(t.TempDir(), "disc.img")
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseDVD(filePath, 0); err == nil || !strings.Contains(err.Error(), "UDF only") {
+		t.Errorf("got %v, expected the ISO image to be read", err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	EmptyKeep        = "keep"        // empty cues are written as is
+	EmptyDrop        = "drop"        // empty cues are removed from the output
+	EmptyPlaceholder = "placeholder" // empty cues get a placeholder text
+)
+
+// ApplyEmptyPolicy returns a copy of the subtitles with their empty cues (no text once trimmed) handled
+// according to the policy. empties contains the original empty cues.
+func ApplyEmptyPolicy(srtSubs SRTSubtitles, policy, placeholder string) (result SRTSubtitles, empties SRTSubtitles) {
+	result = make(SRTSubtitles, 0, len(srtSubs))
+	for _, sub := range srtSubs {
+		if strings.TrimSpace(sub.Text) != "" {
+			result = append(result, sub)
+			continue
+		}
+		empties = append(empties, sub)
+		switch policy {
+		case EmptyDrop:
+			continue
+		case EmptyPlaceholder:
+			sub.Text = placeholder
+		}
+		result = append(result, sub)
+	}
+	return
+}
+
+func printEmptyCues(empties SRTSubtitles, policy string) {
+	switch policy {
+	case EmptyDrop:
+		fmt.Printf("Empty cues: %d dropped, check if some text was missed:\n", len(empties))
+	case EmptyPlaceholder:
+		fmt.Printf("Empty cues: %d replaced by the placeholder:\n", len(empties))
+	default:
+		fmt.Printf("Empty cues: %d kept as is:\n", len(empties))
+	}
+	for _, sub := range empties {
+		fmt.Printf("\t%s --> %s (images %s)\n", sub.Start, sub.End, formatSources(sub.Sources))
+	}
+}
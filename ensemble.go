@@ -0,0 +1,205 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+var ensembleReplacer = strings.NewReplacer(
+	"’", "'", "‘", "'", "`", "'",
+	"“", `"`, "”", `"`,
+	"…", "...",
+	"–", "-", "—", "-", "‐", "-",
+	" ", " ", " ", " ",
+)
+
+// EnsembleVote selects the final text among the answers of several models for the same image.
+// The majority answer (once normalized) wins, otherwise a character level consensus is built and the
+// answer closest to it is kept (the first one on a tie). With 2 models and no majority, the first one wins.
+// disagreement is true as soon as one model did not agree with the others.
+func EnsembleVote(candidates []string) (text string, disagreement bool) {
+	if len(candidates) == 0 {
+		return
+	}
+	// Group candidates by their normalized version
+	normalized := make([]string, len(candidates))
+	votes := make(map[string]int, len(candidates))
+	for i, candidate := range candidates {
+		normalized[i] = ensembleNormalize(candidate)
+		votes[ensembleKey(normalized[i])]++
+	}
+	disagreement = len(votes) > 1
+	// Majority answer
+	for i := range candidates {
+		if votes[ensembleKey(normalized[i])]*2 > len(candidates) {
+			text = candidates[i]
+			return
+		}
+	}
+	// No majority: with only 2 models we can not decide, trust the main one
+	if len(candidates) < 3 {
+		text = candidates[0]
+		return
+	}
+	// The consensus is normalized: return the original answer closest to it so the casing and the
+	// punctuation always come from a model
+	consensus := []rune(ensembleConsensus(normalized))
+	bestDistance := -1
+	for i := range candidates {
+		if distance := levenshtein(consensus, []rune(normalized[i])); bestDistance == -1 || distance < bestDistance {
+			text = candidates[i]
+			bestDistance = distance
+		}
+	}
+	return
+}
+
+// ensembleNormalize unifies the typography and whitespaces of a model answer while keeping its line breaks
+func ensembleNormalize(text string) string {
+	text = ensembleReplacer.Replace(text)
+	lines := strings.Split(text, "\n")
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// ensembleKey returns the version of a normalized answer used to compare them: line breaks and
+// spaces before punctuation do not count as a disagreement
+func ensembleKey(normalized string) string {
+	key := strings.ReplaceAll(normalized, "\n", " ")
+	for _, punct := range []string{"?", "!", ":", ";"} {
+		key = strings.ReplaceAll(key, " "+punct, punct)
+	}
+	return key
+}
+
+// ensembleConsensus aligns every candidate on the medoid one (the closest to all the others) and
+// votes for each of its characters.
+func ensembleConsensus(candidates []string) string {
+	runes := make([][]rune, len(candidates))
+	for i, candidate := range candidates {
+		runes[i] = []rune(candidate)
+	}
+	// Find the medoid
+	medoid := 0
+	bestDistance := -1
+	for i := range runes {
+		var distance int
+		for j := range runes {
+			if i != j {
+				distance += levenshtein(runes[i], runes[j])
+			}
+		}
+		if bestDistance == -1 || distance < bestDistance {
+			medoid = i
+			bestDistance = distance
+		}
+	}
+	// Collect the votes of each candidate for each medoid position
+	base := runes[medoid]
+	substitutions := make([]map[string]int, len(base))
+	insertions := make([]map[string]int, len(base)+1)
+	for i := range substitutions {
+		substitutions[i] = map[string]int{string(base[i]): 1}
+	}
+	for i := range insertions {
+		insertions[i] = make(map[string]int)
+	}
+	for i := range runes {
+		if i == medoid {
+			continue
+		}
+		aligned, inserted := alignRunes(base, runes[i])
+		for pos := range base {
+			substitutions[pos][aligned[pos]]++
+		}
+		for pos := range inserted {
+			if inserted[pos] != "" {
+				insertions[pos][inserted[pos]]++
+			}
+		}
+	}
+	// Build the consensus
+	var consensus strings.Builder
+	majority := len(candidates)/2 + 1
+	for pos := range insertions {
+		for insertion, count := range insertions[pos] {
+			if count >= majority {
+				consensus.WriteString(insertion)
+				break
+			}
+		}
+		if pos == len(base) {
+			break
+		}
+		chosen := string(base[pos])
+		for value, count := range substitutions[pos] {
+			if count >= majority {
+				chosen = value
+				break
+			}
+		}
+		consensus.WriteString(chosen)
+	}
+	return strings.TrimFunc(consensus.String(), unicode.IsSpace)
+}
+
+// alignRunes aligns other on base with a minimal edit distance path. For each base position, aligned
+// contains the matching character of other (empty if deleted) and inserted the characters of other
+// inserted before it (the last inserted item being after the last base character).
+func alignRunes(base, other []rune) (aligned []string, inserted []string) {
+	matrix := levenshteinMatrix(base, other)
+	aligned = make([]string, len(base))
+	inserted = make([]string, len(base)+1)
+	i, j := len(base), len(other)
+	for i > 0 || j > 0 {
+		switch {
+		case i > 0 && j > 0 && matrix[i][j] == matrix[i-1][j-1]+substitutionCost(base[i-1], other[j-1]):
+			aligned[i-1] = string(other[j-1])
+			i--
+			j--
+		case i > 0 && matrix[i][j] == matrix[i-1][j]+1:
+			aligned[i-1] = ""
+			i--
+		default:
+			inserted[i] = string(other[j-1]) + inserted[i]
+			j--
+		}
+	}
+	return
+}
+
+func levenshtein(a, b []rune) int {
+	return levenshteinMatrix(a, b)[len(a)][len(b)]
+}
+
+func levenshteinMatrix(a, b []rune) (matrix [][]int) {
+	matrix = make([][]int, len(a)+1)
+	for i := range matrix {
+		matrix[i] = make([]int, len(b)+1)
+		matrix[i][0] = i
+	}
+	for j := range matrix[0] {
+		matrix[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			matrix[i][j] = min(
+				min(matrix[i-1][j]+1, matrix[i][j-1]+1),
+				matrix[i-1][j-1]+substitutionCost(a[i-1], b[j-1]),
+			)
+		}
+	}
+	return
+}
+
+func substitutionCost(a, b rune) int {
+	if a == b {
+		return 0
+	}
+	return 1
+}
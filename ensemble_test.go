@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestEnsembleVote(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		candidates   []string
+		text         string
+		disagreement bool
+	}{
+		{"single model", []string{"Hello."}, "Hello.", false},
+		{"same answer once normalized", []string{"Wait !", "Wait!"}, "Wait !", false},
+		{"majority among 3", []string{"Hell0 there.", "Hello there.", "Hello there."}, "Hello there.", true},
+		{"majority keeps the first original answer", []string{"Dont go.", "Don’t go.", "Don't go."}, "Don’t go.", true},
+		{"2 models disagreement: the first one wins", []string{"Hallo.", "Hello."}, "Hallo.", true},
+		{"2 out of 4 is not a majority", []string{"Go n0w!", "Go now!", "Go now!", "G0 now!"}, "Go now!", true},
+		// no majority: the original answer closest to the character level consensus is kept
+		{"no majority among 3", []string{"Don’t go there, John…", "Dont go there, John...", "Don’t  go there , Jon…"}, "Don’t go there, John…", true},
+		{"no majority among 4", []string{"G0 now!", "Go nov!", "Go now?", "Go now!"}, "Go now!", true},
+		{"no majority tie: the first closest answer wins", []string{"cat", "bat", "hat"}, "cat", true},
+	} {
+		text, disagreement := EnsembleVote(test.candidates)
+		if text != test.text || disagreement != test.disagreement {
+			t.Errorf("%s: got %q (disagreement %v), expected %q (disagreement %v)", test.name, text, disagreement, test.text, test.disagreement)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const exportManifestName = "manifest.json"
+
+// exportManifest describes the images written by ExportImages
+type exportManifest struct {
+	Input   string         `json:"input"`
+	Format  string         `json:"format"`
+	OCRNote string         `json:"ocr_note"`
+	Streams []exportStream `json:"streams"`
+}
+
+// exportOCRNote tells how the images relate to the ones sent to the model
+const exportOCRNote = "the images are sent to the model as decoded: ocr_image is the same file as image"
+
+type exportStream struct {
+	ID        int              `json:"id"`
+	Language  string           `json:"language,omitempty"`
+	Subtitles []exportSubtitle `json:"subtitles"`
+}
+
+type exportSubtitle struct {
+	Index        int    `json:"index"`
+	Image        string `json:"image"`
+	OCRImage     string `json:"ocr_image"`
+	Request      string `json:"request,omitempty"`
+	Start        string `json:"start"`
+	End          string `json:"end"`
+	StartMS      int64  `json:"start_ms"`
+	EndMS        int64  `json:"end_ms"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	X            int    `json:"x"`
+	Y            int    `json:"y"`
+	ScreenWidth  int    `json:"screen_width,omitempty"`
+	ScreenHeight int    `json:"screen_height,omitempty"`
+	Region       int    `json:"region"`
+	Forced       bool   `json:"forced"`
+}
+
+// ExportImages writes each decoded image as a numbered PNG in the folder, along with a JSON manifest of
+// their timestamps, sizes and positions. The PNG files are the ones sent to the model: no preprocessing is
+// applied to the decoded images. When requests is true, the body of the OCR request of each image is also
+// written (as generated for the main model, without the previous subtitles context).
+func ExportImages(folder, inputPath string, inputFormat InputFormat, streams map[int]SubtitleStream, requests bool,
+	cfg OCRConfig) (err error) {
+	if err = os.MkdirAll(folder, 0o755); err != nil {
+		err = fmt.Errorf("failed to create the export folder: %w", err)
+		return
+	}
+	manifest := exportManifest{
+		Input:   inputPath,
+		Format:  inputFormat.Name,
+		OCRNote: exportOCRNote,
+		Streams: make([]exportStream, 0, len(streams)),
+	}
+	var nbImages int
+	for _, streamID := range sortedStreamIDs(streams) {
+		stream := streams[streamID]
+		exported := exportStream{
+			ID:        stream.ID,
+			Language:  stream.Language,
+			Subtitles: make([]exportSubtitle, 0, len(stream.Subtitles)),
+		}
+		for index, sub := range stream.Subtitles {
+			// Numbered from 1 like the SRT cues, prefixed by the stream ID when there is several
+			baseName := fmt.Sprintf("%04d", index+1)
+			if len(streams) > 1 {
+				baseName = fmt.Sprintf("stream%d_%s", streamID, baseName)
+			}
+			entry := exportSubtitle{
+				Index:        index + 1,
+				Image:        baseName + ".png",
+				OCRImage:     baseName + ".png",
+				Start:        SRTTimestamp(sub.StartTime).String(),
+				End:          SRTTimestamp(sub.EndTime).String(),
+				StartMS:      sub.StartTime.Milliseconds(),
+				EndMS:        sub.EndTime.Milliseconds(),
+				Width:        sub.Image.Bounds().Dx(),
+				Height:       sub.Image.Bounds().Dy(),
+				X:            sub.Screen.Min.X,
+				Y:            sub.Screen.Min.Y,
+				ScreenWidth:  sub.ScreenSize.X,
+				ScreenHeight: sub.ScreenSize.Y,
+				Region:       sub.Region,
+				Forced:       sub.Forced,
+			}
+			var data []byte
+			if data, err = encodeOCRImage(sub.Image); err != nil {
+				err = fmt.Errorf("failed to encode image %q: %w", entry.Image, err)
+				return
+			}
+			if err = writePNGFile(filepath.Join(folder, entry.Image), data); err != nil {
+				return
+			}
+			if requests {
+				entry.Request = baseName + ".request.json"
+				if err = writeOCRRequestFile(filepath.Join(folder, entry.Request), sub, cfg); err != nil {
+					return
+				}
+			}
+			exported.Subtitles = append(exported.Subtitles, entry)
+			nbImages++
+		}
+		manifest.Streams = append(manifest.Streams, exported)
+	}
+	data, err := json.MarshalIndent(manifest, "", "\t")
+	if err != nil {
+		err = fmt.Errorf("failed to marshal the manifest: %w", err)
+		return
+	}
+	if err = os.WriteFile(filepath.Join(folder, exportManifestName), data, 0o644); err != nil {
+		err = fmt.Errorf("failed to write the manifest: %w", err)
+		return
+	}
+	fmt.Printf("%d image(s) and their manifest exported to %q\n", nbImages, folder)
+	return
+}
+
+// writePNGFile writes an encoded image
+func writePNGFile(filePath string, data []byte) (err error) {
+	if err = os.WriteFile(filePath, data, 0o644); err != nil {
+		err = fmt.Errorf("failed to write image: %w", err)
+	}
+	return
+}
+
+func writeOCRRequestFile(filePath string, sub ImageSubtitle, cfg OCRConfig) (err error) {
+	body, err := generateOCRBodyRequest(sub.Image, cfg.Models[0], cfg, nil)
+	if err != nil {
+		err = fmt.Errorf("failed to generate OCR body request: %w", err)
+		return
+	}
+	data, err := json.MarshalIndent(body, "", "\t")
+	if err != nil {
+		err = fmt.Errorf("failed to marshal the OCR body request: %w", err)
+		return
+	}
+	if err = os.WriteFile(filePath, data, 0o644); err != nil {
+		err = fmt.Errorf("failed to write the OCR body request: %w", err)
+	}
+	return
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportImages(t *testing.T) {
+	img := image.NewPaletted(image.Rect(0, 0, 4, 2), color.Palette{color.Transparent, color.White})
+	img.Pix[1] = 1
+	streams := map[int]SubtitleStream{
+		0: {ID: 0, Subtitles: []ImageSubtitle{{Image: img, StartTime: time.Second, EndTime: 2 * time.Second}}},
+	}
+	folder := t.TempDir()
+	if err := ExportImages(folder, "input.sup", InputFormat{Name: "PGS"}, streams, false, OCRConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(folder, exportManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest exportManifest
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Streams) != 1 || len(manifest.Streams[0].Subtitles) != 1 {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+	entry := manifest.Streams[0].Subtitles[0]
+	if entry.Image != "0001.png" || entry.OCRImage != entry.Image || manifest.OCRNote == "" || entry.Start != "00:00:01,000" || entry.Width != 4 {
+		t.Errorf("unexpected manifest entry %+v", entry)
+	}
+	if _, err = os.Stat(filepath.Join(folder, entry.Image)); err != nil {
+		t.Error(err)
+	}
+	// the OCR image is exactly the one encoded in the request
+	ocrImage, err := os.ReadFile(filepath.Join(folder, entry.OCRImage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataURL, err := encodeImageToDataURL(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded := base64.StdEncoding.EncodeToString(ocrImage); !strings.HasSuffix(dataURL, ","+encoded) {
+		t.Error("the OCR image differs from the image of the request")
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FixConfig holds the parameters of the fix rules
+type FixConfig struct {
+	MaxLineLength int
+	MinGap        time.Duration
+	Glossary      Glossary // names kept as is by the ocrchars rule
+}
+
+// FixRule is a rule based post processor fixing common OCR and formatting errors.
+// Apply returns the number of subtitles it modified.
+type FixRule struct {
+	Name        string
+	Description string
+	Apply       func(srtSubs SRTSubtitles, cfg FixConfig) (fixed int)
+}
+
+// FixRules lists all the available rules in the order they are applied
+var FixRules = []FixRule{
+	{
+		Name:        "spaces",
+		Description: "remove doubled spaces, trailing spaces and empty lines",
+		Apply:       fixTextRule(fixSpaces),
+	},
+	{
+		Name:        "dashes",
+		Description: "normalize dialogue dashes to \"- \"",
+		Apply:       fixTextRule(fixDashes),
+	},
+	{
+		Name:        "ocrchars",
+		Description: "fix l/I, l/L and 0/O confusions in context",
+		Apply: func(srtSubs SRTSubtitles, cfg FixConfig) int {
+			return fixTextRule(func(text string) string {
+				return fixOCRChars(text, cfg.Glossary)
+			})(srtSubs, cfg)
+		},
+	},
+	{
+		Name:        "italic",
+		Description: "fix unbalanced and empty <i> tags",
+		Apply:       fixTextRule(fixItalicTags),
+	},
+	{
+		Name:        "linelength",
+		Description: "merge short lines and split lines longer than the max line length",
+		Apply: func(srtSubs SRTSubtitles, cfg FixConfig) int {
+			return fixTextRule(func(text string) string {
+				return fixLineLength(text, cfg.MaxLineLength)
+			})(srtSubs, cfg)
+		},
+	},
+	{
+		Name:        "gap",
+		Description: "enforce the minimum gap between two cues",
+		Apply:       fixMinGap,
+	},
+}
+
+// ParseFixRules returns the rules selected by a comma separated list of names ("all" selects every rule)
+func ParseFixRules(list string) (rules []FixRule, err error) {
+	selected := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			selected[name] = true
+		}
+	}
+	for _, rule := range FixRules {
+		if selected["all"] || selected[rule.Name] {
+			rules = append(rules, rule)
+		}
+		delete(selected, rule.Name)
+	}
+	delete(selected, "all")
+	for name := range selected {
+		err = fmt.Errorf("unknown fix rule %q", name)
+		return
+	}
+	return
+}
+
+// FixRulesNames returns the names of all the available rules
+func FixRulesNames() (names []string) {
+	for _, rule := range FixRules {
+		names = append(names, rule.Name)
+	}
+	return
+}
+
+// ApplyFixRules applies the rules in order and returns the number of modified subtitles per rule
+func ApplyFixRules(srtSubs SRTSubtitles, rules []FixRule, cfg FixConfig) (counts []int) {
+	counts = make([]int, len(rules))
+	for i, rule := range rules {
+		counts[i] = rule.Apply(srtSubs, cfg)
+	}
+	return
+}
+
+func printFixRulesReport(rules []FixRule, counts []int) {
+	fmt.Println("Fix common errors:")
+	for i, rule := range rules {
+		fmt.Printf("\t%-10s %d subtitle(s) fixed\n", rule.Name, counts[i])
+	}
+}
+
+// fixTextRule turns a text fixing function into a rule counting the modified subtitles
+func fixTextRule(fix func(text string) string) func(srtSubs SRTSubtitles, cfg FixConfig) int {
+	return func(srtSubs SRTSubtitles, cfg FixConfig) (fixed int) {
+		for index, sub := range srtSubs {
+			if text := fix(sub.Text); text != sub.Text {
+				srtSubs[index].Text = text
+				fixed++
+			}
+		}
+		return
+	}
+}
+
+var fixSpacesRegexp = regexp.MustCompile(`[ \t]{2,}`)
+
+func fixSpaces(text string) string {
+	lines := strings.Split(text, "\n")
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line = strings.TrimSpace(fixSpacesRegexp.ReplaceAllString(line, " ")); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+var fixDashesRegexp = regexp.MustCompile(`^((?:<i>)?)[-‐‑–—―]\s*`)
+
+func fixDashes(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = fixDashesRegexp.ReplaceAllString(line, "$1- ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+var (
+	// "l" alone or as a contraction ("l'm", "l'll") is an uppercase I
+	fixLoneLRegexp = regexp.MustCompile(`(^|[\s"«>-])l(\s|'m\b|'ll\b|'ve\b|'d\b|$)`)
+	// words with an uppercase I inside, see fixInnerI
+	fixInnerIRegexp = regexp.MustCompile(`\p{L}+I\p{L}+`)
+	// words and numbers, see fixUpperL and fixDigitsLetters
+	fixWordRegexp = regexp.MustCompile(`[\p{L}\p{N}]+`)
+)
+
+// fixInnerI replaces the uppercase I of a word otherwise all lowercase by a lowercase l ("heIlo"). Words
+// with other uppercase letters ("McIntosh", "MacInnes") and the glossary words are kept as is.
+func fixInnerI(word string, glossary Glossary) string {
+	for _, r := range word {
+		if r != 'I' && !unicode.IsLower(r) {
+			return word
+		}
+	}
+	for _, entry := range glossary {
+		for _, entryWord := range strings.Fields(entry) {
+			if strings.EqualFold(entryWord, word) {
+				return word
+			}
+		}
+	}
+	return strings.ReplaceAll(word, "I", "l")
+}
+
+// fixUpperL replaces the lowercase l of a word otherwise all uppercase by an uppercase L ("KILlED"), or by
+// an I when it would make a run of three L ("KlLLED"). At least two uppercase letters are required to tell
+// an uppercase word.
+func fixUpperL(word string) string {
+	runes := []rune(word)
+	var upper int
+	for _, r := range runes {
+		switch {
+		case r == 'l':
+		case unicode.IsUpper(r):
+			upper++
+		default:
+			return word
+		}
+	}
+	if upper < 2 {
+		return word
+	}
+	isL := func(r rune) bool { return r == 'l' || r == 'L' }
+	fixed := slices.Clone(runes)
+	for i, r := range runes {
+		if r != 'l' {
+			continue
+		}
+		first, last := i, i
+		for first > 0 && isL(runes[first-1]) {
+			first--
+		}
+		for last < len(runes)-1 && isL(runes[last+1]) {
+			last++
+		}
+		if last-first >= 2 {
+			fixed[i] = 'I'
+		} else {
+			fixed[i] = 'L'
+		}
+	}
+	return string(fixed)
+}
+
+// fixDigitsLetters fixes the 0/O confusions of a word: the O of a number otherwise made of at least two
+// digits is a 0 ("1O0") and the 0 of a word otherwise made of letters is an O ("C0ME", "0h"). Mixed words
+// ("O2", "3o") are kept as is.
+func fixDigitsLetters(word string) string {
+	var letters, digits, o, zeros int
+	for _, r := range word {
+		switch {
+		case r == 'O' || r == 'o':
+			o++
+		case r == '0':
+			zeros++
+		case unicode.IsDigit(r):
+			digits++
+		case unicode.IsLetter(r):
+			letters++
+		}
+	}
+	switch {
+	case o > 0 && letters == 0 && digits+zeros >= 2:
+		return strings.NewReplacer("O", "0", "o", "0").Replace(word)
+	case zeros > 0 && digits == 0 && letters+o > 0:
+		return strings.ReplaceAll(word, "0", "O")
+	}
+	return word
+}
+
+func fixOCRChars(text string, glossary Glossary) string {
+	text = fixLoneLRegexp.ReplaceAllString(text, "${1}I${2}")
+	text = fixInnerIRegexp.ReplaceAllStringFunc(text, func(word string) string {
+		return fixInnerI(word, glossary)
+	})
+	text = fixWordRegexp.ReplaceAllStringFunc(text, fixUpperL)
+	return fixWordRegexp.ReplaceAllStringFunc(text, fixDigitsLetters)
+}
+
+var (
+	fixItalicTagRegexp   = regexp.MustCompile(`(?i)</?i>`)
+	fixItalicEmptyRegexp = regexp.MustCompile(`(?i)<i>(\s*)</i>`)
+	fixItalicJoinRegexp  = regexp.MustCompile(`(?i)</i>(\s*)<i>`)
+)
+
+func fixItalicTags(text string) string {
+	// Normalize case and remove empty/contiguous tags
+	text = fixItalicTagRegexp.ReplaceAllStringFunc(text, strings.ToLower)
+	text = fixItalicEmptyRegexp.ReplaceAllString(text, "$1")
+	text = fixItalicJoinRegexp.ReplaceAllString(text, "$1")
+	// Balance the tags
+	var (
+		depth          int
+		missingOpening bool
+		result         strings.Builder
+	)
+	last := 0
+	for _, loc := range fixItalicTagRegexp.FindAllStringIndex(text, -1) {
+		result.WriteString(text[last:loc[0]])
+		last = loc[1]
+		if text[loc[0]:loc[1]] == "<i>" {
+			if depth > 0 {
+				// nested opening tag, drop it
+				continue
+			}
+			depth++
+		} else {
+			if depth == 0 {
+				// closing tag without opening tag: the italic started with the text
+				missingOpening = true
+			} else {
+				depth--
+			}
+		}
+		result.WriteString(text[loc[0]:loc[1]])
+	}
+	result.WriteString(text[last:])
+	text = result.String()
+	if missingOpening {
+		text = "<i>" + text
+	}
+	if depth > 0 {
+		text += "</i>"
+	}
+	if missingOpening || depth > 0 {
+		// tags added, it may have created new empty/contiguous tags
+		text = fixItalicEmptyRegexp.ReplaceAllString(text, "$1")
+		text = fixItalicJoinRegexp.ReplaceAllString(text, "$1")
+	}
+	return text
+}
+
+// fixLineLength merges the lines of a cue if they fit on a single line and splits it in two balanced
+// lines if one of them is too long. Dialogues (lines starting with a dash) are never merged.
+func fixLineLength(text string, maxLength int) string {
+	if maxLength <= 0 {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for _, line := range lines {
+		if strings.HasPrefix(fixItalicTagRegexp.ReplaceAllString(line, ""), "-") {
+			return text
+		}
+	}
+	oneLine := strings.Join(lines, " ")
+	oneLineLength := visibleLength(oneLine)
+	if oneLineLength <= maxLength {
+		return oneLine
+	}
+	tooLong := false
+	for _, line := range lines {
+		if visibleLength(line) > maxLength {
+			tooLong = true
+			break
+		}
+	}
+	if !tooLong {
+		return text
+	}
+	// Split on the space closest to the middle
+	bestSplit, bestDiff := -1, oneLineLength
+	for i, r := range oneLine {
+		if r != ' ' {
+			continue
+		}
+		if diff := abs(oneLineLength - 2*visibleLength(oneLine[:i]) - 1); diff < bestDiff {
+			bestSplit, bestDiff = i, diff
+		}
+	}
+	if bestSplit == -1 {
+		return text
+	}
+	return oneLine[:bestSplit] + "\n" + oneLine[bestSplit+1:]
+}
+
+// visibleLength returns the number of characters of a text without its formatting tags
+func visibleLength(text string) int {
+	return utf8.RuneCountInString(fixItalicTagRegexp.ReplaceAllString(text, ""))
+}
+
+func fixMinGap(srtSubs SRTSubtitles, cfg FixConfig) (fixed int) {
+	return len(timingMinGap(srtSubs, cfg.MinGap, timingFloor(0)))
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFixOCRChars(t *testing.T) {
+	tests := []struct {
+		text     string
+		glossary Glossary
+		want     string
+	}{
+		{"heIlo, l'm here", nil, "hello, I'm here"},
+		{"McIntosh and MacInnes", nil, "McIntosh and MacInnes"},
+		{"the aIien", nil, "the alien"},
+		{"the hIroshi", Glossary{"Hiroshi"}, "the hIroshi"},
+		{"HE KILlED HIM", nil, "HE KILLED HIM"},
+		{"KlLLED, HELlO, WElL", nil, "KILLED, HELLO, WELL"},
+		{"lT", nil, "lT"},
+		{"1O0 people", nil, "100 people"},
+		{"C0ME, 0h", nil, "COME, Oh"},
+		{"O2 level, 3o, 2000s", nil, "O2 level, 3o, 2000s"},
+	}
+	for _, test := range tests {
+		if got := fixOCRChars(test.text, test.glossary); got != test.want {
+			t.Errorf("fixOCRChars(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestFixTextRules(t *testing.T) {
+	tests := []struct {
+		name string
+		fix  func(text string) string
+		text string
+		want string
+	}{
+		{"spaces", fixSpaces, "  Hello   there \n\n\tGeneral  Kenobi.  ", "Hello there\nGeneral Kenobi."},
+		{"spaces untouched", fixSpaces, "Hello there.\nGeneral Kenobi.", "Hello there.\nGeneral Kenobi."},
+		{"dashes", fixDashes, "—Hello.\n–  Hi.\n<i>-Bye.</i>", "- Hello.\n- Hi.\n<i>- Bye.</i>"},
+		{"dashes inner", fixDashes, "A well-known fact - really.", "A well-known fact - really."},
+		{"italic case", fixItalicTags, "<I>Hello.</I>", "<i>Hello.</i>"},
+		{"italic empty", fixItalicTags, "<i> </i>Hello.", " Hello."},
+		{"italic contiguous", fixItalicTags, "<i>Hello</i> <i>there.</i>", "<i>Hello there.</i>"},
+		{"italic missing closing", fixItalicTags, "<i>Hello.\nThere.", "<i>Hello.\nThere.</i>"},
+		{"italic missing opening", fixItalicTags, "Hello.</i>\nThere.", "<i>Hello.</i>\nThere."},
+		{"italic nested", fixItalicTags, "<i>Hello <i>there</i>.", "<i>Hello there</i>."},
+		{"linelength merge", func(text string) string { return fixLineLength(text, 42) }, "Hello\nthere.", "Hello there."},
+		{"linelength dialogue", func(text string) string { return fixLineLength(text, 42) }, "- Hello.\n- Hi.", "- Hello.\n- Hi."},
+		{"linelength split", func(text string) string { return fixLineLength(text, 20) }, "<i>This line is far too long to fit</i>", "<i>This line is far\ntoo long to fit</i>"},
+		{"linelength disabled", func(text string) string { return fixLineLength(text, 0) }, "Hello\nthere.", "Hello\nthere."},
+	}
+	for _, test := range tests {
+		if got := test.fix(test.text); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestApplyFixRules(t *testing.T) {
+	srtSubs := SRTSubtitles{
+		{Start: SRTTimestamp(time.Second), End: SRTTimestamp(3 * time.Second), Text: "—l'm  here."},
+		{Start: SRTTimestamp(3 * time.Second), End: SRTTimestamp(4 * time.Second), Text: "<i>Hello."},
+		{Start: SRTTimestamp(5 * time.Second), End: SRTTimestamp(6 * time.Second), Text: "Fine."},
+	}
+	rules, err := ParseFixRules("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := ApplyFixRules(srtSubs, rules, FixConfig{MaxLineLength: 42, MinGap: 100 * time.Millisecond})
+	// spaces, dashes, ocrchars, italic, linelength, gap
+	if want := []int{1, 1, 1, 1, 0, 1}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("got counts %v, want %v", counts, want)
+	}
+	texts := []string{srtSubs[0].Text, srtSubs[1].Text, srtSubs[2].Text}
+	if want := []string{"- I'm here.", "<i>Hello.</i>", "Fine."}; !reflect.DeepEqual(texts, want) {
+		t.Errorf("got texts %q, want %q", texts, want)
+	}
+	if srtSubs[0].End != SRTTimestamp(2900*time.Millisecond) {
+		t.Errorf("got end %v, want 00:00:02,900", srtSubs[0].End)
+	}
+	if _, err = ParseFixRules("spaces,unknown"); err == nil {
+		t.Error("an unknown rule must fail")
+	}
+}
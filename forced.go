@@ -0,0 +1,23 @@
+package main
+
+// ForcedImages returns the images flagged as forced (lines to display even with subtitles off, like
+// foreign language dialogues)
+func ForcedImages(imgSubs []ImageSubtitle) (forced []ImageSubtitle) {
+	for _, sub := range imgSubs {
+		if sub.Forced {
+			forced = append(forced, sub)
+		}
+	}
+	return
+}
+
+// ForcedSubtitles returns the cues coming from forced images
+func ForcedSubtitles(srtSubs SRTSubtitles) (forced SRTSubtitles) {
+	forced = make(SRTSubtitles, 0, len(srtSubs))
+	for _, sub := range srtSubs {
+		if sub.Forced {
+			forced = append(forced, sub)
+		}
+	}
+	return
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	GlossaryPolicyCorrect = "correct" // near-misses are replaced by the glossary entry
+	GlossaryPolicyFlag    = "flag"    // near-misses are only reported
+)
+
+var glossaryWordRegexp = regexp.MustCompile(`[\p{L}\p{N}'’-]+`)
+
+// Glossary is a list of names and terms (one or several words each) expected in the subtitles
+type Glossary []string
+
+// LoadGlossary reads a glossary file: one entry per line, empty lines and lines starting with # are ignored
+func LoadGlossary(path string) (glossary Glossary, err error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		err = fmt.Errorf("failed to open file: %w", err)
+		return
+	}
+	defer fd.Close()
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		glossary = append(glossary, strings.Join(strings.Fields(line), " "))
+	}
+	if err = scanner.Err(); err != nil {
+		err = fmt.Errorf("failed to read file: %w", err)
+		return
+	}
+	return
+}
+
+// GlossaryMatch is a near-miss of a glossary entry found in a subtitle
+type GlossaryMatch struct {
+	Index     int // subtitle index
+	Original  string
+	Entry     string
+	Distance  int
+	Corrected bool
+}
+
+// Apply searches the subtitles for near-misses of the glossary entries (small edit distance) and
+// replaces them if correct is true. Exact matches (case insensitive) are left untouched. Words also
+// written in lower case elsewhere in the subtitles are common words, not misspelled names: they are
+// never near-misses.
+func (glossary Glossary) Apply(srtSubs SRTSubtitles, correct bool) (matches []GlossaryMatch) {
+	// Longest entries (in words) first so "Satoru Gojo" wins over "Gojo"
+	entries := make([][]string, len(glossary))
+	for i, entry := range glossary {
+		entries[i] = strings.Fields(entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return len(entries[i]) > len(entries[j])
+	})
+	commonWords := make(map[string]bool)
+	for _, sub := range srtSubs {
+		for _, word := range glossaryWordRegexp.FindAllString(sub.Text, -1) {
+			if strings.ToLower(word) == word {
+				commonWords[word] = true
+			}
+		}
+	}
+	for index := range srtSubs {
+		lines := strings.Split(srtSubs[index].Text, "\n")
+		for lineIndex, line := range lines {
+			var lineMatches []GlossaryMatch
+			lines[lineIndex], lineMatches = glossaryApplyLine(line, entries, commonWords, correct)
+			for _, match := range lineMatches {
+				match.Index = index
+				matches = append(matches, match)
+			}
+		}
+		srtSubs[index].Text = strings.Join(lines, "\n")
+	}
+	return
+}
+
+func glossaryApplyLine(line string, entries [][]string, commonWords map[string]bool, correct bool) (result string, matches []GlossaryMatch) {
+	words := glossaryWordRegexp.FindAllStringIndex(line, -1)
+	type replacement struct {
+		start, end int
+		value      string
+	}
+	var replacements []replacement
+	used := make([]bool, len(words))
+	for _, entry := range entries {
+		for first := 0; first+len(entry) <= len(words); first++ {
+			last := first + len(entry) - 1
+			// Words must be available and only separated by spaces
+			available := true
+			for i := first; i <= last; i++ {
+				if used[i] || (i > first && strings.TrimSpace(line[words[i-1][1]:words[i][0]]) != "") {
+					available = false
+					break
+				}
+			}
+			if !available {
+				continue
+			}
+			original := line[words[first][0]:words[last][1]]
+			candidate := strings.Join(entry, " ")
+			distance, ok, sure := glossaryNearMiss(original, candidate)
+			if !ok {
+				continue
+			}
+			if distance > 0 {
+				common := true
+				for i := first; i <= last; i++ {
+					common = common && commonWords[strings.ToLower(line[words[i][0]:words[i][1]])]
+				}
+				if common {
+					// eg. "Make" at the start of a line is not a misspelled "Maki"
+					continue
+				}
+			}
+			for i := first; i <= last; i++ {
+				used[i] = true
+			}
+			if distance == 0 {
+				// exact match, nothing to report
+				continue
+			}
+			matches = append(matches, GlossaryMatch{
+				Original:  original,
+				Entry:     candidate,
+				Distance:  distance,
+				Corrected: correct && sure,
+			})
+			if correct && sure {
+				replacements = append(replacements, replacement{
+					start: words[first][0],
+					end:   words[last][1],
+					value: glossaryMatchCase(original, candidate),
+				})
+			}
+		}
+	}
+	// Apply replacements from the end to keep the offsets valid
+	sort.Slice(replacements, func(i, j int) bool {
+		return replacements[i].start > replacements[j].start
+	})
+	result = line
+	for _, r := range replacements {
+		result = result[:r.start] + r.value + result[r.end:]
+	}
+	return
+}
+
+// glossaryNearMiss returns the edit distance between a text and a glossary entry if it is small enough
+// to be considered a misspelling of the entry: 1 edit up to 7 characters, 2 above. Entries shorter than 6
+// characters are too close to common words ("Maki" and "Make"): their near-misses are not sure and must
+// only be reported. They require a capitalized entry (a name) of at least 4 characters, the other short
+// entries only match exactly.
+func glossaryNearMiss(original, entry string) (distance int, ok, sure bool) {
+	if strings.EqualFold(original, entry) {
+		return 0, true, true
+	}
+	entryLen := utf8.RuneCountInString(entry)
+	entryFirst, _ := utf8.DecodeRuneInString(entry)
+	var maxDistance int
+	switch {
+	case entryLen < 4 || (entryLen < 6 && !unicode.IsUpper(entryFirst)):
+		return
+	case entryLen < 8:
+		maxDistance = 1
+	default:
+		maxDistance = 2
+	}
+	// Capitalized entries (names) only match capitalized words
+	originalFirst, _ := utf8.DecodeRuneInString(original)
+	if unicode.IsUpper(entryFirst) && !unicode.IsUpper(originalFirst) {
+		return
+	}
+	distance = levenshtein([]rune(strings.ToLower(original)), []rune(strings.ToLower(entry)))
+	ok = distance <= maxDistance
+	sure = entryLen >= 6
+	return
+}
+
+// glossaryMatchCase keeps the upper case style of the original text
+func glossaryMatchCase(original, entry string) string {
+	if strings.ToUpper(original) == original && strings.ToLower(original) != original {
+		return strings.ToUpper(entry)
+	}
+	return entry
+}
+
+func printGlossaryMatches(srtSubs SRTSubtitles, matches []GlossaryMatch) {
+	if len(matches) == 0 {
+		fmt.Println("Glossary: no near-miss found")
+		return
+	}
+	var corrected int
+	for _, match := range matches {
+		if match.Corrected {
+			corrected++
+		}
+	}
+	fmt.Printf("Glossary: %d correction(s), %d near-miss(es) flagged (not corrected):\n", corrected, len(matches)-corrected)
+	for _, match := range matches {
+		action := "flagged"
+		if match.Corrected {
+			action = "corrected"
+		}
+		fmt.Printf("\t#%d %s --> %s: %q -> %q (distance %d, %s)\n",
+			match.Index+1, srtSubs[match.Index].Start, srtSubs[match.Index].End,
+			match.Original, match.Entry, match.Distance, action,
+		)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestGlossaryApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		glossary Glossary
+		text     string
+		want     string
+	}{
+		{"near miss", Glossary{"Megumi Fushiguro"}, "Megumi Fushiguru, wait!", "Megumi Fushiguro, wait!"},
+		{"short name near miss is not corrected", Glossary{"Maki"}, "Make it quick.", "Make it quick."},
+		{"short lower case entry only matches exactly", Glossary{"baka"}, "Back off, baku.", "Back off, baku."},
+		{"upper case kept", Glossary{"Sukuna"}, "SUKUNE!", "SUKUNA!"},
+		{"common word", Glossary{"Hollow"}, "Follow me.\nI follow you.", "Follow me.\nI follow you."},
+		{"name near miss", Glossary{"Nanami"}, "Nanamo is here.", "Nanami is here."},
+		{"lower case word does not match a name", Glossary{"Nobara"}, "the nobora", "the nobora"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			subs := SRTSubtitles{{Text: test.text}}
+			test.glossary.Apply(subs, true)
+			if subs[0].Text != test.want {
+				t.Errorf("got %q, want %q", subs[0].Text, test.want)
+			}
+		})
+	}
+}
+
+func TestGlossaryShortNames(t *testing.T) {
+	subs := SRTSubtitles{{Text: "Gojou is here."}, {Text: "GOJO!"}}
+	for _, correct := range []bool{true, false} {
+		matches := Glossary{"Gojo"}.Apply(subs, correct)
+		if len(matches) != 1 || matches[0].Original != "Gojou" || matches[0].Entry != "Gojo" || matches[0].Distance != 1 || matches[0].Corrected {
+			t.Errorf("correct %v: got matches %+v, want a single flagged Gojou", correct, matches)
+		}
+		if subs[0].Text != "Gojou is here." {
+			t.Errorf("correct %v: got %q, the short name near miss must not be corrected", correct, subs[0].Text)
+		}
+	}
+	if matches := (Glossary{"Ao"}).Apply(SRTSubtitles{{Text: "Aoi!"}}, true); len(matches) != 0 {
+		t.Errorf("got matches %+v for an entry shorter than 4 characters", matches)
+	}
+}
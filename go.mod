@@ -7,7 +7,6 @@ go 1.24.2
 require (
 	github.com/hekmon/go-vobsub v1.0.1
 	github.com/hekmon/liveprogress/v2 v2.2.1
-	github.com/mbiamont/go-pgs-parser v1.0.0
 	github.com/openai/openai-go/v3 v3.22.0
 	golang.org/x/sync v0.19.0
 	golang.org/x/text v0.34.0
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const inputHeaderSize = 64 << 10 // enough for the ISO 9660 volume descriptor
+
+// InputOptions are the parsing options of the formats supporting them
+type InputOptions struct {
+	DVDTitle int
+	Debug    bool
+}
+
+// InputFormat is a parser of image subtitles. Detect is called with the first bytes of the input (nil for
+// folders) and must not rely on the file extension.
+type InputFormat struct {
+	Name   string
+	Detect func(inputPath string, header []byte) bool
+	Parse  func(inputPath string, options InputOptions) (streams map[int]SubtitleStream, err error)
+}
+
+// inputFormats is the registry of the input parsers, detections are tried in order
+var inputFormats = []InputFormat{
+	{
+		Name: "PGS",
+		Detect: func(_ string, header []byte) bool {
+			return bytes.HasPrefix(header, []byte("PG"))
+		},
+		Parse: func(inputPath string, options InputOptions) (streams map[int]SubtitleStream, err error) {
+			imgSubs, err := ParsePGSFile(inputPath, options.Debug)
+			streams = map[int]SubtitleStream{
+				0: {ID: 0, Subtitles: imgSubs},
+			}
+			return
+		},
+	},
+	{
+		Name: "VobSub",
+		Detect: func(inputPath string, header []byte) bool {
+			_, found := vobSubIdxPath(inputPath)
+			return bytes.HasPrefix(header, []byte{0x00, 0x00, 0x01, 0xba}) && found
+		},
+		Parse: withoutOptions(ParseVobSubFile),
+	},
+	{
+		Name: "DVD",
+		Detect: func(inputPath string, header []byte) bool {
+			if header == nil {
+				_, found := dvdVideoTSFolder(inputPath)
+				return found
+			}
+			// UDF only images are detected too so their parsing error tells they are not supported
+			return len(header) >= isoPrimaryVolumeSector*isoSectorSize+6 &&
+				slices.Contains([]string{isoStandardIdentifier, udfBeginningIdentifier},
+					string(header[isoPrimaryVolumeSector*isoSectorSize+1:isoPrimaryVolumeSector*isoSectorSize+6]))
+		},
+		Parse: func(inputPath string, options InputOptions) (map[int]SubtitleStream, error) {
+			return ParseDVD(inputPath, options.DVDTitle)
+		},
+	},
+	{
+		Name: "BDMV",
+		Detect: func(inputPath string, header []byte) bool {
+			if header != nil {
+				return false
+			}
+			for _, playlistPath := range []string{filepath.Join(inputPath, "PLAYLIST"), filepath.Join(inputPath, "BDMV", "PLAYLIST")} {
+				if info, err := os.Stat(playlistPath); err == nil && info.IsDir() {
+					return true
+				}
+			}
+			return false
+		},
+		Parse: func(inputPath string, options InputOptions) (map[int]SubtitleStream, error) {
+			return ParseBDMVFolder(inputPath, options.Debug)
+		},
+	},
+	{
+		Name: "M2TS",
+		Detect: func(_ string, header []byte) bool {
+			return transportStreamSynchronized(header, m2tsPacketSize)
+		},
+		Parse: func(inputPath string, options InputOptions) (map[int]SubtitleStream, error) {
+			return ParseM2TSFile(inputPath, options.Debug)
+		},
+	},
+	{
+		Name: "DVB",
+		Detect: func(_ string, header []byte) bool {
+			return transportStreamSynchronized(header, tsPacketSize)
+		},
+		Parse: withoutOptions(ParseDVBFile),
+	},
+	{
+		Name: "AVI (XSUB)",
+		Detect: func(_ string, header []byte) bool {
+			return len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "AVI "
+		},
+		Parse: withoutOptions(ParseAVIFile),
+	},
+	{
+		Name: "Matroska (XSUB)",
+		Detect: func(_ string, header []byte) bool {
+			return bytes.HasPrefix(header, []byte{0x1a, 0x45, 0xdf, 0xa3})
+		},
+		Parse: withoutOptions(ParseMatroskaFile),
+	},
+	{
+		Name: "BDN XML",
+		Detect: func(_ string, header []byte) bool {
+			header = bytes.TrimLeft(bytes.TrimPrefix(header, []byte("\xef\xbb\xbf")), " \t\r\n")
+			return bytes.HasPrefix(header, []byte("<")) && bytes.Contains(header, []byte("<BDN"))
+		},
+		Parse: withoutOptions(ParseBDNFile),
+	},
+}
+
+func withoutOptions(parse func(inputPath string) (map[int]SubtitleStream, error)) func(string, InputOptions) (map[int]SubtitleStream, error) {
+	return func(inputPath string, _ InputOptions) (map[int]SubtitleStream, error) {
+		return parse(inputPath)
+	}
+}
+
+// DetectInputFormat returns the parser of a file or a folder from its content
+func DetectInputFormat(inputPath string) (format InputFormat, err error) {
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		return
+	}
+	var header []byte
+	if !info.IsDir() {
+		var fd *os.File
+		if fd, err = os.Open(inputPath); err != nil {
+			return
+		}
+		defer fd.Close()
+		header = make([]byte, inputHeaderSize)
+		var read int
+		if read, err = io.ReadFull(fd, header); err != nil && err != io.ErrUnexpectedEOF {
+			err = fmt.Errorf("failed to read the input: %w", err)
+			return
+		}
+		header, err = header[:read], nil
+	}
+	for _, format = range inputFormats {
+		if format.Detect(inputPath, header) {
+			return
+		}
+	}
+	names := make([]string, len(inputFormats))
+	for index, format := range inputFormats {
+		names[index] = format.Name
+	}
+	return InputFormat{}, errors.New("unrecognized input format, supported formats: " + strings.Join(names, ", "))
+}
+
+// transportStreamSynchronized returns true if the first packets of the header start with the sync byte
+func transportStreamSynchronized(header []byte, packetSize int) bool {
+	if len(header) < packetSize {
+		return false
+	}
+	offset := packetSize - tsPacketSize
+	for packet := 0; packet < 4 && offset+packet*packetSize < len(header); packet++ {
+		if header[offset+packet*packetSize] != tsSyncByte {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	isoSectorSize             = 2048
+	isoPrimaryVolumeSector    = 16
+	isoRootDirectoryRecord    = 156
+	isoDirectoryRecordMinSize = 33
+	isoDirectoryFlag          = 0x02
+	isoStandardIdentifier     = "CD001"
+	udfBeginningIdentifier    = "BEA01" // first descriptor of the UDF volume recognition sequence
+)
+
+// isoFS exposes the files of a directory of an ISO 9660 image. DVD-Video discs use the UDF bridge format:
+// their files are also declared in the ISO 9660 file system. UDF only images (without the ISO 9660 file
+// system) are not supported.
+type isoFS struct {
+	image *os.File
+	files map[string]isoFileInfo
+}
+
+type isoFileInfo struct {
+	name   string
+	sector int64
+	size   int64
+}
+
+func (info isoFileInfo) Name() string       { return info.name }
+func (info isoFileInfo) Size() int64        { return info.size }
+func (info isoFileInfo) Mode() fs.FileMode  { return 0o444 }
+func (info isoFileInfo) ModTime() time.Time { return time.Time{} }
+func (info isoFileInfo) IsDir() bool        { return false }
+func (info isoFileInfo) Sys() any           { return nil }
+
+// isoFile is an opened file of the image, it supports random access
+type isoFile struct {
+	*io.SectionReader
+	info isoFileInfo
+}
+
+func (file *isoFile) Stat() (fs.FileInfo, error) { return file.info, nil }
+func (file *isoFile) Close() error               { return nil }
+
+// openISODirectory reads the files of a root directory of an ISO 9660 image (eg. VIDEO_TS)
+func openISODirectory(image *os.File, directory string) (isoFileSystem *isoFS, err error) {
+	volume := make([]byte, isoSectorSize)
+	if _, err = image.ReadAt(volume, isoPrimaryVolumeSector*isoSectorSize); err != nil {
+		err = fmt.Errorf("failed to read the volume descriptor: %w", err)
+		return
+	}
+	if string(volume[1:6]) == udfBeginningIdentifier {
+		return nil, errors.New("UDF only image: not supported, only the UDF bridge format (UDF and ISO 9660) is, use the VIDEO_TS folder of the image instead")
+	}
+	if volume[0] != 1 || string(volume[1:6]) != isoStandardIdentifier {
+		return nil, errors.New("no ISO 9660 primary volume descriptor")
+	}
+	root, err := readISODirectory(image, volume[isoRootDirectoryRecord:isoRootDirectoryRecord+34])
+	if err != nil {
+		err = fmt.Errorf("failed to read the root directory: %w", err)
+		return
+	}
+	record, found := root[strings.ToUpper(directory)]
+	if !found {
+		return nil, fmt.Errorf("no %s directory in the image", directory)
+	}
+	entries, err := readISODirectory(image, record)
+	if err != nil {
+		err = fmt.Errorf("failed to read the %s directory: %w", directory, err)
+		return
+	}
+	isoFileSystem = &isoFS{
+		image: image,
+		files: make(map[string]isoFileInfo, len(entries)),
+	}
+	for name, record := range entries {
+		if record[25]&isoDirectoryFlag != 0 {
+			continue
+		}
+		isoFileSystem.files[name] = isoFileInfo{
+			name:   name,
+			sector: int64(binary.LittleEndian.Uint32(record[2:6])),
+			size:   int64(binary.LittleEndian.Uint32(record[10:14])),
+		}
+	}
+	return
+}
+
+// readISODirectory returns the records of the entries of a directory by name (without version)
+func readISODirectory(image *os.File, record []byte) (entries map[string][]byte, err error) {
+	data := make([]byte, binary.LittleEndian.Uint32(record[10:14]))
+	if _, err = image.ReadAt(data, int64(binary.LittleEndian.Uint32(record[2:6]))*isoSectorSize); err != nil {
+		return
+	}
+	entries = make(map[string][]byte)
+	for offset := 0; offset < len(data); {
+		length := int(data[offset])
+		if length == 0 {
+			// records do not cross sectors: continue with the next one
+			offset = (offset/isoSectorSize + 1) * isoSectorSize
+			continue
+		}
+		if length < isoDirectoryRecordMinSize || offset+length > len(data) || offset+33+int(data[offset+32]) > len(data) {
+			return nil, errors.New("invalid directory record")
+		}
+		entry := data[offset : offset+length]
+		name := string(entry[33 : 33+int(entry[32])])
+		if name != "\x00" && name != "\x01" {
+			// self and parent records are skipped
+			name, _, _ = strings.Cut(name, ";")
+			entries[strings.ToUpper(strings.TrimSuffix(name, "."))] = entry
+		}
+		offset += length
+	}
+	return
+}
+
+// Open implements fs.FS
+func (isoFileSystem *isoFS) Open(name string) (fs.File, error) {
+	info, found := isoFileSystem.files[strings.ToUpper(name)]
+	if !found {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &isoFile{
+		SectionReader: io.NewSectionReader(isoFileSystem.image, info.sector*isoSectorSize, info.size),
+		info:          info,
+	}, nil
+}
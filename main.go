@@ -28,14 +28,51 @@ const (
 
 func main() {
 	// Define flags
-	inputPath := flag.String("input", "", "Image subtitles file to decode (.sup for Bluray PGS and .sub -.idx must also be present- for DVD VobSub)")
-	outputPath := flag.String("output", "", "Output subtitle to create (.srt subtitle). Default will use same folder and same filename as input but with .srt extension")
+	inputPath := flag.String("input", "", "Image subtitles file or folder to decode, its format is detected from its content: Bluray PGS (.sup), DVD VobSub (.sub, the .idx must also be present), DVB subtitles from TV recordings (.ts), Bluray transport stream (.m2ts) or BDMV folder (the longest playlist is decoded, multi-angle and seamless branching playlists are not supported), DVD VIDEO_TS folder or .iso image (UDF bridge format, UDF only images are not supported: use their VIDEO_TS folder), BDN XML index and its PNG images, XSUB DivX subtitles from .avi or .mkv files")
+	outputPath := flag.String("output", "", "Output subtitle to create (.srt subtitle). Default will use same folder and same filename as input but with .srt extension. The stream language and forced flag are added to the name when known (file.<lang>[.forced].srt).")
 	baseURL := flag.String("baseurl", OAI_BASEURL, "OpenAI API base URL")
 	model := flag.String("model", "gpt-5-nano-2025-08-07", "AI model to use for OCR. Must be a Vision Language Model.")
+	ensemble := flag.String("ensemble", "", "Comma separated list of additional models to query for each image (ensemble mode). The majority answer is kept and disagreements are listed for human review. Not compatible with batch mode.")
 	italic := flag.Bool("italic", false, "Instruct the model to detect italic text. So far no models managed to detect it properly.")
 	nbWorkers := flag.Int("workers", 1, "Number of parallel workers. Does nothing with batch mode.")
 	batchMode := flag.Bool("batch", false, "OpenAI batch mode. Longer (up to 24h) but cheaper (-50%). The progress bar won't help you much: it will be ready when it will be ready! You should validate a few samples in regular mode first.")
+	promptFile := flag.String("prompt-file", "", "Custom system prompt file (Go text/template). Available variables: .Language, .LanguageName, .TrackTitle, .Glossary and the \"language\" template from the selected prompt pack.")
+	italicPromptFile := flag.String("italic-prompt-file", "", "Custom italic prompt file (Go text/template, same variables as -prompt-file).")
+	languageCode := flag.String("language", "", fmt.Sprintf("Language of the subtitles (eg. fr). Given to the model and selects the bundled prompt pack if any (available: %s).", strings.Join(PromptPacks(), ", ")))
+	trackTitle := flag.String("track-title", "", "Title of the video or track, given to the model as context.")
+	glossaryFile := flag.String("glossary", "", "Glossary file of names and terms (one per line). Entries are given to the model and near-misses in its answers are corrected or flagged (see -glossary-policy).")
+	glossaryPolicy := flag.String("glossary-policy", GlossaryPolicyCorrect, fmt.Sprintf("What to do with glossary near-misses: %q replaces them with the glossary entry (the near-misses of names shorter than 6 characters are only reported, being too close to common words), %q only reports them.", GlossaryPolicyCorrect, GlossaryPolicyFlag))
+	fix := flag.String("fix", "", fmt.Sprintf("Comma separated list of \"fix common errors\" rules to apply once the OCR is done, or \"all\" (available: %s).", strings.Join(FixRulesNames(), ", ")))
+	maxLineLength := flag.Int("max-line-length", 42, "Maximum number of characters per line used by the \"linelength\" fix rule.")
+	minGap := flag.Duration("min-gap", 84*time.Millisecond, "Minimum gap between two cues used by the \"gap\" fix rule and the timing pass.")
+	timing := flag.Bool("timing", false, "Apply the timing pass once the OCR is done and the SDH annotations removed: snap to -fps if set, then fix overlaps, enforce the min/max durations and the min gap between cues. Every adjustment is printed in debug mode.")
+	minDuration := flag.Duration("min-duration", time.Second, "Minimum display duration of a cue for the timing pass.")
+	charsPerSecond := flag.Float64("cps", 17, "Reading speed (characters per second) used by the timing pass to extend the cues too short to be read. 0 to disable.")
+	maxDuration := flag.Duration("max-duration", 7*time.Second, "Maximum display duration of a cue for the timing pass. 0 to disable.")
+	frameRate := flag.Float64("fps", 0, "Frame rate used by the timing pass to snap the timestamps to the video frames (eg. 23.976). 0 to disable.")
+	pgsObjects := flag.String("pgs-objects", RegionsCombine, fmt.Sprintf("Images displayed at the same time (PGS composition objects, DVB regions or BDN graphics, eg. a sign at the top and the dialogue at the bottom) are OCRed separately, then: %q joins their text in a single cue in screen order, %q writes them as separate cues (the ones in the top half of the screen get a {\\an8} tag).", RegionsCombine, RegionsSplit))
+	streamLanguages := flag.String("streams", "", "Comma separated list of the languages of the streams to OCR (eg. fr,en), as declared in the VobSub .idx file or the DVB subtitling descriptors (2 or 3 letters codes are both accepted). Default is all streams.")
+	dvdTitle := flag.Int("title", 0, "DVD title to OCR (VIDEO_TS folder or .iso input), the titles are listed while parsing. 0 selects the longest one.")
+	streamIDs := flag.String("stream", "", "Comma separated list of the IDs of the streams to OCR (eg. 2), the PID for DVB subtitles and Bluray transport streams. Default is all streams.")
+	forcedOnly := flag.Bool("forced-only", false, "Only OCR and output the forced subtitles (PGS composition objects flagged as forced, usually the foreign language lines).")
+	forcedFile := flag.Bool("forced-file", false, "Also write the forced subtitles to a second output next to the full one (.forced.srt extension), from the same OCR pass.")
+	merge := flag.Bool("merge", false, "Merge the consecutive cues having the same text and touching or overlapping timestamps (one subtitle split in several display sets) before any other post processing. Merged cues are listed in debug mode.")
+	mergeGap := flag.Duration("merge-gap", 0, "Maximum gap between two cues with the same text for -merge to still combine them.")
+	typography := flag.String("typography", "", fmt.Sprintf("Apply the typography rules of a language once the OCR is done (available: %s).", strings.Join(TypographyLanguages(), ", ")))
+	sdh := flag.String("sdh", SDHKeep, fmt.Sprintf("Hearing impaired annotations ([DOOR SLAMS], (sighs), JOHN:) handling: %q keeps them, %q removes them (cues left empty are dropped), %q removes them and also writes a second .sdh.srt output keeping them, %q removes them and also writes a second .sdh.vtt (WebVTT) output keeping them in a styled layer (the \"sdh\" cue class, yellow italic by default).", SDHKeep, SDHStrip, SDHBoth, SDHLayer))
+	empty := flag.String("empty", EmptyKeep, fmt.Sprintf("Empty cues (blank images or no text found by the model) handling: %q writes them as is, %q removes them, %q replaces their text by -empty-placeholder. Empty cues are always listed.", EmptyKeep, EmptyDrop, EmptyPlaceholder))
+	emptyPlaceholder := flag.String("empty-placeholder", "[...]", "Text of the empty cues when -empty is \""+EmptyPlaceholder+"\".")
+	contextSize := flag.Int("context", 0, "Number of previous subtitles to send to the model as reference context (helps keeping names consistent). Enables a second OCR pass: doubles the cost. Not compatible with batch mode.")
+	logprobs := flag.Bool("logprobs", false, "Request the tokens log probabilities to compute a confidence score for each cue, the lowest probability of its tokens (backend must support it), and list the lowest confidence cues at the end.")
+	lowConfidence := flag.Int("low-confidence", 20, "Number of lowest confidence cues to list at the end when -logprobs is used.")
+	confidenceFile := flag.Bool("confidence-file", false, "Also write the lowest confidence cues to a sidecar file next to the output (.confidence.txt extension). Requires -logprobs.")
 	timeout := flag.Duration("timeout", 10*time.Minute, "Timeout for the OpenAI API requests")
+	only := flag.String("only", "", "Only OCR again the given cues of the existing output and patch them into it, the other cues (and their manual edits) are kept as is. Comma separated list of cue numbers (12), ranges (45-50) or time ranges (00:10:00-00:12:00). Useful with another -model or -prompt-file.")
+	review := flag.Bool("review", false, "Review the cues in the terminal once the OCR is done: each cue is displayed with its image and can be accepted, edited or OCRed again with another model. The cues are reviewed before the SDH annotations removal, the timing pass and the empty cues policy: every output is derived again and saved after each change.")
+	reviewGraphics := flag.String("review-graphics", GraphicsAuto, fmt.Sprintf("How -review displays the images: %q, %q, %q or %q (detected from the terminal environment).", GraphicsKitty, GraphicsSixel, GraphicsASCII, GraphicsAuto))
+	reportPath := flag.String("report", "", "Also write a self-contained HTML review report (eg. report.html) listing each cue with its image, text, timestamps, tokens used and retries. Suspicious cues (empty, retried, ensemble disagreement, low confidence) are flagged and can be displayed alone.")
+	exportFolder := flag.String("export-images", "", "Export the decoded images of the selected streams to this folder (numbered PNG files, exactly as sent to the model, and a manifest.json of their timestamps, sizes and positions) then exit without OCR. Useful to tell decoding issues from OCR ones.")
+	exportRequests := flag.Bool("export-requests", false, "Also export the body of the OCR request of each image (.request.json, with the base64 encoded image as sent to the main model). Requires -export-images.")
 	debug := flag.Bool("debug", false, "Print each entry to stdout during the process")
 	version := flag.Bool("version", false, "show program version")
 	flag.Parse()
@@ -49,13 +86,32 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Please set the -input flag\n\n")
 		flag.Usage()
 		return
-	} else if !strings.HasSuffix(*inputPath, ".sup") && !strings.HasSuffix(*inputPath, ".sub") {
-		fmt.Fprintf(os.Stderr, "The input file must be a .sup (Bluray PGS) or .sub (DVD VobSub) file\n")
+	}
+	inputFormat, err := DetectInputFormat(*inputPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid input: %s\n", err)
+		return
+	}
+	inputInfo, err := os.Stat(*inputPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read the input: %s\n", err)
+		return
+	}
+	inputFolder := inputInfo.IsDir()
+	if *dvdTitle < 0 {
+		fmt.Fprintf(os.Stderr, "The -title flag can not be negative.\n")
 		return
 	}
-	if *outputPath == "" {
+	if *outputPath == "" && inputFolder {
+		// named after the disc folder
+		discPath := filepath.Clean(*inputPath)
+		if strings.EqualFold(filepath.Base(discPath), "BDMV") || strings.EqualFold(filepath.Base(discPath), "VIDEO_TS") {
+			discPath = filepath.Dir(discPath)
+		}
+		*outputPath = discPath + ".srt"
+	} else if *outputPath == "" {
 		*outputPath = filepath.Join(filepath.Dir(*inputPath), strings.TrimSuffix(filepath.Base(*inputPath), filepath.Ext(*inputPath))+".srt")
-	} else if !strings.HasSuffix(*outputPath, ".srt") {
+	} else if !strings.EqualFold(filepath.Ext(*outputPath), ".srt") {
 		fmt.Fprintf(os.Stderr, "The output file must be a .srt file\n")
 		return
 	}
@@ -63,11 +119,108 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Batch mode is not supported for custom base URLs.\n")
 		return
 	}
-	var err error
+	models := []string{*model}
+	for _, ensembleModel := range strings.Split(*ensemble, ",") {
+		if ensembleModel = strings.TrimSpace(ensembleModel); ensembleModel != "" {
+			models = append(models, ensembleModel)
+		}
+	}
+	if len(models) > 1 && *batchMode {
+		fmt.Fprintf(os.Stderr, "Ensemble mode is not supported with batch mode.\n")
+		return
+	}
+	var onlySelection CueSelection
+	if *only != "" {
+		if onlySelection, err = ParseCueSelection(*only); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -only value: %s\n", err)
+			return
+		}
+		if *batchMode {
+			fmt.Fprintf(os.Stderr, "-only is not supported with batch mode.\n")
+			return
+		}
+	}
+	if *contextSize < 0 {
+		fmt.Fprintf(os.Stderr, "The -context flag can not be negative.\n")
+		return
+	} else if *contextSize > 0 && *batchMode {
+		fmt.Fprintf(os.Stderr, "Context mode is not supported with batch mode.\n")
+		return
+	}
 	if _, err := url.Parse(*baseURL); err != nil {
 		fmt.Fprintf(os.Stderr, "Invalid URL for -baseURL flag: %s\n", err.Error())
 		return
 	}
+	if *glossaryPolicy != GlossaryPolicyCorrect && *glossaryPolicy != GlossaryPolicyFlag {
+		fmt.Fprintf(os.Stderr, "Invalid -glossary-policy value %q: must be %q or %q\n", *glossaryPolicy, GlossaryPolicyCorrect, GlossaryPolicyFlag)
+		return
+	}
+	var glossary Glossary
+	if *glossaryFile != "" {
+		if glossary, err = LoadGlossary(*glossaryFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load the glossary: %s\n", err)
+			return
+		}
+	}
+	fixRules, err := ParseFixRules(*fix)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -fix value: %s\n", err)
+		return
+	}
+	if _, found := TypographyRules[strings.ToLower(*typography)]; *typography != "" && !found {
+		fmt.Fprintf(os.Stderr, "Unsupported -typography language %q (available: %s)\n", *typography, strings.Join(TypographyLanguages(), ", "))
+		return
+	}
+	switch *sdh {
+	case SDHKeep, SDHStrip, SDHBoth, SDHLayer:
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid -sdh value %q: must be %q, %q, %q or %q\n", *sdh, SDHKeep, SDHStrip, SDHBoth, SDHLayer)
+		return
+	}
+	switch *pgsObjects {
+	case RegionsCombine, RegionsSplit:
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid -pgs-objects value %q: must be %q or %q\n", *pgsObjects, RegionsCombine, RegionsSplit)
+		return
+	}
+	if *forcedOnly && *forcedFile {
+		fmt.Fprintln(os.Stderr, "-forced-only and -forced-file are mutually exclusive")
+		return
+	}
+	switch *reviewGraphics {
+	case GraphicsKitty, GraphicsSixel, GraphicsASCII:
+	case GraphicsAuto:
+		*reviewGraphics = DetectTerminalGraphics()
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid -review-graphics value %q: must be %q, %q, %q or %q\n", *reviewGraphics, GraphicsKitty, GraphicsSixel, GraphicsASCII, GraphicsAuto)
+		return
+	}
+	if *confidenceFile && !*logprobs {
+		fmt.Fprintln(os.Stderr, "-confidence-file requires -logprobs")
+		return
+	}
+	if ext := strings.ToLower(filepath.Ext(*reportPath)); *reportPath != "" && ext != ".html" && ext != ".htm" {
+		fmt.Fprintf(os.Stderr, "The report file must be a .html file\n")
+		return
+	}
+	if *exportRequests && *exportFolder == "" {
+		fmt.Fprintln(os.Stderr, "-export-requests requires -export-images")
+		return
+	}
+	switch *empty {
+	case EmptyKeep, EmptyDrop, EmptyPlaceholder:
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid -empty value %q: must be %q, %q or %q\n", *empty, EmptyKeep, EmptyDrop, EmptyPlaceholder)
+		return
+	}
+	prompts, err := LoadPrompts(*promptFile, *italicPromptFile, NewPromptData(*languageCode, *trackTitle, glossary))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load the prompts: %s\n", err)
+		return
+	}
+	if *debug {
+		fmt.Printf("System prompt:\n%s\n\n", prompts.System)
+	}
 	if _, found := os.LookupEnv(APIKEY_ENV); !found {
 		fmt.Printf("Environment variable %q not set: OpenAI API client won't be using an API key\n", APIKEY_ENV)
 	}
@@ -77,61 +230,100 @@ func main() {
 		option.WithRequestTimeout(*timeout),
 		option.WithBaseURL(*baseURL),
 	)
+	ocrConfig := OCRConfig{
+		Client:   oaiClient,
+		Models:   models,
+		Italic:   *italic,
+		Logprobs: *logprobs,
+		Context:  *contextSize,
+		Prompts:  prompts,
+		Debug:    *debug,
+	}
+	outputCfg := outputConfig{
+		PGSObjects:     *pgsObjects,
+		ForcedFile:     *forcedFile,
+		Merge:          *merge,
+		MergeGap:       *mergeGap,
+		Glossary:       glossary,
+		GlossaryPolicy: *glossaryPolicy,
+		FixRules:       fixRules,
+		Fix: FixConfig{
+			MaxLineLength: *maxLineLength,
+			MinGap:        *minGap,
+			Glossary:      glossary,
+		},
+		Typography: *typography,
+		Timing:     *timing,
+		TimingConfig: TimingConfig{
+			MinDuration:    *minDuration,
+			CharsPerSecond: *charsPerSecond,
+			MaxDuration:    *maxDuration,
+			MinGap:         *minGap,
+			FrameRate:      *frameRate,
+		},
+		SDH:            *sdh,
+		Empty:          *empty,
+		EmptyText:      *emptyPlaceholder,
+		LowConfidence:  *lowConfidence,
+		ConfidenceFile: *confidenceFile,
+		Review:         *review,
+		ReviewGraphics: *reviewGraphics,
+		Debug:          *debug,
+	}
 
 	// Step 1 - Parse subtitle file
-	var subs map[int][]ImageSubtitle
-	if strings.HasSuffix(*inputPath, ".sup") {
-		fmt.Printf("Parsing PGS file %q\n", filepath.Base(*inputPath))
-		imgSubs, err := ParsePGSFile(*inputPath)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to parse PGS file: %s\n", err)
-			return
-		}
-		if *debug {
-			for _, sub := range imgSubs {
-				fmt.Printf("Start: %v, End: %v, Size: %d×%v\n",
-					sub.StartTime, sub.EndTime, sub.Image.Bounds().Dx(), sub.Image.Bounds().Dy(),
+	var streams map[int]SubtitleStream
+	fmt.Printf("Parsing %s input %q\n", inputFormat.Name, filepath.Base(*inputPath))
+	if streams, err = inputFormat.Parse(*inputPath, InputOptions{DVDTitle: *dvdTitle, Debug: *debug}); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse %s input: %s\n", inputFormat.Name, err)
+		return
+	}
+	var (
+		streamsInfo string
+		totalSubs   int
+	)
+	for _, stream := range streams {
+		totalSubs += len(stream.Subtitles)
+	}
+	if len(streams) > 1 {
+		streamsInfo = fmt.Sprintf(" (over %d streams: %s)", len(streams), describeStreams(streams))
+	}
+	fmt.Printf("%s input parsed. Total subs: %d%s\n", inputFormat.Name, totalSubs, streamsInfo)
+	if totalSubs == 0 {
+		return
+	}
+	if streams, err = SelectStreams(streams, *streamLanguages, *streamIDs); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid stream selection: %s\n", err)
+		return
+	}
+	outputPaths := StreamOutputPaths(*outputPath, streams, *forcedOnly)
+	if *debug {
+		var streamIndex string
+		for _, id := range sortedStreamIDs(streams) {
+			stream := streams[id]
+			if len(streams) > 1 {
+				streamIndex = fmt.Sprintf("[%d] ", id)
+			}
+			for _, sub := range stream.Subtitles {
+				fmt.Printf("%sStart: %v, End: %v, Size: %d×%v, Position: %v, Region: %d, Forced: %v\n",
+					streamIndex, sub.StartTime, sub.EndTime, sub.Image.Bounds().Dx(), sub.Image.Bounds().Dy(),
+					sub.Screen.Min, sub.Region, sub.Forced,
 				)
 			}
 		}
-		fmt.Println("PGS file parsed. Total subs:", len(imgSubs))
-		if len(imgSubs) == 0 {
-			return
-		}
-		subs = map[int][]ImageSubtitle{
-			0: imgSubs,
-		}
-	} else {
-		fmt.Printf("Parsing VobSub file %q\n", filepath.Base(*inputPath))
-		if subs, err = ParseVobSubFile(*inputPath); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to parse PGS file: %s\n", err)
-			return
-		}
-		var (
-			subIndex  string
-			totalSubs int
-		)
-		for index, imgSubs := range subs {
-			if len(subs) > 1 {
-				subIndex = fmt.Sprintf("[%d] ", index)
-			}
-			totalSubs += len(imgSubs)
-			if *debug {
-				for _, sub := range imgSubs {
-					fmt.Printf("%sStart: %v, End: %v, Size: %d×%v\n",
-						subIndex, sub.StartTime, sub.EndTime,
-						sub.Image.Bounds().Dx(), sub.Image.Bounds().Dy(),
-					)
-				}
+	}
+
+	if *exportFolder != "" {
+		if *forcedOnly {
+			for id, stream := range streams {
+				stream.Subtitles = ForcedImages(stream.Subtitles)
+				streams[id] = stream
 			}
 		}
-		if len(subs) > 1 {
-			subIndex = fmt.Sprintf(" (over %d streams)", len(subs))
-		}
-		fmt.Printf("VobSub file parsed. Total subs: %d%s\n", totalSubs, subIndex)
-		if totalSubs == 0 {
-			return
+		if err = ExportImages(*exportFolder, *inputPath, inputFormat, streams, *exportRequests, ocrConfig); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to export the images: %s\n", err)
 		}
+		return
 	}
 
 	// Prepare clean stop
@@ -139,39 +331,97 @@ func main() {
 	defer runCtxStopFunc()
 
 	// Step 2 - OCR with AI
-	for streamID, streamSubs := range subs {
-		var finalOutputPath string
-		// Adjust outputpath if needed
-		if len(subs) > 1 {
-			dirPath := filepath.Dir(*outputPath)
-			file := filepath.Base(*outputPath)
-			extension := filepath.Ext(file)
-			fileName := file[:len(file)-len(extension)]
-			finalOutputPath = filepath.Join(dirPath, fmt.Sprintf("%s_stream-%d%s", fileName, streamID, extension))
-			fmt.Printf("Stream #%d\n", streamID)
-		} else {
-			finalOutputPath = *outputPath
-		}
-		// Start process
-		if err = processSubsImages(runCtx, streamSubs, *nbWorkers, oaiClient, *model, finalOutputPath, *batchMode, *italic, *debug); err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to write the output test file: %s\n", err)
-			return
+	results := make([]StreamResult, 0, len(streams))
+	for _, streamID := range sortedStreamIDs(streams) {
+		stream := streams[streamID]
+		streamSubs := stream.Subtitles
+		finalOutputPath := outputPaths[streamID]
+		if len(streams) > 1 {
+			fmt.Printf("Stream #%d (%s)\n", streamID, describeStreams(map[int]SubtitleStream{streamID: stream}))
+		}
+		if *forcedOnly {
+			nbSubs := len(streamSubs)
+			streamSubs = ForcedImages(streamSubs)
+			fmt.Printf("Forced only: %d forced sub(s) out of %d\n", len(streamSubs), nbSubs)
+			if len(streamSubs) == 0 {
+				results = append(results, StreamResult{Stream: stream, Skipped: true})
+				continue
+			}
+		}
+		if *only != "" {
+			result, err := patchOutput(runCtx, streamSubs, onlySelection, *nbWorkers, ocrConfig, outputCfg, finalOutputPath)
+			result.Stream = stream
+			result.OutputPath = finalOutputPath
+			result.Err = err
+			results = append(results, result)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to patch the output: %s\n", err)
+			}
+			continue
+		}
+		// Start process, a failing stream does not prevent the others to be processed
+		result, err := processSubsImages(runCtx, streamSubs, *nbWorkers, ocrConfig, outputCfg, finalOutputPath, *batchMode)
+		result.Stream = stream
+		result.OutputPath = finalOutputPath
+		result.Err = err
+		results = append(results, result)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to process the subtitles: %s\n", err)
 		}
-		if finalOutputPath != *outputPath {
+		if len(streams) > 1 {
 			fmt.Println()
 		}
+		if runCtx.Err() != nil {
+			// interrupted by the user
+			break
+		}
+	}
+	if len(streams) > 1 {
+		printStreamsSummary(results)
+	}
+	if *reportPath != "" {
+		if err = WriteHTMLReport(*reportPath, filepath.Base(*inputPath), results, models, *lowConfidence); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write the review report: %s\n", err)
+			return
+		}
+		fmt.Printf("Review report written to %q\n", *reportPath)
 	}
 }
 
-func processSubsImages(ctx context.Context, imgSubs []ImageSubtitle, nbWorkers int, oaiClient openai.Client, model, outputPath string,
-	batch, italic, debug bool) (err error) {
-	// Check if we can create the output file now to avoid loosing the extraction if we can not save it afterwards
-	var fd *os.File
-	if fd, err = os.Create(outputPath); err != nil {
-		err = fmt.Errorf("Failed to write the output test file: %w", err)
-		return
+// outputConfig holds the settings used once the OCR is done
+type outputConfig struct {
+	PGSObjects     string
+	ForcedFile     bool
+	Merge          bool
+	MergeGap       time.Duration
+	Glossary       Glossary
+	GlossaryPolicy string
+	FixRules       []FixRule
+	Fix            FixConfig
+	Typography     string
+	Timing         bool
+	TimingConfig   TimingConfig
+	SDH            string
+	Empty          string
+	EmptyText      string
+	LowConfidence  int
+	ConfidenceFile bool
+	Review         bool
+	ReviewGraphics string
+	Debug          bool
+}
+
+func processSubsImages(ctx context.Context, imgSubs []ImageSubtitle, nbWorkers int, ocrConfig OCRConfig, outputCfg outputConfig,
+	outputPath string, batch bool) (result StreamResult, err error) {
+	// Check if we can create the output files now to avoid loosing the extraction if we can not save them afterwards
+	for _, filePath := range outputFiles(outputPath, outputCfg) {
+		var fd *os.File
+		if fd, err = os.Create(filePath); err != nil {
+			err = fmt.Errorf("Failed to write the output test file: %w", err)
+			return
+		}
+		fd.Close()
 	}
-	defer fd.Close()
 	// Prepare OCR via AI
 	liveprogress.RefreshInterval = 500 * time.Millisecond
 	var (
@@ -181,30 +431,116 @@ func processSubsImages(ctx context.Context, imgSubs []ImageSubtitle, nbWorkers i
 	)
 	start := time.Now()
 	if batch {
-		if srtSubs, promptTokens, completionTokens, err = OCRBatched(ctx, imgSubs, oaiClient, model, italic, debug); err != nil {
+		if srtSubs, promptTokens, completionTokens, err = OCRBatched(ctx, imgSubs, ocrConfig); err != nil {
 			err = fmt.Errorf("batched OCR failed: %w", err)
 			return
 		}
 	} else {
-		if srtSubs, promptTokens, completionTokens, err = OCR(ctx, imgSubs, nbWorkers, oaiClient, model, italic, debug); err != nil {
+		if srtSubs, promptTokens, completionTokens, err = OCR(ctx, imgSubs, nbWorkers, ocrConfig); err != nil {
 			err = fmt.Errorf("OCR failed: %w", err)
 			return
 		}
 	}
 	duration := time.Since(start)
+	result.PromptTokens = promptTokens
+	result.CompletionTokens = completionTokens
+	result.Duration = duration
 	fmt.Printf("OCR completed in %v\n", duration.Round(time.Millisecond))
-	fmt.Printf("%q model statistics:\n", model)
+	if ocrConfig.Ensemble() {
+		fmt.Printf("%q ensemble statistics:\n", strings.Join(ocrConfig.Models, ", "))
+	} else {
+		fmt.Printf("%q model statistics:\n", ocrConfig.Models[0])
+	}
 	fmt.Printf("\tprompt tokens:     %d (~%.0f tokens/s)\n",
 		promptTokens, math.Round(float64(promptTokens)/duration.Seconds()),
 	)
 	fmt.Printf("\tgeneration tokens: %d (~%.0f tokens/s)\n",
 		completionTokens, math.Round(float64(completionTokens)/duration.Seconds()),
 	)
-	// Step 3 - Write SRT file
-	if err = srtSubs.Marshal(fd); err != nil {
-		err = fmt.Errorf("failed to write SRT: %s\n", err)
+	// Step 3 - Post processing
+	if outputCfg.PGSObjects == RegionsSplit {
+		PositionRegions(srtSubs, imgSubs)
+	} else {
+		srtSubs = CombineRegions(srtSubs, imgSubs)
+	}
+	srtSubs, report := postProcess(srtSubs, outputCfg)
+	outputs := deriveOutputs(srtSubs, outputCfg, &report)
+	if ocrConfig.Ensemble() {
+		printDisagreements(outputs.Main, ocrConfig.Models)
+	}
+	// Step 4 - Write SRT file(s)
+	if err = outputs.Write(outputPath, outputCfg); err != nil {
+		err = fmt.Errorf("failed to write SRT: %w", err)
 		return
 	}
 	fmt.Printf("SRT written to %q\n", outputPath)
+	switch outputCfg.SDH {
+	case SDHBoth:
+		fmt.Printf("SDH SRT written to %q\n", outputVariantPath(outputPath, ".sdh.srt"))
+	case SDHLayer:
+		fmt.Printf("SDH WebVTT written to %q\n", outputVariantPath(outputPath, ".sdh.vtt"))
+	}
+	if outputCfg.ForcedFile {
+		fmt.Printf("Forced SRT written to %q (%d cue(s))\n", outputVariantPath(outputPath, ".forced.srt"), len(outputs.Forced))
+	}
+	if outputCfg.Review {
+		// the post processed cues are reviewed: every output is derived again from them after each change
+		save := func() error {
+			outputs = deriveOutputs(srtSubs, outputCfg, &report)
+			return outputs.Write(outputPath, outputCfg)
+		}
+		var changes int
+		if changes, err = ReviewCues(ctx, srtSubs, imgSubs, ocrConfig, outputCfg, os.Stdin, save); err != nil {
+			err = fmt.Errorf("review failed: %w", err)
+			return
+		}
+		fmt.Printf("Review done: %d cue(s) changed\n", changes)
+	}
+	result.Cues = len(outputs.Main)
+	result.Images = imgSubs
+	result.Subtitles = outputs.Main
+	switch outputCfg.Empty {
+	case EmptyDrop:
+		result.Dropped = outputs.Empties
+	case EmptyPlaceholder:
+		result.EmptyText = outputCfg.EmptyText
+	}
+	report.Print(srtSubs, outputCfg)
+	if len(outputs.Empties) > 0 {
+		printEmptyCues(outputs.Empties, outputCfg.Empty)
+	}
+	if ocrConfig.Logprobs {
+		var sidecarPath string
+		if outputCfg.ConfidenceFile {
+			sidecarPath = outputVariantPath(outputPath, ".confidence.txt")
+		}
+		if err = printLowConfidence(outputs.Main, outputCfg.LowConfidence, sidecarPath); err != nil {
+			return
+		}
+	}
 	return
 }
+
+func printDisagreements(srtSubs SRTSubtitles, models []string) {
+	var nbDisagreements int
+	for _, sub := range srtSubs {
+		if sub.Disagreement {
+			nbDisagreements++
+		}
+	}
+	if nbDisagreements == 0 {
+		fmt.Println("All ensemble models agreed on every line")
+		return
+	}
+	fmt.Printf("%d line(s) where the ensemble models disagreed, please review them:\n", nbDisagreements)
+	for index, sub := range srtSubs {
+		if !sub.Disagreement {
+			continue
+		}
+		fmt.Printf("\t#%d %s --> %s\n", index+1, sub.Start, sub.End)
+		for modelIndex, candidate := range sub.Candidates {
+			fmt.Printf("\t\t%s: %q\n", models[modelIndex], candidate)
+		}
+		fmt.Printf("\t\tkept: %q\n", sub.Text)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Matroska elements IDs
+const (
+	mkvIDEBML           = 0x1a45dfa3
+	mkvIDSegment        = 0x18538067
+	mkvIDInfo           = 0x1549a966
+	mkvIDTimestampScale = 0x2ad7b1
+	mkvIDTracks         = 0x1654ae6b
+	mkvIDTrackEntry     = 0xae
+	mkvIDTrackNumber    = 0xd7
+	mkvIDCodecID        = 0x86
+	mkvIDCodecPrivate   = 0x63a2
+	mkvIDLanguage       = 0x22b59c
+	mkvIDLanguageIETF   = 0x22b59d
+	mkvIDVideo          = 0xe0
+	mkvIDPixelWidth     = 0xb0
+	mkvIDPixelHeight    = 0xba
+	mkvIDCluster        = 0x1f43b675
+	mkvIDTimestamp      = 0xe7
+	mkvIDSimpleBlock    = 0xa3
+	mkvIDBlockGroup     = 0xa0
+	mkvIDBlock          = 0xa1
+	mkvUnknownSize      = -1
+	mkvCodecXSUB        = "S_IMAGE/BMP"
+	mkvDefaultLanguage  = "eng"
+)
+
+type mkvTrack struct {
+	Number   int
+	CodecID  string
+	Alpha    bool // DXSA codec private
+	Language string
+	Size     image.Point // video tracks
+}
+
+// mkvReader reads the EBML elements of a Matroska file
+type mkvReader struct {
+	reader   *bufio.Reader
+	position int64
+}
+
+func (mkv *mkvReader) readVint(keepMarker bool) (value int64, length int, err error) {
+	first, err := mkv.reader.ReadByte()
+	if err != nil {
+		return
+	}
+	mkv.position++
+	length = 1
+	for mask := byte(0x80); first&mask == 0; mask >>= 1 {
+		if mask == 0x01 {
+			return 0, 0, errors.New("invalid EBML variable size integer")
+		}
+		length++
+	}
+	value = int64(first)
+	if !keepMarker {
+		value &= int64(0xff >> length)
+	}
+	allOnes := value == int64(0xff>>length)
+	for range length - 1 {
+		var next byte
+		if next, err = mkv.reader.ReadByte(); err != nil {
+			return
+		}
+		mkv.position++
+		value = value<<8 | int64(next)
+		allOnes = allOnes && next == 0xff
+	}
+	if !keepMarker && allOnes {
+		value = mkvUnknownSize
+	}
+	return
+}
+
+// next reads the header of the next element
+func (mkv *mkvReader) next() (id int64, size int64, err error) {
+	if id, _, err = mkv.readVint(true); err != nil {
+		return
+	}
+	size, _, err = mkv.readVint(false)
+	return
+}
+
+func (mkv *mkvReader) read(size int64) (data []byte, err error) {
+	if size < 0 || size > 1<<30 {
+		return nil, fmt.Errorf("invalid element size %d", size)
+	}
+	data = make([]byte, size)
+	_, err = io.ReadFull(mkv.reader, data)
+	mkv.position += size
+	return
+}
+
+func (mkv *mkvReader) skip(size int64) (err error) {
+	if size < 0 {
+		return fmt.Errorf("can not skip an element of unknown size")
+	}
+	discarded, err := mkv.reader.Discard(int(size))
+	mkv.position += int64(discarded)
+	return
+}
+
+// mkvChildren calls fn for each child element of a master element already read in memory
+func mkvChildren(data []byte, fn func(id int64, data []byte) error) (err error) {
+	mkv := &mkvReader{reader: bufio.NewReader(bytes.NewReader(data))}
+	for mkv.position < int64(len(data)) {
+		var id, size int64
+		if id, size, err = mkv.next(); err != nil {
+			return
+		}
+		if size < 0 || mkv.position+size > int64(len(data)) {
+			return errors.New("invalid child element size")
+		}
+		var child []byte
+		if child, err = mkv.read(size); err != nil {
+			return
+		}
+		if err = fn(id, child); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func mkvUint(data []byte) (value int64) {
+	for _, b := range data {
+		value = value<<8 | int64(b)
+	}
+	return
+}
+
+// ParseMatroskaFile decodes the XSUB (DivX) tracks (S_IMAGE/BMP) of a Matroska file, the streams are
+// identified by their track number. The blocks are timed by the container, the timestamps embedded in the
+// XSUB packets only give their duration.
+func ParseMatroskaFile(filePath string) (streams map[int]SubtitleStream, err error) {
+	fd, err := os.Open(filePath)
+	if err != nil {
+		err = fmt.Errorf("failed to open file: %w", err)
+		return
+	}
+	defer fd.Close()
+	mkv := &mkvReader{reader: bufio.NewReaderSize(fd, 1<<20)}
+	id, size, err := mkv.next()
+	if err != nil || id != mkvIDEBML {
+		return nil, errors.New("invalid Matroska header")
+	}
+	if err = mkv.skip(size); err != nil {
+		return
+	}
+	var (
+		timestampScale = time.Duration(time.Millisecond)
+		tracks         = make(map[int]mkvTrack)
+		screenSize     image.Point
+		clusterTime    int64
+	)
+	streams = make(map[int]SubtitleStream)
+	for {
+		if id, size, err = mkv.next(); err != nil {
+			if err == io.EOF {
+				err = nil
+				if len(streams) == 0 {
+					err = errors.New("no XSUB track found")
+				}
+			}
+			return
+		}
+		switch id {
+		case mkvIDSegment, mkvIDCluster, mkvIDBlockGroup:
+			// master elements walked through (their size can be unknown)
+			continue
+		case mkvIDInfo:
+			var data []byte
+			if data, err = mkv.read(size); err != nil {
+				return
+			}
+			err = mkvChildren(data, func(id int64, data []byte) error {
+				if id == mkvIDTimestampScale {
+					timestampScale = time.Duration(mkvUint(data))
+				}
+				return nil
+			})
+		case mkvIDTracks:
+			var data []byte
+			if data, err = mkv.read(size); err != nil {
+				return
+			}
+			err = mkvChildren(data, func(id int64, data []byte) (err error) {
+				if id != mkvIDTrackEntry {
+					return
+				}
+				var track mkvTrack
+				if track, err = readMatroskaTrack(data); err != nil {
+					return
+				}
+				if track.Size != (image.Point{}) && screenSize == (image.Point{}) {
+					screenSize = track.Size
+				}
+				tracks[track.Number] = track
+				return
+			})
+		case mkvIDTimestamp:
+			var data []byte
+			if data, err = mkv.read(size); err != nil {
+				return
+			}
+			clusterTime = mkvUint(data)
+		case mkvIDSimpleBlock, mkvIDBlock:
+			var data []byte
+			if data, err = mkv.read(size); err != nil {
+				return
+			}
+			block := bytes.NewReader(data)
+			blockReader := &mkvReader{reader: bufio.NewReader(block)}
+			trackNumber, length, vintErr := blockReader.readVint(false)
+			if vintErr != nil || len(data) < length+3 {
+				continue
+			}
+			track, found := tracks[int(trackNumber)]
+			if !found || track.CodecID != mkvCodecXSUB || data[length+2]&0x06 != 0 {
+				// not a XSUB track or laced block
+				continue
+			}
+			timestamp := time.Duration(clusterTime+int64(int16(binary.BigEndian.Uint16(data[length:length+2])))) * timestampScale
+			sub, decodeErr := decodeXSUB(data[length+3:], track.Alpha)
+			if decodeErr != nil {
+				// Some bad packets can be found in the wild, other tools skip them too
+				fmt.Printf("WARNING: track %d: skipping invalid XSUB packet at %v: %s\n", track.Number, timestamp, decodeErr)
+				continue
+			}
+			sub.EndTime = timestamp + sub.EndTime - sub.StartTime
+			sub.StartTime = timestamp
+			sub.ScreenSize = screenSize
+			stream := streams[track.Number]
+			stream.ID = track.Number
+			stream.Language = track.Language
+			stream.Subtitles = append(stream.Subtitles, sub)
+			streams[track.Number] = stream
+		default:
+			err = mkv.skip(size)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read element 0x%x at %d: %w", id, mkv.position, err)
+		}
+	}
+}
+
+func readMatroskaTrack(data []byte) (track mkvTrack, err error) {
+	track.Language = mkvDefaultLanguage
+	var languageIETF string
+	err = mkvChildren(data, func(id int64, data []byte) error {
+		switch id {
+		case mkvIDTrackNumber:
+			track.Number = int(mkvUint(data))
+		case mkvIDCodecID:
+			track.CodecID = strings.TrimRight(string(data), "\x00")
+		case mkvIDCodecPrivate:
+			// BITMAPINFOHEADER: the compression tells if the palette has alpha values
+			track.Alpha = len(data) >= 20 && string(data[16:20]) == "DXSA"
+		case mkvIDLanguage:
+			track.Language = strings.TrimRight(string(data), "\x00")
+		case mkvIDLanguageIETF:
+			languageIETF = strings.TrimRight(string(data), "\x00")
+		case mkvIDVideo:
+			return mkvChildren(data, func(id int64, data []byte) error {
+				switch id {
+				case mkvIDPixelWidth:
+					track.Size.X = int(mkvUint(data))
+				case mkvIDPixelHeight:
+					track.Size.Y = int(mkvUint(data))
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if languageIETF != "" {
+		// the IETF tag takes precedence, only its language subtag is kept
+		track.Language, _, _ = strings.Cut(languageIETF, "-")
+	}
+	if track.Language == "und" {
+		track.Language = ""
+	}
+	track.Language = normalizeLanguageCode(track.Language)
+	return
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// mkvTestElement returns an EBML element, its size written on 8 bytes (unknown if data is nil)
+func mkvTestElement(id int64, data []byte) (element []byte) {
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || len(element) > 0 {
+			element = append(element, b)
+		}
+	}
+	if data == nil {
+		return append(element, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	}
+	element = binary.BigEndian.AppendUint64(element, uint64(len(data)))
+	element[len(element)-8] = 0x01
+	return append(element, data...)
+}
+
+// mkvTestBlock returns a SimpleBlock or Block payload
+func mkvTestBlock(track byte, relative int16, flags byte, payload []byte) []byte {
+	block := binary.BigEndian.AppendUint16([]byte{0x80 | track}, uint16(relative))
+	return append(append(block, flags), payload...)
+}
+
+func TestMatroskaReadVint(t *testing.T) {
+	for _, test := range []struct {
+		data       []byte
+		keepMarker bool
+		value      int64
+		length     int
+	}{
+		{[]byte{0x81}, false, 1, 1},
+		{[]byte{0x40, 0x02}, false, 2, 2},
+		{[]byte{0x1a, 0x45, 0xdf, 0xa3}, true, mkvIDEBML, 4},
+		{[]byte{0x1a, 0x45, 0xdf, 0xa3}, false, 0x0a45dfa3, 4},
+		{[]byte{0xff}, false, mkvUnknownSize, 1},
+		{[]byte{0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, false, mkvUnknownSize, 8},
+		{[]byte{0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}, false, 0xfffffffffffffe, 8},
+	} {
+		mkv := &mkvReader{reader: bufio.NewReader(bytes.NewReader(test.data))}
+		value, length, err := mkv.readVint(test.keepMarker)
+		if err != nil {
+			t.Errorf("% x: %s", test.data, err)
+			continue
+		}
+		if value != test.value || length != test.length || mkv.position != int64(length) {
+			t.Errorf("% x: got value 0x%x on %d byte(s) at %d, expected 0x%x on %d", test.data, value, length, mkv.position, test.value, test.length)
+		}
+	}
+	mkv := &mkvReader{reader: bufio.NewReader(bytes.NewReader([]byte{0x00, 0x81}))}
+	if _, _, err := mkv.readVint(false); err == nil {
+		t.Error("a variable size integer longer than 8 bytes must fail")
+	}
+	if err := mkv.skip(mkvUnknownSize); err == nil {
+		t.Error("skipping an element of unknown size must fail")
+	}
+}
+
+func TestParseMatroskaFile(t *testing.T) {
+	codecPrivate := make([]byte, 40)
+	copy(codecPrivate[16:], "DXSB")
+	file := bytes.Join([][]byte{
+		mkvTestElement(mkvIDEBML, []byte{0x42, 0x82, 0x88, 'm', 'a', 't', 'r', 'o', 's', 'k', 'a'}),
+		// segment and cluster of unknown size are walked through
+		mkvTestElement(mkvIDSegment, nil),
+		mkvTestElement(mkvIDInfo, mkvTestElement(mkvIDTimestampScale, []byte{0x0f, 0x42, 0x40})),
+		mkvTestElement(mkvIDTracks, bytes.Join([][]byte{
+			mkvTestElement(mkvIDTrackEntry, bytes.Join([][]byte{
+				mkvTestElement(mkvIDTrackNumber, []byte{1}),
+				mkvTestElement(mkvIDCodecID, []byte("V_MPEG4/ISO/AVC")),
+				mkvTestElement(mkvIDVideo, append(mkvTestElement(mkvIDPixelWidth, []byte{0x02, 0xd0}), mkvTestElement(mkvIDPixelHeight, []byte{0x02, 0x40})...)),
+			}, nil)),
+			mkvTestElement(mkvIDTrackEntry, bytes.Join([][]byte{
+				mkvTestElement(mkvIDTrackNumber, []byte{3}),
+				mkvTestElement(mkvIDCodecID, []byte(mkvCodecXSUB)),
+				mkvTestElement(mkvIDCodecPrivate, codecPrivate),
+				mkvTestElement(mkvIDLanguage, []byte("ger")),
+				mkvTestElement(mkvIDLanguageIETF, []byte("fr-CA")),
+			}, nil)),
+		}, nil)),
+		mkvTestElement(mkvIDCluster, nil),
+		mkvTestElement(mkvIDTimestamp, []byte{0x27, 0x10}),
+		mkvTestElement(mkvIDSimpleBlock, mkvTestBlock(1, 0, 0x80, []byte{1, 2, 3})),
+		// the XSUB packet timestamps only give the duration
+		mkvTestElement(mkvIDSimpleBlock, mkvTestBlock(3, 500, 0x80, xsubTestPacket("[00:00:00.000-00:00:01.500]", false))),
+		mkvTestElement(mkvIDSimpleBlock, mkvTestBlock(3, 600, 0x80, []byte("invalid"))),
+		mkvTestElement(mkvIDBlockGroup, mkvTestElement(mkvIDBlock, mkvTestBlock(3, -100, 0, xsubTestPacket("[00:01:00.000-00:01:02.000]", false)))),
+	}, nil)
+	filePath := filepath.Join(t.TempDir(), "video.mkv")
+	if err := os.WriteFile(filePath, file, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	streams, err := ParseMatroskaFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, found := streams[3]
+	if len(streams) != 1 || !found || stream.ID != 3 || stream.Language != "fr" || len(stream.Subtitles) != 2 {
+		t.Fatalf("got streams %+v", streams)
+	}
+	for index, expected := range [][2]time.Duration{{10500 * time.Millisecond, 12 * time.Second}, {9900 * time.Millisecond, 11900 * time.Millisecond}} {
+		sub := stream.Subtitles[index]
+		if sub.StartTime != expected[0] || sub.EndTime != expected[1] || sub.ScreenSize != image.Pt(720, 576) {
+			t.Errorf("subtitle #%d: got %v --> %v and screen size %v", index, sub.StartTime, sub.EndTime, sub.ScreenSize)
+		}
+	}
+	header := append(mkvTestElement(mkvIDEBML, []byte{}), mkvTestElement(mkvIDSegment, nil)...)
+	if err = os.WriteFile(filePath, header, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ParseMatroskaFile(filePath); err == nil {
+		t.Error("a file without XSUB track must fail")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// CueMerge describes consecutive cues combined into a single one
+type CueMerge struct {
+	Index   int   // index of the resulting cue
+	Sources []int // original image indexes of the merged cues
+}
+
+// MergeCues combines the consecutive cues having the same normalized text and touching or overlapping
+// timestamps (a gap up to maxGap is tolerated) into a single cue covering the whole time range. This
+// happens when a single visible subtitle is split in several display sets (palette updates, fades,
+// epoch refreshes). Empty cues are never merged.
+func MergeCues(srtSubs SRTSubtitles, maxGap time.Duration) (merged SRTSubtitles, merges []CueMerge) {
+	merged = make(SRTSubtitles, 0, len(srtSubs))
+	var previousKey string
+	for _, sub := range srtSubs {
+		key := ensembleKey(ensembleNormalize(sub.Text))
+		if len(merged) > 0 && key != "" && key == previousKey {
+			last := &merged[len(merged)-1]
+			if sub.Top == last.Top && sub.Forced == last.Forced && sub.Start <= last.End+SRTTimestamp(maxGap) {
+				if len(merges) == 0 || merges[len(merges)-1].Index != len(merged)-1 {
+					merges = append(merges, CueMerge{Index: len(merged) - 1})
+				}
+				last.End = max(last.End, sub.End)
+				last.Sources = append(last.Sources, sub.Sources...)
+				last.Disagreement = last.Disagreement || sub.Disagreement
+				if sub.Confidence != NoConfidence && (last.Confidence == NoConfidence || sub.Confidence < last.Confidence) {
+					last.Confidence = sub.Confidence
+				}
+				last.PromptTokens += sub.PromptTokens
+				last.CompletionTokens += sub.CompletionTokens
+				last.Retries += sub.Retries
+				merges[len(merges)-1].Sources = last.Sources
+				continue
+			}
+		}
+		sub.Sources = append([]int(nil), sub.Sources...) // do not share the backing array with the input
+		merged = append(merged, sub)
+		previousKey = key
+	}
+	return
+}
+
+func printCueMerges(srtSubs SRTSubtitles, merges []CueMerge, debug bool) {
+	var removed int
+	for _, merge := range merges {
+		removed += len(merge.Sources) - 1
+	}
+	fmt.Printf("Merge: %d cue(s) merged into %d\n", removed+len(merges), len(merges))
+	if !debug {
+		return
+	}
+	for _, merge := range merges {
+		fmt.Printf("\t#%d %s --> %s from images %s\n",
+			merge.Index+1, srtSubs[merge.Index].Start, srtSubs[merge.Index].End, formatSources(merge.Sources))
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"image"
 	"image/png"
 	"os"
+	"slices"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -24,7 +25,19 @@ Do not use quotes, do not provide comments, and do not add any additional conten
 Do not reformulate, write the text exactly as it is on the image even if it is an incomplete sentence. Respect the line breaks.
 Maintain the original formatting and line breaks without adding extra spaces or line breaks.
 If there is no text (e.g. only an image with no text or a blank image), simply return an empty string and NEVER comment it.
-If the user input do not contains any text, simply extract the text from the image. Otherwise consider user instruction as additionnal rules to follow.`
+If the user input do not contains any text, simply extract the text from the image. Otherwise consider user instruction as additionnal rules to follow.
+{{- if .TrackTitle}}
+
+The subtitles come from: {{.TrackTitle}}.
+{{- end}}
+{{- if .Glossary}}
+
+The following names and terms may appear in the subtitles, use this exact spelling when they do:
+{{- range .Glossary}}
+- {{.}}
+{{- end}}
+{{- end}}
+{{- template "language" .}}`
 
 	italicPrompt = `When formatting text, if a single word is in italics, use the following format to mark it:
 <i>word</i>
@@ -35,18 +48,53 @@ non_italic_word_1 <i>italic_word_1 italic_word_2 ... italic_word_n</i> non_itali
 If the italic words span on multiples lines, use the following format:
 non_italic_word_1 <i>italic_word_1
 italic_word_2 ... italic_word_n</i> non_italic_word_2`
+
+	contextPrompt = `The following text contains the previous subtitles of the same video, in order. It is NOT part of the image: never transcribe it.
+Only use it as a reference to keep the spelling of names and terms consistent, and to disambiguate short or stylized fragments.
+<previous_subtitles>
+%s
+</previous_subtitles>`
 )
 
 type ImageSubtitle struct {
 	Image     image.Image
 	StartTime time.Duration
 	EndTime   time.Duration
+	// Position on the screen, only known for PGS
+	Screen     image.Rectangle
+	ScreenSize image.Point
+	Region     int  // index within the images displayed at the same time, in screen order
+	Forced     bool // displayed even when subtitles are off
+}
+
+// OCRConfig holds the settings shared by all the OCR requests of a run
+type OCRConfig struct {
+	Client openai.Client
+	// Models contains the main model first. Additional models enable the ensemble mode.
+	Models []string
+	Italic bool
+	// Logprobs requests the tokens log probabilities to compute a confidence score for each subtitle
+	Logprobs bool
+	// Context is the number of previous subtitles sent as reference to the model (0 to disable)
+	Context int
+	// Prompts are the rendered prompt templates
+	Prompts Prompts
+	Debug   bool
 }
 
-func OCR(ctx context.Context, imgSubs []ImageSubtitle, nbWorkers int, client openai.Client, model string, italic, debug bool) (txtSubs SRTSubtitles, promptTokens, completionTokens int64, err error) {
+// Ensemble returns true if several models must be queried for each image
+func (cfg OCRConfig) Ensemble() bool {
+	return len(cfg.Models) > 1
+}
+
+func OCR(ctx context.Context, imgSubs []ImageSubtitle, nbWorkers int, cfg OCRConfig) (txtSubs SRTSubtitles, promptTokens, completionTokens int64, err error) {
 	// Progress bar
+	nbPasses := 1
+	if cfg.Context > 0 {
+		nbPasses = 2
+	}
 	bar := liveprogress.SetMainLineAsBar(
-		liveprogress.WithTotal(uint64(len(imgSubs))),
+		liveprogress.WithTotal(uint64(len(imgSubs)*nbPasses)),
 		liveprogress.WithMultiplyRunes(),
 		liveprogress.WithPrependDecorator(func(bar *liveprogress.Bar) string {
 			return "AI OCR Progress | "
@@ -59,7 +107,6 @@ func OCR(ctx context.Context, imgSubs []ImageSubtitle, nbWorkers int, client ope
 		liveprogress.WithAppendTimeRemaining(liveprogress.BaseStyle()),
 	)
 	defer liveprogress.RemoveBar(bar)
-	bypass := liveprogress.Bypass()
 	if err = liveprogress.Start(); err != nil {
 		err = fmt.Errorf("failed to start live progress: %w", err)
 		return
@@ -81,6 +128,29 @@ func OCR(ctx context.Context, imgSubs []ImageSubtitle, nbWorkers int, client ope
 		completionTokens = totalCompletionTokens.Load()
 	}()
 	// Process each subtitle image and extract text using AI OCR
+	if cfg.Context == 0 {
+		txtSubs, err = ocrPass(ctx, imgSubs, nil, nbWorkers, cfg, bar, &totalPromptTokens, &totalCompletionTokens, cfg.Debug)
+		return
+	}
+	// Context mode: a first pass to get the text of each image then a second one using the first pass
+	// text of the previous subtitles as context. This keeps the workers pool fully parallel.
+	var firstPass SRTSubtitles
+	if firstPass, err = ocrPass(ctx, imgSubs, nil, nbWorkers, cfg, bar, &totalPromptTokens, &totalCompletionTokens, false); err != nil {
+		err = fmt.Errorf("first pass failed: %w", err)
+		return
+	}
+	if txtSubs, err = ocrPass(ctx, imgSubs, firstPass, nbWorkers, cfg, bar, &totalPromptTokens, &totalCompletionTokens, cfg.Debug); err != nil {
+		err = fmt.Errorf("context pass failed: %w", err)
+		return
+	}
+	return
+}
+
+// ocrPass runs the workers pool once over all the images. If previousPass is not nil, the text of the
+// cfg.Context previous subtitles of each image is sent to the model as context.
+func ocrPass(ctx context.Context, imgSubs []ImageSubtitle, previousPass SRTSubtitles, nbWorkers int, cfg OCRConfig, bar *liveprogress.Bar,
+	totalPromptTokens, totalCompletionTokens *atomic.Int64, debug bool) (txtSubs SRTSubtitles, err error) {
+	bypass := liveprogress.Bypass()
 	//// feeder worker
 	type TodoJob struct {
 		Index    int
@@ -108,27 +178,57 @@ func OCR(ctx context.Context, imgSubs []ImageSubtitle, nbWorkers int, client ope
 	for range nbWorkers {
 		ocrWorkers.Go(func() (err error) {
 			var (
-				text             string
+				candidates       []string
+				previous         []string
+				confidence       float64
 				promptTokens     int64
 				completionTokens int64
+				retries          int
 			)
 			for job := range todoJobs {
-				text, promptTokens, completionTokens, err = ExtractText(ctx, client, model, job.Subtitle.Image, italic)
-				if err != nil {
-					err = fmt.Errorf("failed to extract text from image #%d: %s\n", job.Index+1, err)
-					return
+				candidates = make([]string, len(cfg.Models))
+				if previousPass != nil {
+					previous = previousSubtitlesText(previousPass, job.Index, cfg.Context)
 				}
 				txtSubs[job.Index] = SRTSubtitle{
-					Start: SRTTimestamp(job.Subtitle.StartTime),
-					End:   SRTTimestamp(job.Subtitle.EndTime),
-					Text:  text,
+					Start:      SRTTimestamp(job.Subtitle.StartTime),
+					End:        SRTTimestamp(job.Subtitle.EndTime),
+					Confidence: NoConfidence,
+					Sources:    []int{job.Index},
+					Forced:     job.Subtitle.Forced,
+				}
+				if previousPass != nil {
+					// the first pass usage is accounted to the final cue
+					txtSubs[job.Index].PromptTokens = previousPass[job.Index].PromptTokens
+					txtSubs[job.Index].CompletionTokens = previousPass[job.Index].CompletionTokens
+					txtSubs[job.Index].Retries = previousPass[job.Index].Retries
+				}
+				for modelIndex, model := range cfg.Models {
+					candidates[modelIndex], confidence, promptTokens, completionTokens, retries, err = ExtractText(ctx, cfg, model, job.Subtitle.Image, previous)
+					if err != nil {
+						err = fmt.Errorf("failed to extract text from image #%d with model %q: %s\n", job.Index+1, model, err)
+						return
+					}
+					totalPromptTokens.Add(promptTokens)
+					totalCompletionTokens.Add(completionTokens)
+					txtSubs[job.Index].PromptTokens += promptTokens
+					txtSubs[job.Index].CompletionTokens += completionTokens
+					txtSubs[job.Index].Retries += retries
+					// in ensemble mode, keep the lowest confidence of all models
+					if confidence != NoConfidence && (txtSubs[job.Index].Confidence == NoConfidence || confidence < txtSubs[job.Index].Confidence) {
+						txtSubs[job.Index].Confidence = confidence
+					}
+				}
+				if cfg.Ensemble() {
+					txtSubs[job.Index].Text, txtSubs[job.Index].Disagreement = EnsembleVote(candidates)
+					txtSubs[job.Index].Candidates = candidates
+				} else {
+					txtSubs[job.Index].Text = candidates[0]
 				}
-				totalPromptTokens.Add(promptTokens)
-				totalCompletionTokens.Add(completionTokens)
 				bar.CurrentIncrement()
 				if debug {
 					fmt.Fprintf(bypass, "#%d %s --> %s\n%s\n\n",
-						job.Index+1, job.Subtitle.StartTime, job.Subtitle.EndTime, text,
+						job.Index+1, job.Subtitle.StartTime, job.Subtitle.EndTime, txtSubs[job.Index].Text,
 					)
 				}
 			}
@@ -143,9 +243,20 @@ func OCR(ctx context.Context, imgSubs []ImageSubtitle, nbWorkers int, client ope
 	return
 }
 
-func ExtractText(ctx context.Context, client openai.Client, model string, img image.Image, italic bool) (text string, promptTokens, completionTokens int64, err error) {
+// previousSubtitlesText returns the non empty text of (at most) the n subtitles preceding index
+func previousSubtitlesText(subs SRTSubtitles, index, n int) (previous []string) {
+	for i := index - 1; i >= 0 && len(previous) < n; i-- {
+		if subs[i].Text != "" {
+			previous = append(previous, subs[i].Text)
+		}
+	}
+	slices.Reverse(previous)
+	return
+}
+
+func ExtractText(ctx context.Context, cfg OCRConfig, model string, img image.Image, previous []string) (text string, confidence float64, promptTokens, completionTokens int64, retries int, err error) {
 	// Prepare payload
-	body, err := generateOCRBodyRequest(img, model, italic)
+	body, err := generateOCRBodyRequest(img, model, cfg, previous)
 	if err != nil {
 		err = fmt.Errorf("failed to generate OCR body request: %w", err)
 		return
@@ -154,7 +265,7 @@ func ExtractText(ctx context.Context, client openai.Client, model string, img im
 	nbRetries := 3
 	var chatCompletion *openai.ChatCompletion
 	for retry := range nbRetries {
-		if chatCompletion, err = client.Chat.Completions.New(ctx, body); err != nil {
+		if chatCompletion, err = cfg.Client.Chat.Completions.New(ctx, body); err != nil {
 			if retry == nbRetries-1 {
 				err = fmt.Errorf("failed to get OCR chat completion: %w", err)
 				return
@@ -163,28 +274,38 @@ func ExtractText(ctx context.Context, client openai.Client, model string, img im
 				"retrying OCR request (%d/%d) after error: %s\n",
 				retry+1, nbRetries, err.Error(),
 			)
+			retries++
 		} else {
 			break
 		}
 	}
 	text = strings.TrimSpace(chatCompletion.Choices[0].Message.Content)
+	confidence = TokensConfidence(chatCompletion.Choices[0].Logprobs.Content)
 	promptTokens = chatCompletion.Usage.PromptTokens
 	completionTokens = chatCompletion.Usage.CompletionTokens
 	return
 }
 
-func generateOCRBodyRequest(img image.Image, model string, italic bool) (body openai.ChatCompletionNewParams, err error) {
+func generateOCRBodyRequest(img image.Image, model string, cfg OCRConfig, previous []string) (body openai.ChatCompletionNewParams, err error) {
 	encodedImage, err := encodeImageToDataURL(img)
 	if err != nil {
 		err = fmt.Errorf("failed to encode image: %w", err)
 		return
 	}
-	content := make([]openai.ChatCompletionContentPartUnionParam, 0, 2)
-	if italic {
+	content := make([]openai.ChatCompletionContentPartUnionParam, 0, 3)
+	if len(previous) > 0 {
+		// Give the previous subtitles as reference, clearly separated from the instructions
+		content = append(content, openai.ChatCompletionContentPartUnionParam{
+			OfText: &openai.ChatCompletionContentPartTextParam{
+				Text: fmt.Sprintf(contextPrompt, strings.Join(previous, "\n")),
+			},
+		})
+	}
+	if cfg.Italic {
 		// Set the additionnal italic instructions as user prompt
 		content = append(content, openai.ChatCompletionContentPartUnionParam{
 			OfText: &openai.ChatCompletionContentPartTextParam{
-				Text: italicPrompt,
+				Text: cfg.Prompts.Italic,
 			},
 		})
 	}
@@ -197,7 +318,7 @@ func generateOCRBodyRequest(img image.Image, model string, italic bool) (body op
 	})
 	body = openai.ChatCompletionNewParams{
 		Messages: []openai.ChatCompletionMessageParamUnion{
-			openai.SystemMessage(systemPrompt),
+			openai.SystemMessage(cfg.Prompts.System),
 			{
 				OfUser: &openai.ChatCompletionUserMessageParam{
 					Content: openai.ChatCompletionUserMessageParamContentUnion{
@@ -208,14 +329,25 @@ func generateOCRBodyRequest(img image.Image, model string, italic bool) (body op
 		},
 		Model: model,
 	}
+	if cfg.Logprobs {
+		body.Logprobs = openai.Bool(true)
+	}
 	return
 }
 
 func encodeImageToDataURL(image image.Image) (string, error) {
-	var data bytes.Buffer
-	err := png.Encode(&data, image)
+	data, err := encodeOCRImage(image)
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("data:image/png;base64,%s", base64.StdEncoding.EncodeToString(data.Bytes())), nil
+	return fmt.Sprintf("data:image/png;base64,%s", base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// encodeOCRImage returns the PNG file sent to the model for an image
+func encodeOCRImage(image image.Image) ([]byte, error) {
+	var data bytes.Buffer
+	if err := png.Encode(&data, image); err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
 }
@@ -40,13 +40,16 @@ func (bc batchContent) Reader() (r io.Reader, err error) {
 	return
 }
 
-func OCRBatched(ctx context.Context, imgSubs []ImageSubtitle, client openai.Client, model string, italic, debug bool) (txtSubs SRTSubtitles, totalPromptTokens, totalCompletionTokens int64, err error) {
+func OCRBatched(ctx context.Context, imgSubs []ImageSubtitle, cfg OCRConfig) (txtSubs SRTSubtitles, totalPromptTokens, totalCompletionTokens int64, err error) {
+	client := cfg.Client
+	model := cfg.Models[0]
+	debug := cfg.Debug
 	// Create the batches
 	var line string
 	batches := make([]batchContent, 0, len(imgSubs)/batchMaxRequests+1)
 	currentBatch := make(batchContent, 0, min(batchMaxRequests, len(imgSubs)))
 	for id, sub := range imgSubs {
-		if line, err = batchCreateLine(id, model, sub.Image, italic); err != nil {
+		if line, err = batchCreateLine(id, model, sub.Image, cfg); err != nil {
 			err = fmt.Errorf("failed to create batch line #%d: %w", id, err)
 			return
 		}
@@ -292,6 +295,12 @@ waitLoop:
 				Start: SRTTimestamp(imgSubs[subIndex].StartTime),
 				End:   SRTTimestamp(imgSubs[subIndex].EndTime),
 				Text:  strings.TrimSpace(line.Response.Body.Choices[0].Message.Content),
+				// no-op if logprobs were not requested
+				Confidence:       TokensConfidence(line.Response.Body.Choices[0].Logprobs.Content),
+				Sources:          []int{subIndex},
+				Forced:           imgSubs[subIndex].Forced,
+				PromptTokens:     line.Response.Body.Usage.PromptTokens,
+				CompletionTokens: line.Response.Body.Usage.CompletionTokens,
 			}
 			totalPromptTokens += line.Response.Body.Usage.PromptTokens
 			totalCompletionTokens += line.Response.Body.Usage.CompletionTokens
@@ -310,13 +319,6 @@ waitLoop:
 	return
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
 func batchSize(currentBatch []string, newLine string) (totalSize int) {
 	for _, item := range currentBatch {
 		totalSize += len(item) + 1 // +1 for the newline character that will be added later in the JSON array representation.
@@ -334,9 +336,9 @@ type batchLine struct {
 	Body     openai.ChatCompletionNewParams `json:"body"`
 }
 
-func batchCreateLine(id int, model string, img image.Image, italic bool) (line string, err error) {
+func batchCreateLine(id int, model string, img image.Image, cfg OCRConfig) (line string, err error) {
 	// Prepare request payload
-	body, err := generateOCRBodyRequest(img, model, italic)
+	body, err := generateOCRBodyRequest(img, model, cfg, nil)
 	if err != nil {
 		err = fmt.Errorf("failed to generate OCR body request: %w", err)
 		return
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// streamOutputs are the cues written for a stream
+type streamOutputs struct {
+	Main    SRTSubtitles
+	SDH     SRTSubtitles // keeping the SDH annotations, with -sdh both or layer (marked by markSDHText)
+	Forced  SRTSubtitles // with -forced-file
+	Empties SRTSubtitles // empty cues of the main output, handled by the empty cues policy
+}
+
+// deriveOutputs builds the output cues from the post processed ones: SDH annotations removal, timing pass
+// and empty cues policy, each output getting its own timing as the reading time depends on the text. The
+// post processed cues are not modified so the outputs can be derived again once they are edited.
+func deriveOutputs(srtSubs SRTSubtitles, cfg outputConfig, report *postProcessReport) (outputs streamOutputs) {
+	if cfg.SDH == SDHKeep {
+		outputs.Main = slices.Clone(srtSubs)
+	} else {
+		outputs.Main, report.SDHAnnotations, report.SDHDropped = StripSDH(srtSubs)
+	}
+	sdhOutput := cfg.SDH == SDHBoth || cfg.SDH == SDHLayer
+	if sdhOutput {
+		outputs.SDH = slices.Clone(srtSubs)
+	}
+	if cfg.Timing {
+		if sdhOutput {
+			ApplyTiming(outputs.SDH, cfg.TimingConfig)
+		}
+		report.Timing = ApplyTiming(outputs.Main, cfg.TimingConfig)
+	}
+	// output numbering starts here: empty cues may be dropped
+	outputs.Main, outputs.Empties = ApplyEmptyPolicy(outputs.Main, cfg.Empty, cfg.EmptyText)
+	if sdhOutput {
+		outputs.SDH, _ = ApplyEmptyPolicy(outputs.SDH, cfg.Empty, cfg.EmptyText)
+	}
+	if cfg.SDH == SDHLayer {
+		for index := range outputs.SDH {
+			outputs.SDH[index].Text = markSDHText(outputs.SDH[index].Text)
+		}
+	}
+	if cfg.ForcedFile {
+		outputs.Forced = ForcedSubtitles(outputs.Main)
+	}
+	return
+}
+
+// outputFiles returns the path of each file written for the stream: the main output, then the SDH (SRT or
+// WebVTT) and forced ones if requested
+func outputFiles(outputPath string, cfg outputConfig) (files []string) {
+	files = []string{outputPath}
+	switch cfg.SDH {
+	case SDHBoth:
+		files = append(files, outputVariantPath(outputPath, ".sdh.srt"))
+	case SDHLayer:
+		files = append(files, outputVariantPath(outputPath, ".sdh.vtt"))
+	}
+	if cfg.ForcedFile {
+		files = append(files, outputVariantPath(outputPath, ".forced.srt"))
+	}
+	return
+}
+
+// outputVariantPath returns the path of a file written next to the output, its extension replaced by suffix
+func outputVariantPath(outputPath, suffix string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + suffix
+}
+
+// Write saves the outputs to the files returned by outputFiles
+func (outputs streamOutputs) Write(outputPath string, cfg outputConfig) (err error) {
+	files := outputFiles(outputPath, cfg)
+	subs := []SRTSubtitles{outputs.Main}
+	if cfg.SDH == SDHBoth || cfg.SDH == SDHLayer {
+		subs = append(subs, outputs.SDH)
+	}
+	if cfg.ForcedFile {
+		subs = append(subs, outputs.Forced)
+	}
+	for index, filePath := range files {
+		save := saveSRT
+		if filepath.Ext(filePath) == ".vtt" {
+			save = saveVTT
+		}
+		if err = save(filePath, subs[index]); err != nil {
+			err = fmt.Errorf("%q: %w", filePath, err)
+			return
+		}
+	}
+	return
+}
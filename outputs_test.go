@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReviewDerivedOutputs(t *testing.T) {
+	img := image.NewPaletted(image.Rect(0, 0, 2, 2), color.Palette{color.Transparent, color.White})
+	imgSubs := []ImageSubtitle{{Image: img}, {Image: img}, {Image: img}}
+	srtSubs := SRTSubtitles{
+		{Start: SRTTimestamp(time.Second), End: SRTTimestamp(2 * time.Second), Text: "[DOOR SLAMS]\nHello.", Sources: []int{0}, Forced: true},
+		{Start: SRTTimestamp(3 * time.Second), End: SRTTimestamp(4 * time.Second), Sources: []int{1}},
+		{Start: SRTTimestamp(5 * time.Second), End: SRTTimestamp(6 * time.Second), Text: "(sighs)", Sources: []int{2}},
+	}
+	cfg := outputConfig{SDH: SDHBoth, Empty: EmptyDrop, ForcedFile: true, ReviewGraphics: GraphicsASCII}
+	outputPath := filepath.Join(t.TempDir(), "output.srt")
+	var report postProcessReport
+	outputs := deriveOutputs(srtSubs, cfg, &report)
+	if len(outputs.Main) != 1 || len(outputs.SDH) != 2 || len(outputs.Forced) != 1 || len(outputs.Empties) != 1 {
+		t.Fatalf("got %d main, %d SDH, %d forced and %d empty cue(s)", len(outputs.Main), len(outputs.SDH), len(outputs.Forced), len(outputs.Empties))
+	}
+	if report.SDHAnnotations != 2 || report.SDHDropped != 1 {
+		t.Errorf("got %d annotation(s) removed and %d cue(s) dropped", report.SDHAnnotations, report.SDHDropped)
+	}
+	// the second cue text is filled during the review: it reaches the three outputs
+	save := func() error {
+		outputs = deriveOutputs(srtSubs, cfg, &report)
+		return outputs.Write(outputPath, cfg)
+	}
+	input := strings.NewReader("\ne\n[MUSIC] Fixed text.\n\n")
+	changes, err := ReviewCues(context.Background(), srtSubs, imgSubs, OCRConfig{Models: []string{"model"}}, cfg, input, save)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes != 1 {
+		t.Errorf("got %d change(s), expected 1", changes)
+	}
+	expected := map[string][]string{
+		"output.srt":        {"Hello.", "Fixed text."},
+		"output.sdh.srt":    {"[DOOR SLAMS]\nHello.", "[MUSIC] Fixed text.", "(sighs)"},
+		"output.forced.srt": {"Hello."},
+	}
+	for name, texts := range expected {
+		data, err := os.ReadFile(filepath.Join(filepath.Dir(outputPath), name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, text := range texts {
+			if !strings.Contains(string(data), text+"\n") {
+				t.Errorf("%s does not contain %q:\n%s", name, text, data)
+			}
+		}
+	}
+	if len(outputs.Main) != 2 || len(outputs.Empties) != 0 {
+		t.Errorf("got %d main and %d empty cue(s) after the review", len(outputs.Main), len(outputs.Empties))
+	}
+}
+
+func TestDeriveOutputsSDHLayer(t *testing.T) {
+	srtSubs := SRTSubtitles{{Start: SRTTimestamp(time.Second), End: SRTTimestamp(2 * time.Second), Text: "[DOOR SLAMS]\nHello."}}
+	cfg := outputConfig{SDH: SDHLayer, Empty: EmptyKeep}
+	var report postProcessReport
+	outputs := deriveOutputs(srtSubs, cfg, &report)
+	if outputs.Main[0].Text != "Hello." || outputs.SDH[0].Text != "<c.sdh>[DOOR SLAMS]</c>\nHello." {
+		t.Errorf("got main %q and SDH %q", outputs.Main[0].Text, outputs.SDH[0].Text)
+	}
+	outputPath := filepath.Join(t.TempDir(), "output.srt")
+	if err := outputs.Write(outputPath, cfg); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(outputVariantPath(outputPath, ".sdh.vtt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "WEBVTT\n") {
+		t.Errorf("the SDH layer output is not a WebVTT file:\n%s", data)
+	}
+}
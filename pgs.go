@@ -1,43 +1,350 @@
 package main
 
 import (
+	"bufio"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"sort"
 	"time"
+)
 
-	"github.com/mbiamont/go-pgs-parser/displaySet"
-	"github.com/mbiamont/go-pgs-parser/pgs"
+// PGS segment types
+const (
+	pgsSegmentPalette     = 0x14
+	pgsSegmentObject      = 0x15
+	pgsSegmentComposition = 0x16
+	pgsSegmentWindow      = 0x17
+	pgsSegmentEnd         = 0x80
 )
 
-func ParsePGSFile(filePath string) (subs []ImageSubtitle, err error) {
-	var currentSub *ImageSubtitle
-	err = pgs.NewPgsParser().ParseDisplaySets(filePath, func(data displaySet.DisplaySet, startTime time.Duration) error {
-		// Check if this display set contains an image or only metadata
-		imageData, err := data.ToImageData()
-		if err != nil {
-			return err
-		}
-		if imageData != nil {
-			// We got a new image so this should be the start of a new sub
-			if currentSub != nil {
-				// Previous sub didn't have an explicit end time, use this new sub's start time (minus 1ms) as its end time
-				currentSub.EndTime = startTime - time.Millisecond
-				subs = append(subs, *currentSub)
-			}
-			currentSub = &ImageSubtitle{
-				Image:     imageData.Image,
-				StartTime: startTime,
+// PGSDisplaySet is the content of the screen from its PTS. A display set without objects clears the screen.
+type PGSDisplaySet struct {
+	PTS           time.Duration
+	ScreenSize    image.Point
+	PaletteUpdate bool // only the palette changed since the previous display set
+	Objects       []ScreenObject
+}
+
+type pgsCompositionObject struct {
+	ObjectID uint16
+	WindowID byte
+	Position image.Point
+	Forced   bool
+	Crop     *image.Rectangle
+}
+
+type pgsComposition struct {
+	PTS           time.Duration
+	ScreenSize    image.Point
+	PaletteUpdate bool
+	PaletteID     byte
+	Objects       []pgsCompositionObject
+}
+
+type pgsObjectData struct {
+	Size image.Point
+	Data []byte // RLE encoded
+}
+
+// pgsDecoder builds the display sets from the PGS segments. Palettes, objects and windows are kept for
+// the whole epoch as display sets can reference the ones defined by previous display sets.
+type pgsDecoder struct {
+	palettes     map[byte]color.Palette
+	objects      map[uint16]*pgsObjectData
+	windows      map[byte]image.Rectangle
+	composition  *pgsComposition
+	onDisplaySet func(displaySet PGSDisplaySet) error
+	debug        bool // print the skipped segments
+}
+
+func newPGSDecoder(onDisplaySet func(displaySet PGSDisplaySet) error, debug bool) *pgsDecoder {
+	decoder := &pgsDecoder{onDisplaySet: onDisplaySet, debug: debug}
+	decoder.reset()
+	return decoder
+}
+
+func (decoder *pgsDecoder) reset() {
+	decoder.palettes = make(map[byte]color.Palette)
+	decoder.objects = make(map[uint16]*pgsObjectData)
+	decoder.windows = make(map[byte]image.Rectangle)
+}
+
+// decodeSegment handles a segment payload (without the segment header). Unknown segments are skipped: their
+// declared length already delimits them.
+func (decoder *pgsDecoder) decodeSegment(segmentType byte, pts time.Duration, data []byte) (err error) {
+	switch segmentType {
+	case pgsSegmentComposition:
+		return decoder.decodeComposition(pts, data)
+	case pgsSegmentWindow:
+		return decoder.decodeWindows(data)
+	case pgsSegmentPalette:
+		return decoder.decodePalette(data)
+	case pgsSegmentObject:
+		return decoder.decodeObject(data)
+	case pgsSegmentEnd:
+		if decoder.composition == nil {
+			return
+		}
+		composition := decoder.composition
+		decoder.composition = nil
+		return decoder.buildDisplaySet(composition)
+	default:
+		if decoder.debug {
+			fmt.Printf("PGS: skipping the unknown segment type 0x%02x at %v (%d bytes)\n", segmentType, pts, len(data))
+		}
+		return
+	}
+}
+
+func (decoder *pgsDecoder) decodeComposition(pts time.Duration, data []byte) (err error) {
+	if len(data) < 11 {
+		return errors.New("presentation composition segment too short")
+	}
+	if data[7] == 0x80 {
+		// epoch start: nothing from the previous epoch can be referenced anymore
+		decoder.reset()
+	}
+	composition := &pgsComposition{
+		PTS:           pts,
+		ScreenSize:    image.Pt(int(binary.BigEndian.Uint16(data[0:2])), int(binary.BigEndian.Uint16(data[2:4]))),
+		PaletteUpdate: data[8] == 0x80,
+		PaletteID:     data[9],
+		Objects:       make([]pgsCompositionObject, 0, data[10]),
+	}
+	offset := 11
+	for range int(data[10]) {
+		if len(data) < offset+8 {
+			return errors.New("presentation composition segment too short for its composition objects")
+		}
+		object := pgsCompositionObject{
+			ObjectID: binary.BigEndian.Uint16(data[offset : offset+2]),
+			WindowID: data[offset+2],
+			Forced:   data[offset+3]&0x40 != 0,
+			Position: image.Pt(int(binary.BigEndian.Uint16(data[offset+4:offset+6])), int(binary.BigEndian.Uint16(data[offset+6:offset+8]))),
+		}
+		offset += 8
+		if data[offset-5]&0x80 != 0 {
+			if len(data) < offset+8 {
+				return errors.New("presentation composition segment too short for its cropping")
 			}
+			crop := image.Rect(0, 0, int(binary.BigEndian.Uint16(data[offset+4:offset+6])), int(binary.BigEndian.Uint16(data[offset+6:offset+8]))).
+				Add(image.Pt(int(binary.BigEndian.Uint16(data[offset:offset+2])), int(binary.BigEndian.Uint16(data[offset+2:offset+4]))))
+			object.Crop = &crop
+			offset += 8
+		}
+		composition.Objects = append(composition.Objects, object)
+	}
+	decoder.composition = composition
+	return
+}
+
+func (decoder *pgsDecoder) decodeWindows(data []byte) (err error) {
+	if len(data) < 1 || len(data) < 1+int(data[0])*9 {
+		return errors.New("window definition segment too short")
+	}
+	for i := range int(data[0]) {
+		window := data[1+i*9 : 1+(i+1)*9]
+		decoder.windows[window[0]] = image.Rect(0, 0, int(binary.BigEndian.Uint16(window[5:7])), int(binary.BigEndian.Uint16(window[7:9]))).
+			Add(image.Pt(int(binary.BigEndian.Uint16(window[1:3])), int(binary.BigEndian.Uint16(window[3:5]))))
+	}
+	return
+}
+
+func (decoder *pgsDecoder) decodePalette(data []byte) (err error) {
+	if len(data) < 2 {
+		return errors.New("palette definition segment too short")
+	}
+	// Palettes are updated on a copy: the already decoded images must keep their colors
+	palette := make(color.Palette, 256)
+	if previous, found := decoder.palettes[data[0]]; found {
+		copy(palette, previous)
+	} else {
+		// undefined entries are fully transparent
+		for i := range palette {
+			palette[i] = color.NRGBA{}
+		}
+	}
+	decoder.palettes[data[0]] = palette
+	for entry := data[2:]; len(entry) >= 5; entry = entry[5:] {
+		palette[entry[0]] = yCrCbToNRGBA(entry[1], entry[2], entry[3], entry[4])
+	}
+	return
+}
+
+func (decoder *pgsDecoder) decodeObject(data []byte) (err error) {
+	if len(data) < 4 {
+		return errors.New("object definition segment too short")
+	}
+	objectID := binary.BigEndian.Uint16(data[0:2])
+	sequence := data[3]
+	if sequence&0x80 != 0 {
+		// first fragment: data length (3 bytes), width and height precede the RLE data
+		if len(data) < 11 {
+			return errors.New("object definition segment too short")
+		}
+		decoder.objects[objectID] = &pgsObjectData{
+			Size: image.Pt(int(binary.BigEndian.Uint16(data[7:9])), int(binary.BigEndian.Uint16(data[9:11]))),
+			Data: append([]byte(nil), data[11:]...),
+		}
+		return
+	}
+	object, found := decoder.objects[objectID]
+	if !found {
+		return fmt.Errorf("continuation fragment of the undefined object %d", objectID)
+	}
+	object.Data = append(object.Data, data[4:]...)
+	return
+}
+
+func (decoder *pgsDecoder) buildDisplaySet(composition *pgsComposition) (err error) {
+	displaySet := PGSDisplaySet{
+		PTS:           composition.PTS,
+		ScreenSize:    composition.ScreenSize,
+		PaletteUpdate: composition.PaletteUpdate,
+		Objects:       make([]ScreenObject, 0, len(composition.Objects)),
+	}
+	palette, found := decoder.palettes[composition.PaletteID]
+	if !found && len(composition.Objects) > 0 {
+		return fmt.Errorf("composition at %v references the undefined palette %d", composition.PTS, composition.PaletteID)
+	}
+	for _, compositionObject := range composition.Objects {
+		object, found := decoder.objects[compositionObject.ObjectID]
+		if !found {
+			return fmt.Errorf("composition at %v references the undefined object %d", composition.PTS, compositionObject.ObjectID)
+		}
+		var img *image.Paletted
+		if img, err = pgsDecodeRLE(object.Size, object.Data, palette); err != nil {
+			err = fmt.Errorf("failed to decode object %d at %v: %w", compositionObject.ObjectID, composition.PTS, err)
+			return
+		}
+		if compositionObject.Crop != nil {
+			img = img.SubImage(*compositionObject.Crop).(*image.Paletted)
+		}
+		displaySet.Objects = append(displaySet.Objects, ScreenObject{
+			Image:  img,
+			Screen: img.Bounds().Sub(img.Bounds().Min).Add(compositionObject.Position),
+			Window: decoder.windows[compositionObject.WindowID],
+			Forced: compositionObject.Forced,
+		})
+	}
+	// Screen order: top to bottom, then left to right
+	sort.SliceStable(displaySet.Objects, func(i, j int) bool {
+		if displaySet.Objects[i].Screen.Min.Y != displaySet.Objects[j].Screen.Min.Y {
+			return displaySet.Objects[i].Screen.Min.Y < displaySet.Objects[j].Screen.Min.Y
+		}
+		return displaySet.Objects[i].Screen.Min.X < displaySet.Objects[j].Screen.Min.X
+	})
+	return decoder.onDisplaySet(displaySet)
+}
+
+// pgsDecodeRLE decodes the run length encoded pixels of an object
+func pgsDecodeRLE(size image.Point, data []byte, palette color.Palette) (img *image.Paletted, err error) {
+	img = image.NewPaletted(image.Rectangle{Max: size}, palette)
+	var x, y int
+	for index := 0; index < len(data); {
+		var (
+			runLength  int
+			colorIndex byte
+		)
+		if data[index] != 0 {
+			// CCCCCCCC: one pixel in color C
+			runLength, colorIndex = 1, data[index]
+			index++
 		} else {
-			// No image in this display set so it's should be the end of the previous one
-			if currentSub == nil {
-				fmt.Printf("WARNING: got an end time without a previous start time for a previous sub: skipping (current valid subs: %d)\n", len(subs))
-			} else {
-				currentSub.EndTime = startTime
-				subs = append(subs, *currentSub)
-				currentSub = nil
+			if index+1 >= len(data) {
+				return nil, errors.New("truncated run")
 			}
+			flags := data[index+1]
+			switch {
+			case flags == 0:
+				// 00000000 00000000: end of line
+				x, y = 0, y+1
+				index += 2
+				continue
+			case flags < 0x40:
+				// 00000000 00LLLLLL: L pixels in color 0
+				runLength = int(flags)
+				index += 2
+			case flags < 0x80:
+				// 00000000 01LLLLLL LLLLLLLL: L pixels in color 0
+				if index+2 >= len(data) {
+					return nil, errors.New("truncated run")
+				}
+				runLength = int(flags&0x3f)<<8 | int(data[index+2])
+				index += 3
+			case flags < 0xc0:
+				// 00000000 10LLLLLL CCCCCCCC: L pixels in color C
+				if index+2 >= len(data) {
+					return nil, errors.New("truncated run")
+				}
+				runLength, colorIndex = int(flags&0x3f), data[index+2]
+				index += 3
+			default:
+				// 00000000 11LLLLLL LLLLLLLL CCCCCCCC: L pixels in color C
+				if index+3 >= len(data) {
+					return nil, errors.New("truncated run")
+				}
+				runLength, colorIndex = int(flags&0x3f)<<8|int(data[index+2]), data[index+3]
+				index += 4
+			}
+		}
+		if y >= size.Y {
+			// extra data after the last line, ignore it
+			break
+		}
+		for end := min(x+runLength, size.X); x < end; x++ {
+			img.Pix[y*img.Stride+x] = colorIndex
+		}
+	}
+	return
+}
+
+// readPGSSegments reads the segments of a .sup file (each segment has a "PG" header with its timestamps)
+func readPGSSegments(reader io.Reader, decoder *pgsDecoder) (err error) {
+	bufferedReader := bufio.NewReader(reader)
+	header := make([]byte, 13)
+	for {
+		if _, err = io.ReadFull(bufferedReader, header); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		if header[0] != 'P' || header[1] != 'G' {
+			return errors.New("invalid segment header magic number")
+		}
+		pts := time.Duration(binary.BigEndian.Uint32(header[2:6])) * time.Second / 90000
+		data := make([]byte, binary.BigEndian.Uint16(header[11:13]))
+		if _, err = io.ReadFull(bufferedReader, data); err != nil {
+			return fmt.Errorf("failed to read segment data: %w", err)
+		}
+		if err = decoder.decodeSegment(header[10], pts, data); err != nil {
+			return
 		}
+	}
+}
+
+// ParsePGSFile returns one subtitle per composition object, in screen order when several are displayed
+// at the same time (see ImageSubtitle.Region).
+func ParsePGSFile(filePath string, debug bool) (subs []ImageSubtitle, err error) {
+	fd, err := os.Open(filePath)
+	if err != nil {
+		err = fmt.Errorf("failed to open file: %w", err)
+		return
+	}
+	defer fd.Close()
+	var tracker screenTracker
+	decoder := newPGSDecoder(func(displaySet PGSDisplaySet) error {
+		tracker.display(displaySet.PTS, displaySet.ScreenSize, displaySet.Objects, displaySet.PaletteUpdate, 0)
 		return nil
-	})
+	}, debug)
+	err = readPGSSegments(fd, decoder)
+	tracker.finish()
+	subs = tracker.subs
 	return
 }
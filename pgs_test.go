@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pgsTestObject is a composition object of a synthetic presentation composition segment
+type pgsTestObject struct {
+	id     uint16
+	x, y   int
+	forced bool
+	crop   *image.Rectangle
+}
+
+func pgsTestComposition(epochStart, paletteUpdate bool, objects ...pgsTestObject) []byte {
+	data := []byte{0x07, 0x80, 0x04, 0x38, 0x10, 0x00, 0x01, 0x00, 0x00, 0x00, byte(len(objects))}
+	if epochStart {
+		data[7] = 0x80
+	}
+	if paletteUpdate {
+		data[8] = 0x80
+	}
+	for _, object := range objects {
+		var flags byte
+		if object.crop != nil {
+			flags |= 0x80
+		}
+		if object.forced {
+			flags |= 0x40
+		}
+		data = binary.BigEndian.AppendUint16(data, object.id)
+		data = append(data, 0, flags)
+		data = binary.BigEndian.AppendUint16(data, uint16(object.x))
+		data = binary.BigEndian.AppendUint16(data, uint16(object.y))
+		if object.crop != nil {
+			data = binary.BigEndian.AppendUint16(data, uint16(object.crop.Min.X))
+			data = binary.BigEndian.AppendUint16(data, uint16(object.crop.Min.Y))
+			data = binary.BigEndian.AppendUint16(data, uint16(object.crop.Dx()))
+			data = binary.BigEndian.AppendUint16(data, uint16(object.crop.Dy()))
+		}
+	}
+	return data
+}
+
+// pgsTestObjectDefinition returns a single fragment object definition segment
+func pgsTestObjectDefinition(id uint16, width, height int, rle []byte) []byte {
+	data := binary.BigEndian.AppendUint16(nil, id)
+	length := len(rle) + 4
+	data = append(data, 0, 0xc0, byte(length>>16), byte(length>>8), byte(length))
+	data = binary.BigEndian.AppendUint16(data, uint16(width))
+	data = binary.BigEndian.AppendUint16(data, uint16(height))
+	return append(data, rle...)
+}
+
+// pgsTestSegment returns a segment with its .sup header
+func pgsTestSegment(segmentType byte, pts time.Duration, data []byte) []byte {
+	segment := []byte{'P', 'G'}
+	segment = binary.BigEndian.AppendUint32(segment, uint32(pts*90000/time.Second))
+	segment = binary.BigEndian.AppendUint32(segment, 0)
+	segment = append(segment, segmentType)
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(data)))
+	return append(segment, data...)
+}
+
+var (
+	pgsTestWindow  = []byte{1, 0, 0x00, 0x00, 0x00, 0x00, 0x07, 0x80, 0x04, 0x38}
+	pgsTestPalette = []byte{0, 0, 1, 235, 128, 128, 255, 2, 16, 128, 128, 255}
+	// 4x2 object: first line in color 1, second line in color 2
+	pgsTestRLE = []byte{0x00, 0x84, 0x01, 0x00, 0x00, 0x00, 0x84, 0x02, 0x00, 0x00}
+)
+
+func TestPGSDecodeRLE(t *testing.T) {
+	rle := []byte{
+		0x05,       // 1 pixel in color 5
+		0x00, 0x03, // 3 pixels in color 0
+		0x00, 0x82, 0x07, // 2 pixels in color 7
+		0x00, 0xc0, 0x02, 0x09, // 2 pixels in color 9 (long run)
+		0x00, 0x00, // end of line
+		0x00, 0x40, 0x0a, // 10 pixels in color 0 (long run), clipped to the width
+		0x00, 0x00,
+		0x03, // after the last line, ignored
+	}
+	img, err := pgsDecodeRLE(image.Pt(8, 2), rle, color.Palette{color.Black})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{5, 0, 0, 0, 7, 7, 9, 9, 0, 0, 0, 0, 0, 0, 0, 0}
+	if !bytes.Equal(img.Pix, expected) {
+		t.Errorf("got %v, expected %v", img.Pix, expected)
+	}
+	if _, err = pgsDecodeRLE(image.Pt(8, 2), []byte{0x00, 0xc0, 0x02}, nil); err == nil {
+		t.Error("a truncated run must fail")
+	}
+}
+
+func TestPGSDecoder(t *testing.T) {
+	var displaySets []PGSDisplaySet
+	decoder := newPGSDecoder(func(displaySet PGSDisplaySet) error {
+		displaySets = append(displaySets, displaySet)
+		return nil
+	}, false)
+	decode := func(segmentType byte, pts time.Duration, data []byte) {
+		t.Helper()
+		if err := decoder.decodeSegment(segmentType, pts, data); err != nil {
+			t.Fatalf("segment 0x%02x at %v: %s", segmentType, pts, err)
+		}
+	}
+	crop := image.Rect(1, 0, 3, 1)
+	// Two objects in one composition, the second one cropped and forced
+	decode(pgsSegmentComposition, time.Second, pgsTestComposition(true, false,
+		pgsTestObject{id: 0, x: 100, y: 900},
+		pgsTestObject{id: 1, x: 200, y: 50, forced: true, crop: &crop},
+	))
+	decode(pgsSegmentWindow, time.Second, pgsTestWindow)
+	decode(pgsSegmentPalette, time.Second, pgsTestPalette)
+	decode(pgsSegmentObject, time.Second, pgsTestObjectDefinition(0, 4, 2, pgsTestRLE))
+	decode(pgsSegmentObject, time.Second, pgsTestObjectDefinition(1, 4, 2, pgsTestRLE))
+	decode(pgsSegmentEnd, time.Second, nil)
+	// Palette only update: the objects of the epoch are reused
+	decode(pgsSegmentComposition, 2*time.Second, pgsTestComposition(false, true, pgsTestObject{id: 0, x: 100, y: 900}))
+	decode(pgsSegmentPalette, 2*time.Second, []byte{0, 1, 1, 16, 128, 128, 255})
+	decode(pgsSegmentEnd, 2*time.Second, nil)
+	// Screen cleared
+	decode(pgsSegmentComposition, 3*time.Second, pgsTestComposition(false, false))
+	decode(pgsSegmentEnd, 3*time.Second, nil)
+	// Unknown segments are skipped
+	decode(0x18, 3*time.Second, []byte{1, 2, 3})
+
+	if len(displaySets) != 3 {
+		t.Fatalf("got %d display sets, expected 3", len(displaySets))
+	}
+	white, black := yCrCbToNRGBA(235, 128, 128, 255), yCrCbToNRGBA(16, 128, 128, 255)
+
+	first := displaySets[0]
+	if first.PTS != time.Second || first.ScreenSize != image.Pt(1920, 1080) || len(first.Objects) != 2 {
+		t.Fatalf("unexpected first display set: %+v", first)
+	}
+	// screen order: the cropped object is at the top
+	cropped, bottom := first.Objects[0], first.Objects[1]
+	if cropped.Screen != image.Rect(200, 50, 202, 51) || !cropped.Forced {
+		t.Errorf("cropped object: got %v (forced %v), expected %v (forced)", cropped.Screen, cropped.Forced, image.Rect(200, 50, 202, 51))
+	}
+	if cropped.Image.Bounds() != crop {
+		t.Errorf("cropped image bounds: got %v, expected %v", cropped.Image.Bounds(), crop)
+	}
+	if bottom.Screen != image.Rect(100, 900, 104, 902) || bottom.Forced || bottom.Window != image.Rect(0, 0, 1920, 1080) {
+		t.Errorf("bottom object: got %v (forced %v, window %v)", bottom.Screen, bottom.Forced, bottom.Window)
+	}
+	if got := bottom.Image.At(0, 0); got != white {
+		t.Errorf("first line color: got %v, expected %v", got, white)
+	}
+	if got := bottom.Image.At(0, 1); got != black {
+		t.Errorf("second line color: got %v, expected %v", got, black)
+	}
+
+	second := displaySets[1]
+	if !second.PaletteUpdate || len(second.Objects) != 1 {
+		t.Fatalf("unexpected palette update display set: %+v", second)
+	}
+	if got := second.Objects[0].Image.At(0, 0); got != black {
+		t.Errorf("updated palette color: got %v, expected %v", got, black)
+	}
+	if got := bottom.Image.At(0, 0); got != white {
+		t.Errorf("the palette update changed an already decoded image: got %v, expected %v", got, white)
+	}
+
+	if third := displaySets[2]; third.PTS != 3*time.Second || len(third.Objects) != 0 {
+		t.Errorf("unexpected clear display set: %+v", third)
+	}
+
+	// A new epoch forgets the objects of the previous one
+	decode(pgsSegmentComposition, 4*time.Second, pgsTestComposition(true, false, pgsTestObject{id: 0, x: 100, y: 900}))
+	decode(pgsSegmentPalette, 4*time.Second, pgsTestPalette)
+	err := decoder.decodeSegment(pgsSegmentEnd, 4*time.Second, nil)
+	if err == nil || !strings.Contains(err.Error(), "undefined object") {
+		t.Errorf("got %v, expected an undefined object error", err)
+	}
+}
+
+func TestReadPGSSegments(t *testing.T) {
+	var file []byte
+	file = append(file, pgsTestSegment(pgsSegmentComposition, time.Second, pgsTestComposition(true, false, pgsTestObject{id: 0, x: 10, y: 20}))...)
+	file = append(file, pgsTestSegment(pgsSegmentWindow, time.Second, pgsTestWindow)...)
+	file = append(file, pgsTestSegment(0x18, time.Second, []byte{0xff, 0xff, 0xff, 0xff})...) // unknown
+	file = append(file, pgsTestSegment(pgsSegmentPalette, time.Second, pgsTestPalette)...)
+	file = append(file, pgsTestSegment(pgsSegmentObject, time.Second, pgsTestObjectDefinition(0, 4, 2, pgsTestRLE))...)
+	file = append(file, pgsTestSegment(pgsSegmentEnd, time.Second, nil)...)
+	file = append(file, pgsTestSegment(pgsSegmentComposition, 2*time.Second, pgsTestComposition(false, false))...)
+	file = append(file, pgsTestSegment(pgsSegmentEnd, 2*time.Second, nil)...)
+	var displaySets []PGSDisplaySet
+	decoder := newPGSDecoder(func(displaySet PGSDisplaySet) error {
+		displaySets = append(displaySets, displaySet)
+		return nil
+	}, false)
+	if err := readPGSSegments(bytes.NewReader(file), decoder); err != nil {
+		t.Fatal(err)
+	}
+	if len(displaySets) != 2 || len(displaySets[0].Objects) != 1 || displaySets[1].PTS != 2*time.Second {
+		t.Errorf("unexpected display sets: %+v", displaySets)
+	}
+	if err := readPGSSegments(bytes.NewReader([]byte("XX0123456789ab")), decoder); err == nil {
+		t.Error("an invalid magic number must fail")
+	}
+}
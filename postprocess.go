@@ -0,0 +1,71 @@
+package main
+
+import "fmt"
+
+// postProcessReport contains what the post processing passes did, printed once the output is written
+type postProcessReport struct {
+	Merges          []CueMerge
+	GlossaryMatches []GlossaryMatch
+	FixCounts       []int
+	TypographyCount int
+	Timing          []TimingAdjustment
+	SDHAnnotations  int
+	SDHDropped      int
+}
+
+// postProcess applies the text passes selected by the user on the OCR output. Text passes are applied in
+// place but merging cues returns a new slice. The timing pass depends on the final text: it is applied
+// once the SDH annotations are removed.
+func postProcess(srtSubs SRTSubtitles, cfg outputConfig) (processed SRTSubtitles, report postProcessReport) {
+	if cfg.Merge {
+		srtSubs, report.Merges = MergeCues(srtSubs, cfg.MergeGap)
+	}
+	if len(cfg.Glossary) > 0 {
+		report.GlossaryMatches = cfg.Glossary.Apply(srtSubs, cfg.GlossaryPolicy == GlossaryPolicyCorrect)
+	}
+	if len(cfg.FixRules) > 0 {
+		report.FixCounts = ApplyFixRules(srtSubs, cfg.FixRules, cfg.Fix)
+	}
+	if cfg.Typography != "" {
+		report.TypographyCount = ApplyTypography(srtSubs, cfg.Typography)
+	}
+	processed = srtSubs
+	return
+}
+
+// applyCueTextPasses applies the glossary, fix rules and typography on cues OCRed again. The cues are not
+// consecutive: the gap rule is skipped and their timings are kept as is.
+func applyCueTextPasses(srtSubs SRTSubtitles, cfg outputConfig) {
+	if len(cfg.Glossary) > 0 {
+		cfg.Glossary.Apply(srtSubs, cfg.GlossaryPolicy == GlossaryPolicyCorrect)
+	}
+	for _, rule := range cfg.FixRules {
+		if rule.Name != "gap" {
+			rule.Apply(srtSubs, cfg.Fix)
+		}
+	}
+	if cfg.Typography != "" {
+		ApplyTypography(srtSubs, cfg.Typography)
+	}
+}
+
+func (report postProcessReport) Print(srtSubs SRTSubtitles, cfg outputConfig) {
+	if cfg.Merge {
+		printCueMerges(srtSubs, report.Merges, cfg.Debug)
+	}
+	if len(cfg.Glossary) > 0 {
+		printGlossaryMatches(srtSubs, report.GlossaryMatches)
+	}
+	if len(cfg.FixRules) > 0 {
+		printFixRulesReport(cfg.FixRules, report.FixCounts)
+	}
+	if cfg.Typography != "" {
+		fmt.Printf("Typography (%s): %d subtitle(s) fixed\n", cfg.Typography, report.TypographyCount)
+	}
+	if cfg.Timing {
+		printTimingAdjustments(report.Timing, cfg.Debug)
+	}
+	if cfg.SDH != SDHKeep {
+		fmt.Printf("SDH: %d annotation(s) removed, %d cue(s) left empty dropped\n", report.SDHAnnotations, report.SDHDropped)
+	}
+}
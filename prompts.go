@@ -0,0 +1,122 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"text/template"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+//go:embed prompts/*.tmpl
+var promptPacks embed.FS
+
+const defaultLanguagePrompt = `{{- if .Language}}
+
+The subtitles are in {{.LanguageName}}.
+{{- end}}`
+
+// Prompts contains the rendered prompts sent to the model
+type Prompts struct {
+	System string
+	Italic string
+}
+
+// PromptData contains the variables available within the prompt templates
+type PromptData struct {
+	Language     string // language code as given by the user (eg. "fr")
+	LanguageName string // english name of the language (eg. "French")
+	TrackTitle   string
+	Glossary     []string
+}
+
+// NewPromptData fills the language name from its code
+func NewPromptData(languageCode, trackTitle string, glossary []string) (data PromptData) {
+	data = PromptData{
+		Language:   languageCode,
+		TrackTitle: trackTitle,
+		Glossary:   glossary,
+	}
+	if languageCode != "" {
+		if tag, err := language.Parse(languageCode); err == nil {
+			data.LanguageName = display.English.Languages().Name(tag)
+		}
+		if data.LanguageName == "" {
+			data.LanguageName = languageCode
+		}
+	}
+	return
+}
+
+// LoadPrompts renders the system and italic prompts. Empty file paths select the built-in templates.
+// The "language" template is provided by the bundled prompt pack of the language if any, it is used
+// by the built-in system prompt and can be used by custom ones with {{template "language" .}}.
+func LoadPrompts(systemFile, italicFile string, data PromptData) (prompts Prompts, err error) {
+	// Select the language prompt pack
+	languagePrompt := defaultLanguagePrompt
+	if data.Language != "" {
+		var pack []byte
+		pack, err = promptPacks.ReadFile("prompts/" + strings.ToLower(data.Language) + ".tmpl")
+		switch {
+		case err == nil:
+			languagePrompt = "\n\n" + strings.TrimSpace(string(pack))
+		case errors.Is(err, fs.ErrNotExist):
+			err = nil
+		default:
+			err = fmt.Errorf("failed to read the %q prompt pack: %w", data.Language, err)
+			return
+		}
+	}
+	// Render the prompts
+	if prompts.System, err = renderPrompt("system", systemPrompt, systemFile, languagePrompt, data); err != nil {
+		err = fmt.Errorf("failed to render the system prompt: %w", err)
+		return
+	}
+	if prompts.Italic, err = renderPrompt("italic", italicPrompt, italicFile, languagePrompt, data); err != nil {
+		err = fmt.Errorf("failed to render the italic prompt: %w", err)
+		return
+	}
+	return
+}
+
+// PromptPacks returns the languages having a bundled prompt pack
+func PromptPacks() (languages []string) {
+	entries, _ := promptPacks.ReadDir("prompts")
+	for _, entry := range entries {
+		languages = append(languages, strings.TrimSuffix(entry.Name(), ".tmpl"))
+	}
+	return
+}
+
+func renderPrompt(name, builtin, file, languagePrompt string, data PromptData) (prompt string, err error) {
+	text := builtin
+	if file != "" {
+		var content []byte
+		if content, err = os.ReadFile(file); err != nil {
+			err = fmt.Errorf("failed to read prompt file: %w", err)
+			return
+		}
+		text = string(content)
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		err = fmt.Errorf("failed to parse template: %w", err)
+		return
+	}
+	if _, err = tmpl.New("language").Parse(languagePrompt); err != nil {
+		err = fmt.Errorf("failed to parse the language template: %w", err)
+		return
+	}
+	var rendered strings.Builder
+	if err = tmpl.ExecuteTemplate(&rendered, name, data); err != nil {
+		err = fmt.Errorf("failed to execute template: %w", err)
+		return
+	}
+	prompt = strings.TrimSpace(rendered.String())
+	return
+}
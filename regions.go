@@ -0,0 +1,57 @@
+package main
+
+import "strings"
+
+const (
+	RegionsCombine = "combine" // images displayed at the same time are combined into a single cue
+	RegionsSplit   = "split"   // each image is its own cue, positioned at the top of the screen if needed
+)
+
+// CombineRegions joins the cues of the images displayed at the same time into a single cue, their text in
+// screen order. Forced and regular images are never combined together. srtSubs must be the OCR output of
+// imgSubs (same indexes).
+func CombineRegions(srtSubs SRTSubtitles, imgSubs []ImageSubtitle) (combined SRTSubtitles) {
+	combined = make(SRTSubtitles, 0, len(srtSubs))
+	for index, sub := range srtSubs {
+		if index == 0 || imgSubs[index].Region == 0 || imgSubs[index].StartTime != imgSubs[index-1].StartTime ||
+			imgSubs[index].Forced != imgSubs[index-1].Forced {
+			combined = append(combined, sub)
+			continue
+		}
+		last := &combined[len(combined)-1]
+		if strings.TrimSpace(sub.Text) != "" {
+			if strings.TrimSpace(last.Text) != "" {
+				last.Text += "\n"
+			}
+			last.Text += sub.Text
+		}
+		if len(last.Candidates) == len(sub.Candidates) {
+			for i := range last.Candidates {
+				last.Candidates[i] = strings.TrimSpace(last.Candidates[i] + "\n" + sub.Candidates[i])
+			}
+		}
+		last.Disagreement = last.Disagreement || sub.Disagreement
+		if sub.Confidence != NoConfidence && (last.Confidence == NoConfidence || sub.Confidence < last.Confidence) {
+			last.Confidence = sub.Confidence
+		}
+		last.Sources = append(last.Sources, sub.Sources...)
+		last.PromptTokens += sub.PromptTokens
+		last.CompletionTokens += sub.CompletionTokens
+		last.Retries += sub.Retries
+	}
+	return
+}
+
+// PositionRegions flags the cues whose image is displayed in the top half of the screen
+func PositionRegions(srtSubs SRTSubtitles, imgSubs []ImageSubtitle) {
+	for index, imgSub := range imgSubs {
+		if imageOnTop(imgSub) {
+			srtSubs[index].Top = true
+		}
+	}
+}
+
+// imageOnTop returns true if the image is displayed in the top half of the screen
+func imageOnTop(imgSub ImageSubtitle) bool {
+	return imgSub.ScreenSize.Y > 0 && imgSub.Screen.Min.Y+imgSub.Screen.Dy()/2 < imgSub.ScreenSize.Y/2
+}
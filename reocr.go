@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CueSelection selects cues by their number (1 based) or by a time range
+type CueSelection struct {
+	Numbers [][2]int
+	Times   [][2]SRTTimestamp
+}
+
+// ParseCueSelection parses a comma separated list of cue numbers (12), cue numbers ranges (45-50) and time
+// ranges (00:10:00-00:12:00, milliseconds are optional)
+func ParseCueSelection(list string) (selection CueSelection, err error) {
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(item, "-")
+		if !isRange {
+			last = first
+		}
+		if strings.Contains(item, ":") {
+			var start, end SRTTimestamp
+			if !isRange {
+				return selection, fmt.Errorf("%q is not a time range", item)
+			}
+			if start, err = ParseSRTTimestamp(first); err != nil {
+				return
+			}
+			if end, err = ParseSRTTimestamp(last); err != nil {
+				return
+			}
+			if end < start {
+				return selection, fmt.Errorf("%q: the range end is before its start", item)
+			}
+			selection.Times = append(selection.Times, [2]SRTTimestamp{start, end})
+			continue
+		}
+		var start, end int
+		if start, err = strconv.Atoi(strings.TrimSpace(first)); err != nil || start < 1 {
+			return selection, fmt.Errorf("%q is not a cue number or range", item)
+		}
+		if end, err = strconv.Atoi(strings.TrimSpace(last)); err != nil || end < start {
+			return selection, fmt.Errorf("%q is not a cue number or range", item)
+		}
+		selection.Numbers = append(selection.Numbers, [2]int{start, end})
+	}
+	if len(selection.Numbers) == 0 && len(selection.Times) == 0 {
+		err = fmt.Errorf("no cue selected")
+	}
+	return
+}
+
+// Match returns true if the cue at index (0 based) is selected, time ranges select the cues overlapping them
+func (selection CueSelection) Match(index int, sub SRTSubtitle) bool {
+	for _, numbers := range selection.Numbers {
+		if index+1 >= numbers[0] && index+1 <= numbers[1] {
+			return true
+		}
+	}
+	for _, times := range selection.Times {
+		if sub.Start <= times[1] && sub.End >= times[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// PatchCues runs the OCR again on the images of the selected cues of an existing output and replaces their
+// text. The other cues, including their manual edits, are kept as is. The images of a cue are the ones
+// displayed in the middle of it (and at the same screen half if the regions were split). The new OCR output
+// goes through the same regions and merge passes as a full run, then the text post processing passes
+// (glossary, fix rules except gap, typography, SDH and empty cues policies) are applied to the new text.
+// The cues keep their images as sources, dropped contains the patched cues dropped by the empty cues policy.
+func PatchCues(ctx context.Context, existing SRTSubtitles, imgSubs []ImageSubtitle, selection CueSelection, nbWorkers int,
+	ocrConfig OCRConfig, outputCfg outputConfig) (patched, dropped SRTSubtitles, nbPatched int, err error) {
+	// Find the images of the cues, only the ones of the selected cues are OCRed again
+	var (
+		cueImages    = make([][]int, len(existing)) // cue index -> imgSubs indexes
+		selectedCues = make(map[int]bool)
+		selected     []int // imgSubs indexes to OCR again
+	)
+	for cueIndex, cue := range existing {
+		cueImages[cueIndex] = cueImageIndexes(cue, imgSubs, outputCfg.PGSObjects == RegionsSplit)
+		if !selection.Match(cueIndex, cue) {
+			continue
+		}
+		if len(cueImages[cueIndex]) == 0 {
+			fmt.Printf("WARNING: no image found for cue #%d %s --> %s, it is kept as is\n", cueIndex+1, cue.Start, cue.End)
+			continue
+		}
+		selectedCues[cueIndex] = true
+		selected = append(selected, cueImages[cueIndex]...)
+	}
+	if len(selected) == 0 {
+		return existing, nil, 0, fmt.Errorf("no image found for the selected cues")
+	}
+	// the regions pass expects the images in their original order
+	slices.Sort(selected)
+	selected = slices.Compact(selected)
+	selectedImages := make([]ImageSubtitle, len(selected))
+	for index, imgIndex := range selected {
+		selectedImages[index] = imgSubs[imgIndex]
+	}
+	fmt.Printf("Re-OCR of %d image(s) for %d cue(s)\n", len(selectedImages), len(selectedCues))
+	ocrSubs, _, _, err := OCR(ctx, selectedImages, nbWorkers, ocrConfig)
+	if err != nil {
+		err = fmt.Errorf("OCR failed: %w", err)
+		return
+	}
+	if outputCfg.PGSObjects == RegionsSplit {
+		PositionRegions(ocrSubs, selectedImages)
+	} else {
+		ocrSubs = CombineRegions(ocrSubs, selectedImages)
+	}
+	if outputCfg.Merge {
+		ocrSubs, _ = MergeCues(ocrSubs, outputCfg.MergeGap)
+	}
+	for index, ocrSub := range ocrSubs {
+		sources := make([]int, len(ocrSub.Sources))
+		for sourceIndex, source := range ocrSub.Sources {
+			sources[sourceIndex] = selected[source]
+		}
+		ocrSubs[index].Sources = sources
+	}
+	// Build the new cues with the existing timings and apply the text passes on them
+	newCues := make(SRTSubtitles, 0, len(selectedCues))
+	cueIndexes := make([]int, 0, len(selectedCues))
+	for cueIndex, cue := range existing {
+		if selectedCues[cueIndex] {
+			newCues = append(newCues, patchCue(cue, cueImages[cueIndex], ocrSubs))
+			cueIndexes = append(cueIndexes, cueIndex)
+		}
+	}
+	applyCueTextPasses(newCues, outputCfg)
+	if outputCfg.SDH != SDHKeep {
+		for index := range newCues {
+			newCues[index].Text, _ = stripSDHText(newCues[index].Text)
+		}
+	}
+	// Patch the existing cues
+	patchedCues := make(map[int]SRTSubtitle, len(newCues))
+	for index, cue := range newCues {
+		patchedCues[cueIndexes[index]] = cue
+	}
+	patched = make(SRTSubtitles, 0, len(existing))
+	for cueIndex, cue := range existing {
+		newCue, found := patchedCues[cueIndex]
+		if !found {
+			cue.Sources = cueImages[cueIndex]
+			patched = append(patched, cue)
+			continue
+		}
+		nbPatched++
+		fmt.Printf("#%d %s --> %s\n\tbefore: %q\n\tafter:  %q\n", cueIndex+1, cue.Start, cue.End, cue.Text, newCue.Text)
+		if strings.TrimSpace(newCue.Text) == "" {
+			switch outputCfg.Empty {
+			case EmptyDrop:
+				fmt.Println("\tempty: dropped")
+				dropped = append(dropped, newCue)
+				continue
+			case EmptyPlaceholder:
+				newCue.Text = outputCfg.EmptyText
+			}
+		}
+		patched = append(patched, newCue)
+	}
+	return
+}
+
+// patchOutput re-OCRs the selected cues of an existing output file and saves it
+func patchOutput(ctx context.Context, imgSubs []ImageSubtitle, selection CueSelection, nbWorkers int, ocrConfig OCRConfig,
+	outputCfg outputConfig, outputPath string) (result StreamResult, err error) {
+	existing, err := ParseSRTFile(outputPath)
+	if err != nil {
+		err = fmt.Errorf("failed to read the existing output: %w", err)
+		return
+	}
+	patched, dropped, nbPatched, err := PatchCues(ctx, existing, imgSubs, selection, nbWorkers, ocrConfig, outputCfg)
+	if err != nil {
+		return
+	}
+	if err = saveSRT(outputPath, patched); err != nil {
+		return
+	}
+	result.Cues = len(patched)
+	result.Images = imgSubs
+	result.Subtitles = patched
+	result.Dropped = dropped
+	if outputCfg.Empty == EmptyPlaceholder {
+		result.EmptyText = outputCfg.EmptyText
+	}
+	for _, sub := range slices.Concat(patched, dropped) {
+		result.PromptTokens += sub.PromptTokens
+		result.CompletionTokens += sub.CompletionTokens
+	}
+	fmt.Printf("%d cue(s) patched into %q\n", nbPatched, outputPath)
+	return
+}
+
+// cueImageIndexes returns the indexes of the images displayed in the middle of the cue, at the same screen
+// half if the regions were split
+func cueImageIndexes(cue SRTSubtitle, imgSubs []ImageSubtitle, split bool) (indexes []int) {
+	for imgIndex, imgSub := range imgSubs {
+		// the timing pass may have moved the cue edges a bit
+		if middle := SRTTimestamp(imgSub.StartTime+imgSub.EndTime) / 2; middle < cue.Start || middle >= cue.End {
+			continue
+		}
+		if split && imageOnTop(imgSub) != cue.Top {
+			continue
+		}
+		indexes = append(indexes, imgIndex)
+	}
+	return
+}
+
+// patchCue returns the cue with the text of the OCR cues built from its images (imgSubs indexes). Identical
+// consecutive texts are only kept once: the images of a cue built by merging cues carry the same line.
+func patchCue(cue SRTSubtitle, images []int, ocrSubs SRTSubtitles) SRTSubtitle {
+	texts := make([]string, 0, len(images))
+	cue.Sources = images
+	cue.Candidates = nil
+	cue.Disagreement = false
+	cue.Confidence = NoConfidence
+	cue.PromptTokens, cue.CompletionTokens, cue.Retries = 0, 0, 0
+	for _, ocrSub := range ocrSubs {
+		if !slices.ContainsFunc(ocrSub.Sources, func(source int) bool { return slices.Contains(images, source) }) {
+			continue
+		}
+		if text := strings.TrimSpace(ocrSub.Text); text != "" && (len(texts) == 0 || texts[len(texts)-1] != text) {
+			texts = append(texts, text)
+		}
+		cue.Top = cue.Top || ocrSub.Top
+		cue.Disagreement = cue.Disagreement || ocrSub.Disagreement
+		if ocrSub.Confidence != NoConfidence && (cue.Confidence == NoConfidence || ocrSub.Confidence < cue.Confidence) {
+			cue.Confidence = ocrSub.Confidence
+		}
+		cue.PromptTokens += ocrSub.PromptTokens
+		cue.CompletionTokens += ocrSub.CompletionTokens
+		cue.Retries += ocrSub.Retries
+	}
+	cue.Text = strings.Join(texts, "\n")
+	return cue
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"image"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPatchCue(t *testing.T) {
+	screen := image.Pt(1920, 1080)
+	bottom, top := image.Rect(0, 900, 1920, 1000), image.Rect(0, 50, 1920, 150)
+	imgSubs := []ImageSubtitle{
+		// a line displayed by two consecutive images, merged into a single cue
+		{StartTime: time.Second, EndTime: 2 * time.Second, Screen: bottom, ScreenSize: screen},
+		{StartTime: 2 * time.Second, EndTime: 3 * time.Second, Screen: bottom, ScreenSize: screen},
+		// a sign at the top and a dialogue at the bottom, displayed at the same time
+		{StartTime: 5 * time.Second, EndTime: 6 * time.Second, Screen: top, ScreenSize: screen},
+		{StartTime: 5 * time.Second, EndTime: 6 * time.Second, Screen: bottom, ScreenSize: screen, Region: 1},
+	}
+	ocrSubs := SRTSubtitles{
+		{Start: SRTTimestamp(time.Second), End: SRTTimestamp(2 * time.Second), Text: "Hello.", Sources: []int{0}, PromptTokens: 10, Confidence: 0.9},
+		{Start: SRTTimestamp(2 * time.Second), End: SRTTimestamp(3 * time.Second), Text: "Hello.", Sources: []int{1}, PromptTokens: 10, Confidence: 0.8},
+		{Start: SRTTimestamp(5 * time.Second), End: SRTTimestamp(6 * time.Second), Text: "EXIT", Sources: []int{2}, Confidence: NoConfidence},
+		{Start: SRTTimestamp(5 * time.Second), End: SRTTimestamp(6 * time.Second), Text: "This way.", Sources: []int{3}, Confidence: NoConfidence},
+	}
+	merged := SRTSubtitle{Start: SRTTimestamp(time.Second), End: SRTTimestamp(3 * time.Second), Text: "Helo."}
+	images := cueImageIndexes(merged, imgSubs, false)
+	if !reflect.DeepEqual(images, []int{0, 1}) {
+		t.Fatalf("got images %v, expected [0 1]", images)
+	}
+	cue := patchCue(merged, images, ocrSubs)
+	if cue.Text != "Hello." || cue.PromptTokens != 20 || cue.Confidence != 0.8 || !reflect.DeepEqual(cue.Sources, images) {
+		t.Errorf("merged cue: got %+v", cue)
+	}
+	// combined regions
+	combined := SRTSubtitle{Start: SRTTimestamp(5 * time.Second), End: SRTTimestamp(6 * time.Second)}
+	images = cueImageIndexes(combined, imgSubs, false)
+	if cue = patchCue(combined, images, CombineRegions(reocrTestCopy(ocrSubs), imgSubs)); cue.Text != "EXIT\nThis way." || cue.Top {
+		t.Errorf("combined regions: got %+v", cue)
+	}
+	// split regions: the top cue only gets the top image
+	splitSubs := reocrTestCopy(ocrSubs)
+	PositionRegions(splitSubs, imgSubs)
+	sign := SRTSubtitle{Start: SRTTimestamp(5 * time.Second), End: SRTTimestamp(6 * time.Second), Top: true}
+	images = cueImageIndexes(sign, imgSubs, true)
+	if cue = patchCue(sign, images, splitSubs); cue.Text != "EXIT" || !cue.Top || !reflect.DeepEqual(cue.Sources, []int{2}) {
+		t.Errorf("split regions: got %+v", cue)
+	}
+}
+
+// reocrTestCopy returns a copy of the cues, their sources included
+func reocrTestCopy(srtSubs SRTSubtitles) (copied SRTSubtitles) {
+	for _, sub := range srtSubs {
+		sub.Sources = append([]int(nil), sub.Sources...)
+		copied = append(copied, sub)
+	}
+	return
+}
+
+func TestApplyCueTextPasses(t *testing.T) {
+	rules, err := ParseFixRules("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := outputConfig{
+		Glossary:       Glossary{"Megumi Fushiguro"},
+		GlossaryPolicy: GlossaryPolicyCorrect,
+		FixRules:       rules,
+		Fix:            FixConfig{MaxLineLength: 42, MinGap: 100 * time.Millisecond},
+		Typography:     "fr",
+	}
+	// the cues are not consecutive: the gap rule does not change their timings
+	srtSubs := SRTSubtitles{
+		{Start: SRTTimestamp(time.Second), End: SRTTimestamp(3 * time.Second), Text: "Megumi  Fushiguru, wait!"},
+		{Start: SRTTimestamp(3 * time.Second), End: SRTTimestamp(4 * time.Second), Text: "Ready?"},
+	}
+	applyCueTextPasses(srtSubs, cfg)
+	if srtSubs[0].Text != "Megumi Fushiguro, wait"+narrowNbsp+"!" || srtSubs[1].Text != "Ready"+narrowNbsp+"?" {
+		t.Errorf("got texts %q and %q", srtSubs[0].Text, srtSubs[1].Text)
+	}
+	if srtSubs[0].End != SRTTimestamp(3*time.Second) {
+		t.Errorf("the first cue end changed to %s", srtSubs[0].End)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"html/template"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// reportTemplate is a self-contained HTML page: images are embedded and the filtering is done in place
+const reportTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} - OCR review</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; background: #f4f4f4; }
+table { border-collapse: collapse; width: 100%; background: #fff; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.4em; text-align: left; vertical-align: top; }
+th { background: #333; color: #fff; position: sticky; top: 0; }
+td.image { background: #777; }
+td.image img { display: block; max-width: 60vw; margin: 0.2em 0; }
+td.text { white-space: pre-wrap; font-size: 1.2em; }
+td.time, td.usage { white-space: nowrap; font-family: monospace; }
+tr.suspicious td.flags { background: #fdd; }
+body.suspicious-only tr.cue:not(.suspicious) { display: none; }
+.error { color: #b00; }
+.candidates { font-size: 0.9em; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Generated on {{.Date}}. <label><input type="checkbox" onchange="document.body.classList.toggle('suspicious-only', this.checked)"> Show suspicious lines only</label></p>
+{{- range .Streams}}
+<h2>Stream #{{.ID}}{{if .Language}} ({{.Language}}){{end}}</h2>
+<p>{{if .Error}}<span class="error">Failed: {{.Error}}</span> {{end}}{{len .Cues}} cue(s){{if .Dropped}} ({{.Dropped}} dropped){{end}}, {{.Suspicious}} suspicious. Tokens (prompt/generation): {{.PromptTokens}}/{{.CompletionTokens}}.{{if .OutputPath}} Output: {{.OutputPath}}{{end}}</p>
+{{- if .Cues}}
+<table>
+<tr><th>#</th><th>Time</th><th>Image</th><th>Text</th><th>Tokens</th><th>Retries</th><th>Flags</th></tr>
+{{- range .Cues}}
+<tr class="cue{{if .Flags}} suspicious{{end}}">
+<td>{{if .Number}}{{.Number}}{{else}}-{{end}}</td>
+<td class="time">{{.Start}}<br>{{.End}}</td>
+<td class="image">{{range .Images}}<img src="{{.}}">{{end}}</td>
+<td class="text">{{.Text}}</td>
+<td class="usage">{{.PromptTokens}}/{{.CompletionTokens}}</td>
+<td>{{.Retries}}</td>
+<td class="flags">{{range .Flags}}{{.}}<br>{{end}}{{if .Candidates}}<div class="candidates">{{range .Candidates}}{{.}}<br>{{end}}</div>{{end}}</td>
+</tr>
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`
+
+type reportPage struct {
+	Title   string
+	Date    string
+	Streams []reportStream
+}
+
+type reportStream struct {
+	ID               int
+	Language         string
+	OutputPath       string
+	Error            string
+	PromptTokens     int64
+	CompletionTokens int64
+	Suspicious       int
+	Dropped          int
+	Cues             []reportCue
+}
+
+type reportCue struct {
+	Number           int // output number, 0 if the cue was dropped
+	Start            SRTTimestamp
+	End              SRTTimestamp
+	Images           []template.URL
+	Text             string
+	PromptTokens     int64
+	CompletionTokens int64
+	Retries          int
+	Flags            []string // why the cue is suspicious
+	Candidates       []string // answer of each model when they disagreed
+}
+
+// WriteHTMLReport writes a review page listing each cue of the streams with its images and its text. The
+// suspicious cues (empty, retried, ensemble disagreement, among the lowCount lowest confidence) are flagged
+// and can be displayed alone. The empty cues dropped from the output are listed too.
+func WriteHTMLReport(filePath, title string, results []StreamResult, models []string, lowCount int) (err error) {
+	page := reportPage{
+		Title:   title,
+		Date:    time.Now().Format(time.DateTime),
+		Streams: make([]reportStream, 0, len(results)),
+	}
+	for _, result := range results {
+		stream := reportStream{
+			ID:               result.Stream.ID,
+			Language:         result.Stream.Language,
+			OutputPath:       result.OutputPath,
+			PromptTokens:     result.PromptTokens,
+			CompletionTokens: result.CompletionTokens,
+			Dropped:          len(result.Dropped),
+			Cues:             make([]reportCue, 0, len(result.Subtitles)+len(result.Dropped)),
+		}
+		if result.Err != nil {
+			stream.Error = strings.TrimSpace(result.Err.Error())
+		}
+		lowConfidence := make(map[int]bool, lowCount)
+		for _, index := range LowestConfidence(result.Subtitles, lowCount) {
+			lowConfidence[index] = true
+		}
+		for index, sub := range result.Subtitles {
+			var cue reportCue
+			if cue, err = newReportCue(sub, result, models); err != nil {
+				return
+			}
+			cue.Number = index + 1
+			if lowConfidence[index] {
+				cue.Flags = append(cue.Flags, fmt.Sprintf("low confidence (%.1f%%)", sub.Confidence*100))
+			}
+			stream.Cues = append(stream.Cues, cue)
+		}
+		for _, sub := range result.Dropped {
+			var cue reportCue
+			if cue, err = newReportCue(sub, result, models); err != nil {
+				return
+			}
+			cue.Flags = append(cue.Flags, "dropped")
+			stream.Cues = append(stream.Cues, cue)
+		}
+		slices.SortStableFunc(stream.Cues, func(a, b reportCue) int {
+			return cmp.Compare(a.Start, b.Start)
+		})
+		for _, cue := range stream.Cues {
+			if len(cue.Flags) > 0 {
+				stream.Suspicious++
+			}
+		}
+		page.Streams = append(page.Streams, stream)
+	}
+	tmpl, err := template.New("report").Parse(reportTemplate)
+	if err != nil {
+		return
+	}
+	fd, err := os.Create(filePath)
+	if err != nil {
+		err = fmt.Errorf("failed to create the report: %w", err)
+		return
+	}
+	defer fd.Close()
+	if err = tmpl.Execute(fd, page); err != nil {
+		err = fmt.Errorf("failed to write the report: %w", err)
+	}
+	return
+}
+
+// newReportCue returns the cue with its images and its flags, but the ones depending on the other cues
+func newReportCue(sub SRTSubtitle, result StreamResult, models []string) (cue reportCue, err error) {
+	cue = reportCue{
+		Start:            sub.Start,
+		End:              sub.End,
+		Images:           make([]template.URL, 0, len(sub.Sources)),
+		Text:             sub.Text,
+		PromptTokens:     sub.PromptTokens,
+		CompletionTokens: sub.CompletionTokens,
+		Retries:          sub.Retries,
+	}
+	for _, source := range sub.Sources {
+		var encodedImage string
+		if encodedImage, err = encodeImageToDataURL(result.Images[source].Image); err != nil {
+			err = fmt.Errorf("failed to encode image #%d: %w", source+1, err)
+			return
+		}
+		cue.Images = append(cue.Images, template.URL(encodedImage))
+	}
+	if strings.TrimSpace(sub.Text) == "" || (result.EmptyText != "" && sub.Text == result.EmptyText) {
+		cue.Flags = append(cue.Flags, "empty")
+	}
+	if sub.Retries > 0 {
+		cue.Flags = append(cue.Flags, fmt.Sprintf("%d retry(ies)", sub.Retries))
+	}
+	if sub.Disagreement {
+		cue.Flags = append(cue.Flags, "models disagreement")
+		for modelIndex, candidate := range sub.Candidates {
+			cue.Candidates = append(cue.Candidates, fmt.Sprintf("%s: %q", models[modelIndex], candidate))
+		}
+	}
+	return
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteHTMLReport(t *testing.T) {
+	img := image.NewPaletted(image.Rect(0, 0, 2, 2), color.Palette{color.Transparent, color.White})
+	result := StreamResult{
+		Stream: SubtitleStream{ID: 3, Language: "en"},
+		Images: []ImageSubtitle{{Image: img}, {Image: img}, {Image: img}},
+		Subtitles: SRTSubtitles{
+			{Start: SRTTimestamp(time.Second), End: SRTTimestamp(2 * time.Second), Text: "Reviewed line", Sources: []int{0}},
+			{Start: SRTTimestamp(5 * time.Second), End: SRTTimestamp(6 * time.Second), Text: "[...]", Sources: []int{2}},
+		},
+		Dropped:   SRTSubtitles{{Start: SRTTimestamp(3 * time.Second), End: SRTTimestamp(4 * time.Second), Sources: []int{1}}},
+		EmptyText: "[...]",
+	}
+	filePath := filepath.Join(t.TempDir(), "report.html")
+	if err := WriteHTMLReport(filePath, "test", []StreamResult{result}, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := string(data)
+	for _, expected := range []string{"3 cue(s) (1 dropped), 2 suspicious", "Reviewed line", "<td>-</td>", "empty<br>dropped<br>"} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("the report does not contain %q", expected)
+		}
+	}
+	// the dropped cue is listed in time order, between the written ones
+	if first, dropped, last := strings.Index(report, "<td>1</td>"), strings.Index(report, "<td>-</td>"), strings.Index(report, "<td>2</td>"); first > dropped || dropped > last {
+		t.Error("the cues are not sorted by time")
+	}
+}
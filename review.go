@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ReviewCues steps through the cues in the terminal: each one is displayed with its images and can be
+// accepted, edited or OCRed again with another model, the text passes of the outputs being applied on the new
+// text (see applyCueTextPasses). save is called after each change so the corrections
+// are kept even if the review is not finished.
+func ReviewCues(ctx context.Context, srtSubs SRTSubtitles, imgSubs []ImageSubtitle, cfg OCRConfig, outputCfg outputConfig,
+	input io.Reader, save func() error) (changes int, err error) {
+	reader := bufio.NewReader(input)
+	for index := 0; index < len(srtSubs); {
+		if ctx.Err() != nil {
+			// interrupted by the user, the changes are already saved
+			return
+		}
+		sub := &srtSubs[index]
+		fmt.Printf("\nCue %d/%d %s --> %s (images %s)\n", index+1, len(srtSubs), sub.Start, sub.End, formatSources(sub.Sources))
+		for _, source := range sub.Sources {
+			if err = PrintTerminalImage(os.Stdout, imgSubs[source].Image, outputCfg.ReviewGraphics); err != nil {
+				err = fmt.Errorf("failed to display image #%d: %w", source+1, err)
+				return
+			}
+		}
+		fmt.Printf("Text:\n%s\n", indentText(sub.Text))
+		fmt.Printf("[Enter] accept, [e] edit, [r <model>] OCR again (default %q), [p] previous, [q] quit review\n> ", cfg.Models[0])
+		var command string
+		if command, err = reader.ReadString('\n'); err != nil {
+			if errors.Is(err, io.EOF) {
+				// no more input: the remaining cues are kept as is
+				err = nil
+			}
+			return
+		}
+		action, argument, _ := strings.Cut(strings.TrimSpace(command), " ")
+		switch strings.ToLower(action) {
+		case "", "a":
+			index++
+			continue
+		case "p":
+			index = max(0, index-1)
+			continue
+		case "q":
+			return
+		case "e":
+			fmt.Println("New text, finish with an empty line (an empty first line keeps the current text):")
+			var lines []string
+			for {
+				var line string
+				if line, err = reader.ReadString('\n'); err != nil && !errors.Is(err, io.EOF) {
+					return
+				}
+				line = strings.TrimRight(line, "\r\n")
+				if line == "" {
+					break
+				}
+				lines = append(lines, line)
+				if err != nil {
+					break
+				}
+			}
+			err = nil
+			if len(lines) == 0 {
+				continue
+			}
+			sub.Text = strings.Join(lines, "\n")
+		case "r":
+			model := strings.TrimSpace(argument)
+			if model == "" {
+				model = cfg.Models[0]
+			}
+			fmt.Printf("OCR with %q...\n", model)
+			var text string
+			if text, err = reviewOCR(ctx, sub, imgSubs, cfg, model); err != nil {
+				fmt.Fprintf(os.Stderr, "OCR failed: %s\n", err)
+				err = nil
+				continue
+			}
+			reocred := SRTSubtitles{*sub}
+			reocred[0].Text = text
+			applyCueTextPasses(reocred, outputCfg)
+			sub.Text = reocred[0].Text
+		default:
+			fmt.Printf("Unknown command %q\n", action)
+			continue
+		}
+		// the cue has been changed: save right away and display it again
+		sub.Candidates = nil
+		sub.Disagreement = false
+		sub.Confidence = NoConfidence
+		changes++
+		if err = save(); err != nil {
+			return
+		}
+		fmt.Println("Outputs saved")
+	}
+	return
+}
+
+// reviewOCR extracts the text of the images of a cue with the given model, in screen order
+func reviewOCR(ctx context.Context, sub *SRTSubtitle, imgSubs []ImageSubtitle, cfg OCRConfig, model string) (text string, err error) {
+	texts := make([]string, 0, len(sub.Sources))
+	for _, source := range sub.Sources {
+		var (
+			sourceText              string
+			promptTokens, genTokens int64
+			retries                 int
+		)
+		if sourceText, _, promptTokens, genTokens, retries, err = ExtractText(ctx, cfg, model, imgSubs[source].Image, nil); err != nil {
+			return
+		}
+		sub.PromptTokens += promptTokens
+		sub.CompletionTokens += genTokens
+		sub.Retries += retries
+		if sourceText != "" {
+			texts = append(texts, sourceText)
+		}
+	}
+	text = strings.Join(texts, "\n")
+	return
+}
+
+func saveSRT(outputPath string, srtSubs SRTSubtitles) (err error) {
+	fd, err := os.Create(outputPath)
+	if err != nil {
+		err = fmt.Errorf("failed to save the SRT: %w", err)
+		return
+	}
+	defer fd.Close()
+	if err = srtSubs.Marshal(fd); err != nil {
+		err = fmt.Errorf("failed to save the SRT: %w", err)
+	}
+	return
+}
+
+func indentText(text string) string {
+	if text == "" {
+		return "\t(empty)"
+	}
+	return "\t" + strings.ReplaceAll(text, "\n", "\n\t")
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"time"
+)
+
+// ScreenObject is an image displayed on screen by a display set (PGS composition object, DVB region)
+type ScreenObject struct {
+	Image  *image.Paletted
+	Screen image.Rectangle // position of the image on the screen
+	Window image.Rectangle // window the image is displayed in
+	Forced bool
+}
+
+// screenTracker turns the successive states of the screen into timed subtitles, one per object
+type screenTracker struct {
+	subs    []ImageSubtitle
+	current []ImageSubtitle
+	timeout time.Duration // display timeout of the current subs, 0 if none
+}
+
+// display starts new subtitles with the objects now on screen. A palette only update (fades) keeps the
+// current subtitles with their most visible images and identical objects (refreshes) are ignored.
+func (tracker *screenTracker) display(pts time.Duration, screenSize image.Point, objects []ScreenObject,
+	paletteUpdate bool, timeout time.Duration) {
+	if len(objects) == 0 {
+		tracker.clear(pts)
+		return
+	}
+	if len(tracker.current) == len(objects) {
+		if paletteUpdate {
+			for i, object := range objects {
+				if screenOpacity(object.Image) > screenOpacity(tracker.current[i].Image.(*image.Paletted)) {
+					tracker.current[i].Image = object.Image
+				}
+			}
+			return
+		}
+		identical := true
+		for i, object := range objects {
+			if object.Screen != tracker.current[i].Screen || !sameScreenImage(object.Image, tracker.current[i].Image.(*image.Paletted)) {
+				identical = false
+				break
+			}
+		}
+		if identical {
+			return
+		}
+	}
+	// We got new images so this should be the start of new subs.
+	// Previous subs didn't have an explicit end time, use this new sub's start time (minus 1ms) as their end time.
+	tracker.end(pts - time.Millisecond)
+	tracker.current = make([]ImageSubtitle, len(objects))
+	for i, object := range objects {
+		tracker.current[i] = ImageSubtitle{
+			Image:      object.Image,
+			StartTime:  pts,
+			Screen:     object.Screen,
+			ScreenSize: screenSize,
+			Region:     i,
+			Forced:     object.Forced,
+		}
+	}
+	tracker.timeout = timeout
+}
+
+// clear ends the current subtitles: nothing is displayed anymore
+func (tracker *screenTracker) clear(pts time.Duration) {
+	if len(tracker.current) == 0 {
+		fmt.Printf("WARNING: got an end time without a previous start time for a previous sub: skipping (current valid subs: %d)\n", len(tracker.subs))
+	}
+	tracker.end(pts)
+}
+
+// finish ends the subtitles still displayed at the end of the stream with their timeout, the ones without
+// timeout are dropped as their end time is unknown
+func (tracker *screenTracker) finish() {
+	if tracker.timeout > 0 {
+		tracker.end(math.MaxInt64)
+	}
+	tracker.current = nil
+}
+
+func (tracker *screenTracker) end(pts time.Duration) {
+	for _, sub := range tracker.current {
+		sub.EndTime = pts
+		if tracker.timeout > 0 {
+			sub.EndTime = min(sub.EndTime, sub.StartTime+tracker.timeout)
+		}
+		tracker.subs = append(tracker.subs, sub)
+	}
+	tracker.current = nil
+}
+
+func sameScreenImage(a, b *image.Paletted) bool {
+	if a.Rect.Size() != b.Rect.Size() || len(a.Palette) != len(b.Palette) {
+		return false
+	}
+	for i := range a.Palette {
+		if a.Palette[i] != b.Palette[i] {
+			return false
+		}
+	}
+	for y := range a.Rect.Dy() {
+		rowA := a.Pix[a.PixOffset(a.Rect.Min.X, a.Rect.Min.Y+y):a.PixOffset(a.Rect.Max.X, a.Rect.Min.Y+y)]
+		rowB := b.Pix[b.PixOffset(b.Rect.Min.X, b.Rect.Min.Y+y):b.PixOffset(b.Rect.Max.X, b.Rect.Min.Y+y)]
+		if !bytes.Equal(rowA, rowB) {
+			return false
+		}
+	}
+	return true
+}
+
+// screenOpacity returns the sum of the alpha of the pixels of an image
+func screenOpacity(img *image.Paletted) (opacity int) {
+	alphas := make([]int, len(img.Palette))
+	for i, c := range img.Palette {
+		_, _, _, alpha := c.RGBA()
+		alphas[i] = int(alpha >> 8)
+	}
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for _, index := range img.Pix[img.PixOffset(img.Rect.Min.X, y):img.PixOffset(img.Rect.Max.X, y)] {
+			if int(index) < len(alphas) {
+				opacity += alphas[index]
+			}
+		}
+	}
+	return
+}
+
+// bitReader reads the bits of run length encoded bitmaps, most significant bit first
+type bitReader struct {
+	data []byte
+	bit  int
+}
+
+func (reader *bitReader) read(bits int) (value int) {
+	for range bits {
+		value <<= 1
+		if index := reader.bit / 8; index < len(reader.data) {
+			value |= int(reader.data[index]>>(7-reader.bit%8)) & 1
+		}
+		reader.bit++
+	}
+	return
+}
+
+func (reader *bitReader) align() {
+	reader.bit = (reader.bit + 7) / 8 * 8
+}
+
+func yCrCbToNRGBA(y, cr, cb, alpha byte) color.NRGBA {
+	clamp := func(value float64) uint8 {
+		return uint8(math.Max(0, math.Min(255, math.Floor(value))))
+	}
+	fy, fcr, fcb := float64(y), float64(cr)-128, float64(cb)-128
+	return color.NRGBA{
+		R: clamp(fy + 1.4075*fcr),
+		G: clamp(fy - 0.3455*fcb - 0.7169*fcr),
+		B: clamp(fy + 1.779*fcb),
+		A: alpha,
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	SDHKeep  = "keep"  // annotations are kept in the output
+	SDHStrip = "strip" // annotations are removed from the output
+	SDHBoth  = "both"  // annotations are removed from the output and a second SDH output keeps them
+	SDHLayer = "layer" // annotations are removed from the output and a second WebVTT output styles them
+)
+
+var (
+	// sound annotations: [DOOR SLAMS]
+	sdhAnnotationRegexp = regexp.MustCompile(`\[[^\]]*\]`)
+	// manner annotations: (sighs), see sdhIsAnnotation as parentheses are also used for dialogue asides
+	sdhParentheticalRegexp = regexp.MustCompile(`\(([^)\n]*)\)`)
+	// lines made of a single parenthetical
+	sdhParentheticalLineRegexp = regexp.MustCompile(`^(?:<i>|</i>|[-‐–—]|\s)*\([^)]*\)(?:<i>|</i>|\s)*$`)
+	// speaker labels at the beginning of a line (after an optional dialogue dash): JOHN:, MAN #2:, the
+	// colon may be preceded by a no-break space added by the French typography
+	sdhSpeakerRegexp = regexp.MustCompile(`(?m)^((?:<i>)?(?:[-‐–—] ?)?(?:<i>)?)(\p{Lu}[\p{Lu}\p{N} .'#-]*[\p{Lu}\p{N}][ \x{00a0}\x{202f}]?:)[ \t]*`)
+	// lines without any actual text left
+	sdhEmptyLineRegexp = regexp.MustCompile(`^(?:<i>|</i>|[-‐–—:]|\s)*$`)
+	// dialogue dash at the beginning of a line
+	sdhDashRegexp = regexp.MustCompile(`^((?:<i>)?)[-‐–—] ?`)
+)
+
+// StripSDH returns a copy of the subtitles without their hearing impaired annotations. Cues without
+// any text left are dropped. annotations is the total number of annotations removed.
+func StripSDH(srtSubs SRTSubtitles) (stripped SRTSubtitles, annotations, dropped int) {
+	stripped = make(SRTSubtitles, 0, len(srtSubs))
+	for _, sub := range srtSubs {
+		var removed int
+		if sub.Text, removed = stripSDHText(sub.Text); removed == 0 {
+			stripped = append(stripped, sub)
+			continue
+		}
+		annotations += removed
+		if sub.Text == "" {
+			dropped++
+			continue
+		}
+		stripped = append(stripped, sub)
+	}
+	return
+}
+
+func stripSDHText(text string) (stripped string, removed int) {
+	originalLines := strings.Split(text, "\n")
+	lines := make([]string, len(originalLines))
+	for index, line := range originalLines {
+		if sdhParentheticalLineRegexp.MatchString(line) && strings.ContainsFunc(sdhParentheticalRegexp.FindString(line), unicode.IsLetter) {
+			lines[index] = sdhParentheticalRegexp.ReplaceAllString(line, "")
+			removed++
+			continue
+		}
+		lines[index] = sdhParentheticalRegexp.ReplaceAllStringFunc(line, func(parenthetical string) string {
+			if !sdhIsAnnotation(parenthetical[1 : len(parenthetical)-1]) {
+				return parenthetical
+			}
+			removed++
+			return ""
+		})
+	}
+	text = strings.Join(lines, "\n")
+	removed += len(sdhAnnotationRegexp.FindAllStringIndex(text, -1)) + len(sdhSpeakerRegexp.FindAllStringIndex(text, -1))
+	if removed == 0 {
+		return text, 0
+	}
+	text = sdhAnnotationRegexp.ReplaceAllString(text, "")
+	text = sdhSpeakerRegexp.ReplaceAllString(text, "$1")
+	// Clean up the remaining lines
+	lines = strings.Split(fixSpaces(text), "\n")
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if !sdhEmptyLineRegexp.MatchString(line) {
+			kept = append(kept, line)
+		}
+	}
+	// A dialogue reduced to a single line is not a dialogue anymore
+	if len(kept) == 1 && len(originalLines) > 1 {
+		kept[0] = sdhDashRegexp.ReplaceAllString(kept[0], "$1")
+	}
+	stripped = fixItalicTags(strings.Join(kept, "\n"))
+	if sdhEmptyLineRegexp.MatchString(stripped) {
+		stripped = ""
+	}
+	return
+}
+
+// markSDHText wraps the hearing impaired annotations of a text in a WebVTT class span (<c.sdh>) so they
+// can be styled apart from the dialogue. The annotations are the ones stripSDHText removes.
+func markSDHText(text string) string {
+	lines := strings.Split(text, "\n")
+	for index, line := range lines {
+		wholeLine := sdhParentheticalLineRegexp.MatchString(line)
+		lines[index] = sdhParentheticalRegexp.ReplaceAllStringFunc(line, func(parenthetical string) string {
+			content := parenthetical[1 : len(parenthetical)-1]
+			if (wholeLine && strings.ContainsFunc(content, unicode.IsLetter)) || sdhIsAnnotation(content) {
+				return vttSDHOpen + parenthetical + vttSDHClose
+			}
+			return parenthetical
+		})
+	}
+	text = strings.Join(lines, "\n")
+	text = sdhAnnotationRegexp.ReplaceAllString(text, vttSDHOpen+"$0"+vttSDHClose)
+	return sdhSpeakerRegexp.ReplaceAllString(text, "$1"+vttSDHOpen+"$2"+vttSDHClose+" ")
+}
+
+// sdhIsAnnotation returns true if the content of a parenthetical within a line of dialogue is a manner
+// annotation: upper case ("(SIGHS)") or a single word ("(sighs)"). Longer asides ("(I think)") and
+// contents without letters ("(1984)") are dialogue.
+func sdhIsAnnotation(content string) bool {
+	content = strings.TrimSpace(content)
+	if !strings.ContainsFunc(content, unicode.IsLetter) {
+		return false
+	}
+	return strings.ToUpper(content) == content || len(strings.Fields(content)) == 1
+}
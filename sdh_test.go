@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+func TestStripSDHText(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    string
+		removed int
+	}{
+		{"[DOOR SLAMS] Who's there?", "Who's there?", 1},
+		{"(sighs) Fine.", "Fine.", 1},
+		{"Fine. (SIGHS HEAVILY)", "Fine.", 1},
+		{"(laughs nervously)\nYou got me.", "You got me.", 1},
+		{"- (laughs nervously)\n- You got me.", "You got me.", 1},
+		{"It's fine (I think).", "It's fine (I think).", 0},
+		{"JOHN: Come here.", "Come here.", 1},
+		{"(music)", "", 1},
+		{"He was born in (1984).", "He was born in (1984).", 0},
+		{"(1984)", "(1984)", 0},
+		{"JOHN\u00a0: Bonjour\u202f!", "Bonjour\u202f!", 1},
+		{"- MAN #2\u202f: Ici.", "- Ici.", 1},
+	}
+	for _, test := range tests {
+		got, removed := stripSDHText(test.text)
+		if got != test.want || removed != test.removed {
+			t.Errorf("stripSDHText(%q) = %q, %d; want %q, %d", test.text, got, removed, test.want, test.removed)
+		}
+	}
+}
+
+func TestStripSDHAfterTypography(t *testing.T) {
+	subs := SRTSubtitles{{Text: "JOHN: Bonjour !"}, {Text: "Bonjour !"}}
+	ApplyTypography(subs, "fr")
+	stripped, annotations, _ := StripSDH(subs[:1])
+	if annotations != 1 || len(stripped) != 1 || stripped[0].Text != subs[1].Text {
+		t.Errorf("got %+v with %d annotation(s) removed, want %q", stripped, annotations, subs[1].Text)
+	}
+}
+
+func TestMarkSDHText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"[DOOR SLAMS] Who's there?", "<c.sdh>[DOOR SLAMS]</c> Who's there?"},
+		{"- (laughs nervously)\n- JOHN: You got me.", "- <c.sdh>(laughs nervously)</c>\n- <c.sdh>JOHN:</c> You got me."},
+		{"It's fine (I think). (sighs)", "It's fine (I think). <c.sdh>(sighs)</c>"},
+		{"He was born in (1984).", "He was born in (1984)."},
+	}
+	for _, test := range tests {
+		if got := markSDHText(test.text); got != test.want {
+			t.Errorf("markSDHText(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
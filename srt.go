@@ -1,13 +1,20 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"io"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/text/encoding/unicode"
 )
 
+// srtTopTag positions a cue at the top center of the screen (ASS alignment override supported by most players)
+const srtTopTag = `{\an8}`
+
 type SRTSubtitles []SRTSubtitle
 
 func (subtitles SRTSubtitles) Marshal(output io.Writer) (err error) {
@@ -22,6 +29,11 @@ func (subtitles SRTSubtitles) Marshal(output io.Writer) (err error) {
 			return
 		}
 		// Text
+		if sub.Top {
+			if _, err = encoder.Write([]byte(srtTopTag)); err != nil {
+				return
+			}
+		}
 		if _, err = encoder.Write(fmt.Appendf(nil, "%s\n", sub.Text)); err != nil {
 			return
 		}
@@ -34,9 +46,29 @@ func (subtitles SRTSubtitles) Marshal(output io.Writer) (err error) {
 }
 
 type SRTSubtitle struct {
-	Start SRTTimestamp
-	End   SRTTimestamp
-	Text  string
+	Start  SRTTimestamp
+	End    SRTTimestamp
+	Text   string
+	Top    bool // displayed at the top of the screen
+	Forced bool // displayed even when subtitles are off
+	// OCR metadata (not written to the SRT file)
+	Candidates   []string // raw answer of each model in ensemble mode
+	Disagreement bool     // ensemble models did not agree, needs human review
+	Confidence   float64  // lowest token probability of the answer, NoConfidence if not available
+	Sources      []int    // indexes of the images the cue was extracted from
+	// OCR usage of the cue, summed over all its images, models and passes
+	PromptTokens     int64
+	CompletionTokens int64
+	Retries          int // OCR requests retried after an error
+}
+
+// formatSources returns the human readable (1 based) list of image indexes of a cue
+func formatSources(sources []int) string {
+	formatted := make([]string, len(sources))
+	for i, source := range sources {
+		formatted[i] = fmt.Sprintf("#%d", source+1)
+	}
+	return strings.Join(formatted, ", ")
 }
 
 type SRTTimestamp time.Duration
@@ -49,3 +81,95 @@ func (t SRTTimestamp) String() string {
 		time.Duration(t)%time.Second/time.Millisecond,
 	)
 }
+
+// ParseSRTTimestamp parses a HH:MM:SS,mmm timestamp, the milliseconds are optional and can also be separated
+// by a dot
+func ParseSRTTimestamp(value string) (t SRTTimestamp, err error) {
+	clock, fraction, _ := strings.Cut(strings.Replace(strings.TrimSpace(value), ".", ",", 1), ",")
+	parts := strings.Split(clock, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("%q is not a HH:MM:SS,mmm timestamp", value)
+	}
+	var values [4]int
+	for i, part := range append(parts, fraction) {
+		if i == 3 && part == "" {
+			break
+		}
+		if values[i], err = strconv.Atoi(part); err != nil || values[i] < 0 {
+			return 0, fmt.Errorf("%q is not a HH:MM:SS,mmm timestamp", value)
+		}
+	}
+	t = SRTTimestamp(time.Duration(values[0])*time.Hour + time.Duration(values[1])*time.Minute +
+		time.Duration(values[2])*time.Second + time.Duration(values[3])*time.Millisecond)
+	return
+}
+
+// UnmarshalSRT reads back a SRT file: the cues numbers are not kept (cues are numbered by their position)
+// and a leading top position tag sets Top. Only the UTF-8 encoding is supported.
+func UnmarshalSRT(input io.Reader) (subtitles SRTSubtitles, err error) {
+	scanner := bufio.NewScanner(input)
+	var (
+		lineNumber int
+		current    *SRTSubtitle
+		text       []string
+	)
+	flush := func() {
+		if current != nil {
+			current.Text = strings.Join(text, "\n")
+			if strings.HasPrefix(current.Text, srtTopTag) {
+				current.Text = strings.TrimPrefix(current.Text, srtTopTag)
+				current.Top = true
+			}
+			subtitles = append(subtitles, *current)
+		}
+		current, text = nil, nil
+	}
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if lineNumber == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		switch {
+		case current != nil && line == "":
+			flush()
+		case current != nil:
+			text = append(text, line)
+		case line == "":
+			// blank lines between cues
+		default:
+			// cue number then its timestamps
+			if _, convErr := strconv.Atoi(strings.TrimSpace(line)); convErr != nil || !scanner.Scan() {
+				return nil, fmt.Errorf("line %d: invalid cue number %q", lineNumber, line)
+			}
+			lineNumber++
+			start, end, found := strings.Cut(strings.TrimRight(scanner.Text(), "\r"), "-->")
+			if !found {
+				return nil, fmt.Errorf("line %d: invalid cue timestamps %q", lineNumber, scanner.Text())
+			}
+			current = &SRTSubtitle{Confidence: NoConfidence}
+			if current.Start, err = ParseSRTTimestamp(start); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			if current.End, err = ParseSRTTimestamp(end); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	flush()
+	return
+}
+
+// ParseSRTFile reads back a SRT file written by Marshal (or edited since)
+func ParseSRTFile(filePath string) (subtitles SRTSubtitles, err error) {
+	fd, err := os.Open(filePath)
+	if err != nil {
+		err = fmt.Errorf("failed to open file: %w", err)
+		return
+	}
+	defer fd.Close()
+	return UnmarshalSRT(fd)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// SubtitleStream is a subtitles track of the input file
+type SubtitleStream struct {
+	ID        int
+	Language  string // language code from the input metadata, empty if unknown
+	Subtitles []ImageSubtitle
+}
+
+// Forced returns true if all the subtitles of the stream are forced (forced only track)
+func (stream SubtitleStream) Forced() bool {
+	for _, sub := range stream.Subtitles {
+		if !sub.Forced {
+			return false
+		}
+	}
+	return len(stream.Subtitles) > 0
+}
+
+// SelectStreams keeps the streams matching a comma separated list of languages and/or of stream IDs.
+// Empty lists select every stream.
+func SelectStreams(streams map[int]SubtitleStream, languages, ids string) (selected map[int]SubtitleStream, err error) {
+	selectedLanguages := make(map[string]bool)
+	for _, language := range strings.Split(languages, ",") {
+		if language = normalizeLanguageCode(language); language != "" {
+			selectedLanguages[language] = true
+		}
+	}
+	selectedIDs := make(map[int]bool)
+	for _, id := range strings.Split(ids, ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+		var value int
+		if value, err = strconv.Atoi(id); err != nil {
+			err = fmt.Errorf("invalid stream ID %q: %w", id, err)
+			return
+		}
+		selectedIDs[value] = true
+	}
+	if len(selectedLanguages) == 0 && len(selectedIDs) == 0 {
+		return streams, nil
+	}
+	selected = make(map[int]SubtitleStream, len(streams))
+	for id, stream := range streams {
+		if selectedIDs[id] || selectedLanguages[normalizeLanguageCode(stream.Language)] {
+			selected[id] = stream
+		}
+	}
+	if len(selected) == 0 {
+		err = fmt.Errorf("no stream matches the selection (available: %s)", describeStreams(streams))
+	}
+	return
+}
+
+// StreamOutputPaths returns the output path of each stream: file.<lang>[.forced].srt, the stream ID is
+// added if several streams would share the same name. A single stream without language nor forced flag
+// uses the output path as is.
+func StreamOutputPaths(outputPath string, streams map[int]SubtitleStream, forcedOnly bool) (paths map[int]string) {
+	base := strings.TrimSuffix(outputPath, filepath.Ext(outputPath))
+	extension := filepath.Ext(outputPath)
+	paths = make(map[int]string, len(streams))
+	names := make(map[string]int, len(streams))
+	suffixes := make(map[int][2]string, len(streams))
+	for id, stream := range streams {
+		var language, forced string
+		if stream.Language != "" {
+			language = "." + stream.Language
+		} else if len(streams) > 1 {
+			language = fmt.Sprintf("_stream-%d", id)
+		}
+		if forcedOnly || stream.Forced() {
+			forced = ".forced"
+		}
+		suffixes[id] = [2]string{language, forced}
+		names[language+forced]++
+	}
+	for id, suffix := range suffixes {
+		switch {
+		case suffix[0] == "" && suffix[1] == "":
+			paths[id] = outputPath
+		case names[suffix[0]+suffix[1]] > 1:
+			paths[id] = fmt.Sprintf("%s%s.%d%s%s", base, suffix[0], id, suffix[1], extension)
+		default:
+			paths[id] = base + suffix[0] + suffix[1] + extension
+		}
+	}
+	return
+}
+
+// StreamResult is the outcome of the processing of a stream
+type StreamResult struct {
+	Stream           SubtitleStream
+	OutputPath       string
+	Cues             int
+	PromptTokens     int64
+	CompletionTokens int64
+	Duration         time.Duration // OCR duration
+	Skipped          bool          // nothing to OCR
+	Err              error
+	// Review data: the OCRed images, the cues written (once reviewed) and the empty cues dropped from them
+	Images    []ImageSubtitle
+	Subtitles SRTSubtitles
+	Dropped   SRTSubtitles
+	EmptyText string // placeholder written for the empty cues
+}
+
+func printStreamsSummary(results []StreamResult) {
+	fmt.Println("Streams summary:")
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "\tStream\tLanguage\tCues\tTokens (prompt/generation)\tDuration\tOutput\tStatus")
+	for _, result := range results {
+		language := result.Stream.Language
+		if language == "" {
+			language = "-"
+		}
+		status := "success"
+		switch {
+		case result.Err != nil:
+			status = "failed: " + strings.TrimSpace(result.Err.Error())
+		case result.Skipped:
+			status = "skipped: nothing to OCR"
+		}
+		fmt.Fprintf(table, "\t#%d\t%s\t%d\t%d/%d\t%v\t%s\t%s\n",
+			result.Stream.ID, language, result.Cues, result.PromptTokens, result.CompletionTokens,
+			result.Duration.Round(time.Second), result.OutputPath, status,
+		)
+	}
+	table.Flush()
+}
+
+// sortedStreamIDs returns the streams IDs in ascending order
+func sortedStreamIDs(streams map[int]SubtitleStream) (ids []int) {
+	ids = make([]int, 0, len(streams))
+	for id := range streams {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return
+}
+
+// ISO 639-2 bibliographic codes, the base package only knows the terminology ones
+var languageBibliographicCodes = map[string]string{
+	"alb": "sq", "arm": "hy", "baq": "eu", "bur": "my", "chi": "zh", "cze": "cs", "dut": "nl", "fre": "fr",
+	"geo": "ka", "ger": "de", "gre": "el", "ice": "is", "mac": "mk", "may": "ms", "per": "fa", "rum": "ro",
+	"slo": "sk", "tib": "bo", "wel": "cy",
+}
+
+// normalizeLanguageCode returns the shortest code of a language (ISO 639-1 when it exists) so "fra", "fre"
+// and "fr" are the same language
+func normalizeLanguageCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if short, found := languageBibliographicCodes[code]; found {
+		return short
+	}
+	if base, err := language.ParseBase(code); err == nil && base.String() != "und" {
+		return base.String()
+	}
+	return code
+}
+
+func describeStreams(streams map[int]SubtitleStream) string {
+	ids := sortedStreamIDs(streams)
+	descriptions := make([]string, 0, len(streams))
+	for _, id := range ids {
+		stream := streams[id]
+		language := stream.Language
+		if language == "" {
+			language = "unknown language"
+		}
+		descriptions = append(descriptions, fmt.Sprintf("#%d %s", id, language))
+	}
+	return strings.Join(descriptions, ", ")
+}
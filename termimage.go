@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	GraphicsAuto  = "auto"  // detected from the terminal environment
+	GraphicsKitty = "kitty" // kitty graphics protocol (kitty, WezTerm, Ghostty, Konsole)
+	GraphicsSixel = "sixel" // DEC sixel graphics (foot, mlterm, xterm -ti vt340, Windows Terminal)
+	GraphicsASCII = "ascii" // characters ramp, works everywhere
+
+	termImageMaxWidth = 960 // pixels, larger images are downscaled for sixel
+	termASCIIWidth    = 100 // characters
+	kittyChunkSize    = 4096
+)
+
+// termBackground is the color transparent pixels are drawn on, subtitles are usually light with a dark outline
+var termBackground = color.NRGBA{R: 0x40, G: 0x40, B: 0x40, A: 0xff}
+
+// DetectTerminalGraphics guesses the graphics protocol supported by the terminal from its environment
+// variables: querying the terminal would need it in raw mode.
+func DetectTerminalGraphics() string {
+	term := strings.ToLower(os.Getenv("TERM"))
+	termProgram := strings.ToLower(os.Getenv("TERM_PROGRAM"))
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "" || strings.Contains(term, "kitty") || strings.Contains(term, "ghostty") ||
+		termProgram == "wezterm" || termProgram == "ghostty" || os.Getenv("KONSOLE_VERSION") != "":
+		return GraphicsKitty
+	case strings.Contains(term, "sixel") || strings.HasPrefix(term, "foot") || strings.HasPrefix(term, "mlterm") ||
+		os.Getenv("WT_SESSION") != "":
+		return GraphicsSixel
+	default:
+		return GraphicsASCII
+	}
+}
+
+// PrintTerminalImage renders an image in the terminal with the given graphics protocol
+func PrintTerminalImage(output io.Writer, img image.Image, graphics string) (err error) {
+	switch graphics {
+	case GraphicsKitty:
+		err = printKittyImage(output, img)
+	case GraphicsSixel:
+		err = printSixelImage(output, flattenImage(scaleImage(img, termImageMaxWidth)))
+	default:
+		err = printASCIIImage(output, flattenImage(scaleImage(img, termASCIIWidth)))
+	}
+	return
+}
+
+// printKittyImage transmits the image as PNG, in chunks as required by the protocol
+func printKittyImage(output io.Writer, img image.Image) (err error) {
+	var data bytes.Buffer
+	if err = png.Encode(&data, img); err != nil {
+		return
+	}
+	encoded := base64.StdEncoding.EncodeToString(data.Bytes())
+	for offset := 0; offset < len(encoded); offset += kittyChunkSize {
+		chunk := encoded[offset:min(offset+kittyChunkSize, len(encoded))]
+		more := 0
+		if offset+kittyChunkSize < len(encoded) {
+			more = 1
+		}
+		if offset == 0 {
+			_, err = fmt.Fprintf(output, "\x1b_Ga=T,f=100,m=%d;%s\x1b\\", more, chunk)
+		} else {
+			_, err = fmt.Fprintf(output, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+		if err != nil {
+			return
+		}
+	}
+	_, err = fmt.Fprintln(output)
+	return
+}
+
+// printSixelImage quantizes the image to a 256 colors palette and encodes it by bands of 6 pixels rows
+func printSixelImage(output io.Writer, img image.Image) (err error) {
+	bounds := img.Bounds()
+	paletted := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), palette.Plan9)
+	draw.FloydSteinberg.Draw(paletted, paletted.Rect, img, bounds.Min)
+	var sixel bytes.Buffer
+	fmt.Fprintf(&sixel, "\x1bPq\"1;1;%d;%d", paletted.Rect.Dx(), paletted.Rect.Dy())
+	for index, entry := range paletted.Palette {
+		r, g, b, _ := entry.RGBA()
+		fmt.Fprintf(&sixel, "#%d;2;%d;%d;%d", index, r*100/0xffff, g*100/0xffff, b*100/0xffff)
+	}
+	width := paletted.Rect.Dx()
+	bands := make([]byte, width)
+	for top := 0; top < paletted.Rect.Dy(); top += 6 {
+		used := make([]bool, len(paletted.Palette))
+		for y := top; y < min(top+6, paletted.Rect.Dy()); y++ {
+			for x := range width {
+				used[paletted.ColorIndexAt(x, y)] = true
+			}
+		}
+		first := true
+		for colorIndex, isUsed := range used {
+			if !isUsed {
+				continue
+			}
+			for x := range width {
+				bands[x] = 0
+				for bit := range 6 {
+					if top+bit < paletted.Rect.Dy() && int(paletted.ColorIndexAt(x, top+bit)) == colorIndex {
+						bands[x] |= 1 << bit
+					}
+				}
+			}
+			if !first {
+				sixel.WriteByte('$') // back to the start of the band for the next color
+			}
+			first = false
+			fmt.Fprintf(&sixel, "#%d", colorIndex)
+			// run length encoded
+			for x := 0; x < width; {
+				run := 1
+				for x+run < width && bands[x+run] == bands[x] {
+					run++
+				}
+				if run > 3 {
+					fmt.Fprintf(&sixel, "!%d%c", run, 63+bands[x])
+				} else {
+					sixel.Write(bytes.Repeat([]byte{63 + bands[x]}, run))
+				}
+				x += run
+			}
+		}
+		sixel.WriteByte('-')
+	}
+	sixel.WriteString("\x1b\\\n")
+	_, err = output.Write(sixel.Bytes())
+	return
+}
+
+// printASCIIImage draws the image with one character per pixel column and two pixel rows (characters are
+// about twice as high as wide)
+func printASCIIImage(output io.Writer, img image.Image) (err error) {
+	const ramp = " .:-=+*#%@"
+	bounds := img.Bounds()
+	background := float64(termBackground.R) / 0xff
+	var text strings.Builder
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += 2 {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			var luminance float64
+			rows := 0
+			for row := y; row < min(y+2, bounds.Max.Y); row++ {
+				luminance += float64(color.GrayModel.Convert(img.At(x, row)).(color.Gray).Y) / 0xff
+				rows++
+			}
+			// the background is the darkest level
+			level := max(0, luminance/float64(rows)-background) / (1 - background)
+			text.WriteByte(ramp[min(len(ramp)-1, int(level*float64(len(ramp))))])
+		}
+		text.WriteByte('\n')
+	}
+	_, err = io.WriteString(output, text.String())
+	return
+}
+
+// flattenImage draws the image over the terminal background
+func flattenImage(img image.Image) image.Image {
+	flat := image.NewNRGBA(img.Bounds())
+	draw.Draw(flat, flat.Rect, image.NewUniform(termBackground), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Rect, img, img.Bounds().Min, draw.Over)
+	return flat
+}
+
+// scaleImage downscales (nearest neighbor) the image to maxWidth pixels if it is wider
+func scaleImage(img image.Image, maxWidth int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= maxWidth {
+		return img
+	}
+	height := max(1, bounds.Dy()*maxWidth/bounds.Dx())
+	scaled := image.NewNRGBA(image.Rect(0, 0, maxWidth, height))
+	for y := range height {
+		for x := range maxWidth {
+			scaled.Set(x, y, img.At(bounds.Min.X+x*bounds.Dx()/maxWidth, bounds.Min.Y+y*bounds.Dy()/height))
+		}
+	}
+	return scaled
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// TimingConfig holds the parameters of the timing pass. Zero values disable the matching rule.
+type TimingConfig struct {
+	MinDuration    time.Duration // absolute minimum display duration
+	CharsPerSecond float64       // reading speed used to compute the minimum display duration of each cue
+	MaxDuration    time.Duration
+	MinGap         time.Duration
+	FrameRate      float64 // timestamps are snapped to the frames of this frame rate
+}
+
+// TimingAdjustment describes a timing change made on a subtitle
+type TimingAdjustment struct {
+	Index            int
+	Rule             string
+	OldStart, OldEnd SRTTimestamp
+	NewStart, NewEnd SRTTimestamp
+}
+
+func (ta TimingAdjustment) String() string {
+	return fmt.Sprintf("#%d %s: %s --> %s changed to %s --> %s",
+		ta.Index+1, ta.Rule, ta.OldStart, ta.OldEnd, ta.NewStart, ta.NewEnd)
+}
+
+// ApplyTiming fixes the subtitles timings in place: frame snapping, overlaps, maximum duration, minimum
+// duration (without creating overlaps) and minimum gap, in this order. Snapping comes first so it can not
+// break the gaps afterwards: the edges moved by the other rules are rounded down to a frame.
+func ApplyTiming(srtSubs SRTSubtitles, cfg TimingConfig) (adjustments []TimingAdjustment) {
+	adjust := func(index int, rule string, start, end SRTTimestamp) {
+		if start == srtSubs[index].Start && end == srtSubs[index].End {
+			return
+		}
+		adjustments = append(adjustments, TimingAdjustment{
+			Index:    index,
+			Rule:     rule,
+			OldStart: srtSubs[index].Start,
+			OldEnd:   srtSubs[index].End,
+			NewStart: start,
+			NewEnd:   end,
+		})
+		srtSubs[index].Start = start
+		srtSubs[index].End = end
+	}
+	floor := timingFloor(cfg.FrameRate)
+	// Frame snapping
+	if cfg.FrameRate > 0 {
+		frame := float64(time.Second) / cfg.FrameRate
+		snap := func(ts SRTTimestamp) SRTTimestamp {
+			return SRTTimestamp(math.Round(float64(ts)/frame) * frame)
+		}
+		for index, sub := range srtSubs {
+			start, end := snap(sub.Start), snap(sub.End)
+			if end <= start {
+				end = snap(start + SRTTimestamp(frame))
+			}
+			adjust(index, "frame snapping", start, end)
+		}
+	}
+	// Overlaps and inverted timestamps
+	for index, sub := range srtSubs {
+		end := sub.End
+		if end < sub.Start {
+			end = sub.Start
+		}
+		if next := timingNext(srtSubs, index); next != -1 && end > srtSubs[next].Start {
+			if end = floor(srtSubs[next].Start - SRTTimestamp(cfg.MinGap)); end <= sub.Start {
+				// the gap can not be kept: the cues touch rather than collapsing this one to nothing
+				end = srtSubs[next].Start
+			}
+		}
+		adjust(index, "overlap", sub.Start, end)
+	}
+	// Maximum duration
+	if cfg.MaxDuration > 0 {
+		for index, sub := range srtSubs {
+			if sub.End-sub.Start > SRTTimestamp(cfg.MaxDuration) {
+				adjust(index, "max duration", sub.Start, max(floor(sub.Start+SRTTimestamp(cfg.MaxDuration)), sub.Start))
+			}
+		}
+	}
+	// Minimum duration, extended up to the next cue
+	if cfg.MinDuration > 0 || cfg.CharsPerSecond > 0 {
+		for index, sub := range srtSubs {
+			required := cfg.MinDuration
+			if cfg.CharsPerSecond > 0 {
+				readingTime := time.Duration(float64(visibleLength(strings.ReplaceAll(sub.Text, "\n", ""))) / cfg.CharsPerSecond * float64(time.Second))
+				required = max(required, readingTime)
+			}
+			if cfg.MaxDuration > 0 {
+				required = min(required, cfg.MaxDuration)
+			}
+			if sub.End-sub.Start >= SRTTimestamp(required) {
+				continue
+			}
+			end := sub.Start + SRTTimestamp(required)
+			if next := timingNext(srtSubs, index); next != -1 {
+				end = min(end, srtSubs[next].Start-SRTTimestamp(cfg.MinGap))
+			}
+			adjust(index, "min duration", sub.Start, max(floor(end), sub.End))
+		}
+	}
+	// Minimum gap
+	if cfg.MinGap > 0 {
+		adjustments = append(adjustments, timingMinGap(srtSubs, cfg.MinGap, floor)...)
+	}
+	return
+}
+
+// timingFloor returns a function rounding the timestamps down to a frame, they are kept as is without frame rate
+func timingFloor(frameRate float64) func(SRTTimestamp) SRTTimestamp {
+	if frameRate <= 0 {
+		return func(ts SRTTimestamp) SRTTimestamp { return ts }
+	}
+	frame := float64(time.Second) / frameRate
+	return func(ts SRTTimestamp) SRTTimestamp {
+		// the epsilon keeps the timestamps already on a frame (rounded to the nanosecond) on it
+		return SRTTimestamp(math.Floor(float64(ts)/frame+1e-6) * frame)
+	}
+}
+
+// timingMinGap shortens the cues too close to the next one. Cues are never shortened to nothing.
+func timingMinGap(srtSubs SRTSubtitles, gap time.Duration, floor func(SRTTimestamp) SRTTimestamp) (adjustments []TimingAdjustment) {
+	for index := range srtSubs {
+		next := timingNext(srtSubs, index)
+		if next == -1 {
+			continue
+		}
+		end := floor(srtSubs[next].Start - SRTTimestamp(gap))
+		if srtSubs[index].End > end && end > srtSubs[index].Start {
+			adjustments = append(adjustments, TimingAdjustment{
+				Index:    index,
+				Rule:     "min gap",
+				OldStart: srtSubs[index].Start,
+				OldEnd:   srtSubs[index].End,
+				NewStart: srtSubs[index].Start,
+				NewEnd:   end,
+			})
+			srtSubs[index].End = end
+		}
+	}
+	return
+}
+
+// timingNext returns the index of the next cue displayed after the given one at the same position, -1 if
+// there is none. Cues displayed at the same time or at different positions do not constrain each other.
+func timingNext(srtSubs SRTSubtitles, index int) int {
+	for next := index + 1; next < len(srtSubs); next++ {
+		if srtSubs[next].Top == srtSubs[index].Top && srtSubs[next].Start > srtSubs[index].Start {
+			return next
+		}
+	}
+	return -1
+}
+
+func printTimingAdjustments(adjustments []TimingAdjustment, debug bool) {
+	counts := make(map[string]int)
+	for _, adjustment := range adjustments {
+		counts[adjustment.Rule]++
+	}
+	fmt.Printf("Timing: %d adjustment(s)", len(adjustments))
+	for _, rule := range []string{"frame snapping", "overlap", "max duration", "min duration", "min gap"} {
+		if counts[rule] > 0 {
+			fmt.Printf(" | %s: %d", rule, counts[rule])
+		}
+	}
+	fmt.Println()
+	if !debug {
+		return
+	}
+	for _, adjustment := range adjustments {
+		fmt.Printf("\t%s\n", adjustment)
+	}
+}
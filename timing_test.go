@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplyTiming(t *testing.T) {
+	ms := func(milliseconds int) SRTTimestamp {
+		return SRTTimestamp(time.Duration(milliseconds) * time.Millisecond)
+	}
+	tests := []struct {
+		name     string
+		cfg      TimingConfig
+		subs     SRTSubtitles
+		expected [][2]SRTTimestamp
+	}{
+		{
+			name: "overlap",
+			cfg:  TimingConfig{MinGap: 84 * time.Millisecond},
+			subs: SRTSubtitles{
+				{Start: ms(0), End: ms(1500), Text: "One"},
+				{Start: ms(1000), End: ms(2000), Text: "Two"},
+			},
+			expected: [][2]SRTTimestamp{{ms(0), ms(916)}, {ms(1000), ms(2000)}},
+		},
+		{
+			name: "overlap too close for the gap",
+			cfg:  TimingConfig{MinGap: 100 * time.Millisecond, MinDuration: time.Second},
+			subs: SRTSubtitles{
+				{Start: ms(1000), End: ms(3000), Text: "One"},
+				{Start: ms(1050), End: ms(4000), Text: "Two"},
+			},
+			expected: [][2]SRTTimestamp{{ms(1000), ms(1050)}, {ms(1050), ms(4000)}},
+		},
+		{
+			name: "overlap too close for the gap with frames",
+			cfg:  TimingConfig{MinGap: 100 * time.Millisecond, FrameRate: 25},
+			subs: SRTSubtitles{
+				{Start: ms(1000), End: ms(3000), Text: "One"},
+				{Start: ms(1040), End: ms(4000), Text: "Two"},
+			},
+			expected: [][2]SRTTimestamp{{ms(1000), ms(1040)}, {ms(1040), ms(4000)}},
+		},
+		{
+			name: "max duration",
+			cfg:  TimingConfig{MaxDuration: 7 * time.Second},
+			subs: SRTSubtitles{
+				{Start: ms(0), End: ms(9000), Text: "One"},
+			},
+			expected: [][2]SRTTimestamp{{ms(0), ms(7000)}},
+		},
+		{
+			name: "min duration up to the next cue",
+			cfg:  TimingConfig{MinDuration: time.Second, MinGap: 100 * time.Millisecond},
+			subs: SRTSubtitles{
+				{Start: ms(0), End: ms(300), Text: "One"},
+				{Start: ms(800), End: ms(2000), Text: "Two"},
+			},
+			expected: [][2]SRTTimestamp{{ms(0), ms(700)}, {ms(800), ms(2000)}},
+		},
+		{
+			name: "reading speed",
+			cfg:  TimingConfig{CharsPerSecond: 10},
+			subs: SRTSubtitles{
+				{Start: ms(0), End: ms(500), Text: "<i>Twenty characters !!</i>"},
+			},
+			expected: [][2]SRTTimestamp{{ms(0), ms(2000)}},
+		},
+		{
+			name: "snapping does not break the gap",
+			cfg:  TimingConfig{MinGap: 84 * time.Millisecond, FrameRate: 25},
+			subs: SRTSubtitles{
+				{Start: ms(0), End: ms(1010), Text: "One"},
+				{Start: ms(1030), End: ms(2000), Text: "Two"},
+			},
+			expected: [][2]SRTTimestamp{{ms(0), ms(920)}, {ms(1040), ms(2000)}},
+		},
+		{
+			name: "snapping keeps a frame",
+			cfg:  TimingConfig{FrameRate: 25},
+			subs: SRTSubtitles{
+				{Start: ms(1001), End: ms(1010), Text: "One"},
+			},
+			expected: [][2]SRTTimestamp{{ms(1000), ms(1040)}},
+		},
+		{
+			name: "other screen position",
+			cfg:  TimingConfig{MinGap: 84 * time.Millisecond},
+			subs: SRTSubtitles{
+				{Start: ms(0), End: ms(1500), Text: "One"},
+				{Start: ms(1000), End: ms(2000), Text: "Sign", Top: true},
+			},
+			expected: [][2]SRTTimestamp{{ms(0), ms(1500)}, {ms(1000), ms(2000)}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ApplyTiming(test.subs, test.cfg)
+			for index, sub := range test.subs {
+				if sub.Start != test.expected[index][0] || sub.End != test.expected[index][1] {
+					t.Errorf("cue #%d: got %s --> %s, expected %s --> %s",
+						index+1, sub.Start, sub.End, test.expected[index][0], test.expected[index][1])
+				}
+			}
+		})
+	}
+}
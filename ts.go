@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	tsPacketSize     = 188
+	tsSyncByte       = 0x47
+	tsPIDPAT         = 0x0000
+	tsTimestampClock = 90000 // PTS ticks per second
+	tsTimestampWrap  = 1 << 33
+)
+
+// tsElementaryStream is an elementary stream declared by a program map table
+type tsElementaryStream struct {
+	PID         uint16
+	StreamType  byte
+	Descriptors []byte
+}
+
+// tsDemuxer reassembles the PES packets of the elementary streams selected by its filter
+type tsDemuxer struct {
+	filter func(stream tsElementaryStream) bool
+	onPES  func(stream tsElementaryStream, pts uint64, payload []byte) error
+	// program specific information
+	pmtPIDs  map[uint16]bool
+	sections map[uint16][]byte
+	streams  map[uint16]tsElementaryStream
+	// PES reassembly of the selected streams
+	pes      map[uint16][]byte
+	counters map[uint16]byte // last continuity counter
+	// first PTS of each PID, to compute the start of the transport stream
+	firstPTS map[uint16]uint64
+}
+
+// demuxTS reads a transport stream made of packets of packetSize bytes (188, or 192 for BDAV streams
+// with their 4 bytes timecode prefix) and returns the start PTS of the whole transport stream.
+func demuxTS(reader io.Reader, packetSize int, filter func(stream tsElementaryStream) bool,
+	onPES func(stream tsElementaryStream, pts uint64, payload []byte) error) (start uint64, err error) {
+	demuxer := &tsDemuxer{
+		filter:   filter,
+		onPES:    onPES,
+		pmtPIDs:  make(map[uint16]bool),
+		sections: make(map[uint16][]byte),
+		streams:  make(map[uint16]tsElementaryStream),
+		pes:      make(map[uint16][]byte),
+		counters: make(map[uint16]byte),
+		firstPTS: make(map[uint16]uint64),
+	}
+	bufferedReader := bufio.NewReaderSize(reader, 1<<20)
+	packet := make([]byte, packetSize)
+	for {
+		if _, err = io.ReadFull(bufferedReader, packet); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				// a truncated last packet is common with recordings
+				err = nil
+				break
+			}
+			return
+		}
+		if err = demuxer.packet(packet[packetSize-tsPacketSize:]); err != nil {
+			return
+		}
+	}
+	// Flush the remaining PES packets
+	for pid, payload := range demuxer.pes {
+		if err = demuxer.flushPES(pid, payload); err != nil {
+			return
+		}
+	}
+	first := true
+	for _, pts := range demuxer.firstPTS {
+		if first || pts < start {
+			start, first = pts, false
+		}
+	}
+	return
+}
+
+func (demuxer *tsDemuxer) packet(packet []byte) (err error) {
+	if packet[0] != tsSyncByte {
+		return errors.New("lost transport stream synchronization")
+	}
+	payloadStart := packet[1]&0x40 != 0
+	pid := binary.BigEndian.Uint16(packet[1:3]) & 0x1fff
+	adaptation := (packet[3] >> 4) & 0x3
+	payload := packet[4:]
+	if adaptation == 2 || adaptation == 0 {
+		// no payload
+		return
+	}
+	var discontinuity bool
+	if adaptation == 3 {
+		if int(payload[0])+1 > len(payload) {
+			return
+		}
+		discontinuity = payload[0] > 0 && payload[1]&0x80 != 0
+		payload = payload[1+int(payload[0]):]
+	}
+	switch {
+	case pid == tsPIDPAT || demuxer.pmtPIDs[pid]:
+		return demuxer.section(pid, payloadStart, payload)
+	case payloadStart:
+		// Keep track of the first PTS of every stream to find the start of the transport stream
+		if _, found := demuxer.firstPTS[pid]; !found {
+			if pts, ok := pesPTS(payload); ok {
+				demuxer.firstPTS[pid] = pts
+			}
+		}
+	}
+	stream, found := demuxer.streams[pid]
+	if !found || !demuxer.filter(stream) {
+		return
+	}
+	// A lost packet breaks the PES packet being reassembled, a duplicated packet is sent twice in a row
+	counter := packet[3] & 0x0f
+	if last, found := demuxer.counters[pid]; found && !discontinuity {
+		if counter == last {
+			return
+		}
+		if counter != (last+1)&0x0f {
+			delete(demuxer.pes, pid)
+		}
+	}
+	demuxer.counters[pid] = counter
+	if payloadStart {
+		if previous, found := demuxer.pes[pid]; found && len(previous) > 0 {
+			if err = demuxer.flushPES(pid, previous); err != nil {
+				return
+			}
+		}
+		demuxer.pes[pid] = append([]byte(nil), payload...)
+	} else if previous, found := demuxer.pes[pid]; found {
+		demuxer.pes[pid] = append(previous, payload...)
+	}
+	return
+}
+
+// section reassembles the PSI sections (PAT and PMT)
+func (demuxer *tsDemuxer) section(pid uint16, payloadStart bool, payload []byte) (err error) {
+	if payloadStart {
+		if len(payload) == 0 || int(payload[0])+1 > len(payload) {
+			return
+		}
+		demuxer.sections[pid] = append([]byte(nil), payload[1+int(payload[0]):]...)
+	} else if section, found := demuxer.sections[pid]; found {
+		demuxer.sections[pid] = append(section, payload...)
+	} else {
+		return
+	}
+	section := demuxer.sections[pid]
+	if len(section) < 3 {
+		return
+	}
+	length := 3 + int(binary.BigEndian.Uint16(section[1:3])&0x0fff)
+	if len(section) < length {
+		// wait for the next packets
+		return
+	}
+	delete(demuxer.sections, pid)
+	// skip the header (8 bytes) and the CRC (4 bytes)
+	if length < 12 {
+		return
+	}
+	body := section[8 : length-4]
+	switch section[0] {
+	case 0x00:
+		// PAT: program number (2 bytes) and PMT PID (2 bytes)
+		for ; len(body) >= 4; body = body[4:] {
+			if binary.BigEndian.Uint16(body[0:2]) != 0 {
+				demuxer.pmtPIDs[binary.BigEndian.Uint16(body[2:4])&0x1fff] = true
+			}
+		}
+	case 0x02:
+		// PMT: PCR PID, program descriptors then the elementary streams
+		if len(body) < 4 {
+			return
+		}
+		programInfoLength := int(binary.BigEndian.Uint16(body[2:4]) & 0x0fff)
+		if 4+programInfoLength > len(body) {
+			return
+		}
+		for body = body[4+programInfoLength:]; len(body) >= 5; {
+			infoLength := int(binary.BigEndian.Uint16(body[3:5]) & 0x0fff)
+			if 5+infoLength > len(body) {
+				break
+			}
+			stream := tsElementaryStream{
+				PID:         binary.BigEndian.Uint16(body[1:3]) & 0x1fff,
+				StreamType:  body[0],
+				Descriptors: append([]byte(nil), body[5:5+infoLength]...),
+			}
+			demuxer.streams[stream.PID] = stream
+			body = body[5+infoLength:]
+		}
+	}
+	return
+}
+
+func (demuxer *tsDemuxer) flushPES(pid uint16, packet []byte) (err error) {
+	delete(demuxer.pes, pid)
+	if len(packet) < 9 || packet[0] != 0 || packet[1] != 0 || packet[2] != 1 || 9+int(packet[8]) > len(packet) {
+		return
+	}
+	pts, _ := pesPTS(packet)
+	payload := packet[9+int(packet[8]):]
+	if length := int(binary.BigEndian.Uint16(packet[4:6])); length > 0 && 6+length <= len(packet) {
+		payload = packet[9+int(packet[8]) : 6+length]
+	}
+	if err = demuxer.onPES(demuxer.streams[pid], pts, payload); err != nil {
+		err = fmt.Errorf("PID %d: %w", pid, err)
+	}
+	return
+}
+
+// pesPTS returns the PTS of a PES packet if it has one
+func pesPTS(packet []byte) (pts uint64, ok bool) {
+	if len(packet) < 14 || packet[0] != 0 || packet[1] != 0 || packet[2] != 1 || packet[7]&0x80 == 0 {
+		return
+	}
+	pts = uint64(packet[9]>>1&0x07)<<30 | uint64(binary.BigEndian.Uint16(packet[10:12])>>1)<<15 | uint64(binary.BigEndian.Uint16(packet[12:14])>>1)
+	return pts, true
+}
+
+// tsTimestamp converts a PTS into a duration from the start of the transport stream
+func tsTimestamp(pts, start uint64) time.Duration {
+	ticks := (pts + tsTimestampWrap - start) % tsTimestampWrap
+	return time.Duration(ticks) * time.Second / tsTimestampClock
+}
+
+// tsDescriptors calls fn for each descriptor of a descriptors loop
+func tsDescriptors(descriptors []byte, fn func(tag byte, data []byte)) {
+	for len(descriptors) >= 2 && 2+int(descriptors[1]) <= len(descriptors) {
+		fn(descriptors[0], descriptors[2:2+int(descriptors[1])])
+		descriptors = descriptors[2+int(descriptors[1]):]
+	}
+}
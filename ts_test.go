@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+const (
+	tsTestPMTPID    = 0x100
+	tsTestStreamPID = 0x101
+)
+
+// tsTestPacket returns a 188 bytes packet, the adaptation field is added if adaptation is not nil and the
+// end of the payload is stuffed with 0xff
+func tsTestPacket(pid uint16, payloadStart bool, counter byte, adaptation []byte, payload []byte) []byte {
+	packet := []byte{tsSyncByte, byte(pid >> 8 & 0x1f), byte(pid), 0x10 | counter&0x0f}
+	if payloadStart {
+		packet[1] |= 0x40
+	}
+	if adaptation != nil {
+		packet[3] |= 0x20
+		packet = append(packet, byte(len(adaptation)))
+		packet = append(packet, adaptation...)
+	}
+	packet = append(packet, payload...)
+	return append(packet, bytes.Repeat([]byte{0xff}, tsPacketSize-len(packet))...)
+}
+
+// tsTestPSI returns the packets of a PAT declaring one program and of its PMT declaring one private stream
+func tsTestPSI() []byte {
+	pat := []byte{0x00, 0x00, 0xb0, 0x0d, 0x00, 0x01, 0xc1, 0x00, 0x00, 0x00, 0x01, 0xe0 | tsTestPMTPID>>8, tsTestPMTPID & 0xff, 0, 0, 0, 0}
+	pmt := []byte{0x00, 0x02, 0xb0, 0x12, 0x00, 0x01, 0xc1, 0x00, 0x00, 0xe1, 0x00, 0xf0, 0x00,
+		0x06, 0xe0 | tsTestStreamPID>>8, tsTestStreamPID & 0xff, 0xf0, 0x00, 0, 0, 0, 0}
+	return append(tsTestPacket(tsPIDPAT, true, 0, nil, pat), tsTestPacket(tsTestPMTPID, true, 0, nil, pmt)...)
+}
+
+// tsTestPES returns a private stream 1 PES packet with a PTS
+func tsTestPES(pts uint64, payload []byte) []byte {
+	pes := []byte{0x00, 0x00, 0x01, 0xbd, 0, 0, 0x80, 0x80, 5,
+		0x21 | byte(pts>>29&0x0e), byte(pts >> 22), byte(pts>>14) | 1, byte(pts >> 7), byte(pts<<1) | 1}
+	binary.BigEndian.PutUint16(pes[4:6], uint16(len(pes)-6+len(payload)))
+	return append(pes, payload...)
+}
+
+// tsTestPayload is a PES packet payload returned by the demuxer
+type tsTestPayload struct {
+	pts     uint64
+	payload []byte
+}
+
+func tsTestDemux(t *testing.T, stream []byte, packetSize int) (packets []tsTestPayload, start uint64) {
+	t.Helper()
+	start, err := demuxTS(bytes.NewReader(stream), packetSize,
+		func(stream tsElementaryStream) bool {
+			return stream.PID == tsTestStreamPID && stream.StreamType == 0x06
+		},
+		func(_ tsElementaryStream, pts uint64, payload []byte) error {
+			packets = append(packets, tsTestPayload{pts: pts, payload: append([]byte(nil), payload...)})
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestPESPTS(t *testing.T) {
+	for _, pts := range []uint64{0, 1, 90000, 0x12345678, 1<<32 | 0xabcdef, tsTimestampWrap - 1} {
+		got, ok := pesPTS(tsTestPES(pts, []byte{0}))
+		if !ok || got != pts {
+			t.Errorf("PTS %d: got %d (%v)", pts, got, ok)
+		}
+	}
+	pes := tsTestPES(90000, []byte{0})
+	pes[7] = 0 // no PTS
+	if _, ok := pesPTS(pes); ok {
+		t.Error("a PES packet without PTS must not return one")
+	}
+	if _, ok := pesPTS([]byte{0x00, 0x00, 0x01}); ok {
+		t.Error("a truncated PES packet must not return a PTS")
+	}
+}
+
+func TestTSTimestamp(t *testing.T) {
+	tests := []struct {
+		pts, start uint64
+		expected   time.Duration
+	}{
+		{pts: 90000, start: 0, expected: time.Second},
+		{pts: 3 * 90000, start: 90000, expected: 2 * time.Second},
+		// the PTS wrapped around 2^33 after the start
+		{pts: 90000, start: tsTimestampWrap - 90000, expected: 2 * time.Second},
+	}
+	for _, test := range tests {
+		if got := tsTimestamp(test.pts, test.start); got != test.expected {
+			t.Errorf("PTS %d from %d: got %v, expected %v", test.pts, test.start, got, test.expected)
+		}
+	}
+}
+
+func TestDemuxTSContinuity(t *testing.T) {
+	payload := bytes.Repeat([]byte{0xab}, 300)
+	pes := tsTestPES(90000, payload)
+	first, second := pes[:184], pes[184:]
+	next := tsTestPES(2*90000, []byte{1, 2, 3})
+	tests := []struct {
+		name     string
+		packets  [][]byte
+		expected []tsTestPayload
+	}{
+		{
+			name: "split PES packet",
+			packets: [][]byte{
+				tsTestPacket(tsTestStreamPID, true, 0, nil, first),
+				tsTestPacket(tsTestStreamPID, false, 1, nil, second),
+			},
+			expected: []tsTestPayload{{pts: 90000, payload: payload}},
+		},
+		{
+			name: "duplicated packet",
+			packets: [][]byte{
+				tsTestPacket(tsTestStreamPID, true, 15, nil, first),
+				tsTestPacket(tsTestStreamPID, true, 15, nil, first),
+				tsTestPacket(tsTestStreamPID, false, 0, nil, second),
+			},
+			expected: []tsTestPayload{{pts: 90000, payload: payload}},
+		},
+		{
+			name: "lost packet",
+			packets: [][]byte{
+				tsTestPacket(tsTestStreamPID, true, 0, nil, first),
+				tsTestPacket(tsTestStreamPID, false, 2, nil, second),
+				tsTestPacket(tsTestStreamPID, true, 3, nil, next),
+			},
+			expected: []tsTestPayload{{pts: 2 * 90000, payload: []byte{1, 2, 3}}},
+		},
+		{
+			name: "discontinuity indicator",
+			packets: [][]byte{
+				tsTestPacket(tsTestStreamPID, true, 0, nil, first),
+				tsTestPacket(tsTestStreamPID, false, 1, nil, second),
+				tsTestPacket(tsTestStreamPID, true, 7, []byte{0x80}, next),
+			},
+			expected: []tsTestPayload{{pts: 90000, payload: payload}, {pts: 2 * 90000, payload: []byte{1, 2, 3}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			packets, start := tsTestDemux(t, append(tsTestPSI(), bytes.Join(test.packets, nil)...), tsPacketSize)
+			if start != 90000 {
+				t.Errorf("start: got %d, expected 90000", start)
+			}
+			if len(packets) != len(test.expected) {
+				t.Fatalf("got %d PES packet(s), expected %d", len(packets), len(test.expected))
+			}
+			for index, packet := range packets {
+				if packet.pts != test.expected[index].pts || !bytes.Equal(packet.payload, test.expected[index].payload) {
+					t.Errorf("PES #%d: got PTS %d and %d bytes, expected PTS %d and %d bytes", index, packet.pts,
+						len(packet.payload), test.expected[index].pts, len(test.expected[index].payload))
+				}
+			}
+		})
+	}
+}
+
+func TestDemuxTSAdaptationField(t *testing.T) {
+	payload := []byte("subtitle")
+	stream := tsTestPSI()
+	// adaptation field only: no payload
+	stream = append(stream, tsTestPacket(tsTestStreamPID, false, 0, nil, nil)...)
+	stream[len(stream)-tsPacketSize+3] = 0x20
+	// stuffing bytes before the payload
+	stream = append(stream, tsTestPacket(tsTestStreamPID, true, 0, bytes.Repeat([]byte{0xff}, 20), tsTestPES(90000, payload))...)
+	// BDAV packets have a 4 bytes timecode prefix
+	var bdav []byte
+	for offset := 0; offset < len(stream); offset += tsPacketSize {
+		bdav = append(append(bdav, 0, 0, 0, 0), stream[offset:offset+tsPacketSize]...)
+	}
+	for _, test := range []struct {
+		stream     []byte
+		packetSize int
+	}{{stream, tsPacketSize}, {bdav, m2tsPacketSize}} {
+		packets, _ := tsTestDemux(t, test.stream, test.packetSize)
+		if len(packets) != 1 || packets[0].pts != 90000 || !bytes.Equal(packets[0].payload, payload) {
+			t.Errorf("%d bytes packets: unexpected PES packets %+v", test.packetSize, packets)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	nbsp       = "\u00a0" // no-break space
+	narrowNbsp = "\u202f" // narrow no-break space
+)
+
+// TypographyRule replaces every match of Pattern by Replacement (regexp.Expand syntax)
+type TypographyRule struct {
+	Description string
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// horizontal spaces, line breaks must never be crossed by the rules
+const typographySpaces = `[ \t\x{00A0}\x{202F}]`
+
+// typographyURLRegexp matches the URLs (without their trailing punctuation), left untouched by the rules
+var typographyURLRegexp = regexp.MustCompile(`(?i)\b(?:[a-z][a-z0-9+.-]*://|www\.)[^\s\x{00A0}\x{202F}"«»“”<>]*[^\s\x{00A0}\x{202F}"«»“”<>.,;:!?)]`)
+
+var (
+	typographyRemoveNbsp = TypographyRule{
+		Description: "no-break spaces are regular spaces",
+		Pattern:     regexp.MustCompile(`[\x{00A0}\x{202F}]`),
+		Replacement: " ",
+	}
+	typographyThreeDots = TypographyRule{
+		Description: "ellipsis character is written as three dots",
+		Pattern:     regexp.MustCompile(`…`),
+		Replacement: "...",
+	}
+	typographyNoSpaceBeforePunctuation = TypographyRule{
+		Description: "no space before ? ! : ;",
+		Pattern:     regexp.MustCompile(`([^\s\x{00A0}\x{202F}])` + typographySpaces + `+([?!:;])`),
+		Replacement: "$1$2",
+	}
+	typographyStraightOpeningQuotes = TypographyRule{
+		Description: "curly and angle opening quotes are straight double quotes",
+		Pattern:     regexp.MustCompile(`[“„«]` + typographySpaces + `*`),
+		Replacement: `"`,
+	}
+	typographyStraightClosingQuotes = TypographyRule{
+		Description: "curly and angle closing quotes are straight double quotes",
+		Pattern:     regexp.MustCompile(typographySpaces + `*[”»]`),
+		Replacement: `"`,
+	}
+)
+
+// TypographyRules contains the rules of each supported language, applied in order
+var TypographyRules = map[string][]TypographyRule{
+	"fr": {
+		{
+			Description: "ellipsis character",
+			Pattern:     regexp.MustCompile(`\.\.\.`),
+			Replacement: "…",
+		},
+		{
+			Description: "straight and curly quotes are guillemets",
+			Pattern:     regexp.MustCompile(`["“]` + typographySpaces + `*([^"“”\n]*?)` + typographySpaces + `*["”]`),
+			Replacement: "«" + nbsp + "$1" + nbsp + "»",
+		},
+		{
+			Description: "no-break space after the opening guillemet",
+			Pattern:     regexp.MustCompile(`«` + typographySpaces + `*`),
+			Replacement: "«" + nbsp,
+		},
+		{
+			Description: "no-break space before the closing guillemet",
+			Pattern:     regexp.MustCompile(typographySpaces + `*»`),
+			Replacement: nbsp + "»",
+		},
+		{
+			Description: "narrow no-break space before ? ! ;",
+			Pattern:     regexp.MustCompile(`([^\s\x{00A0}\x{202F}?!;:])` + typographySpaces + `*([?!;]+)`),
+			Replacement: "$1" + narrowNbsp + "$2",
+		},
+		{
+			Description: "no-break space before : (already spaced)",
+			Pattern:     regexp.MustCompile(`([^\s\x{00A0}\x{202F}?!;:])` + typographySpaces + `+:`),
+			Replacement: "$1" + nbsp + ":",
+		},
+		{
+			Description: "no-break space before : (except between digits like 10:30)",
+			Pattern:     regexp.MustCompile(`([^\s\x{00A0}\x{202F}\d?!;:])` + typographySpaces + `*:`),
+			Replacement: "$1" + nbsp + ":",
+		},
+	},
+	"en": {
+		typographyRemoveNbsp,
+		typographyThreeDots,
+		typographyNoSpaceBeforePunctuation,
+		typographyStraightOpeningQuotes,
+		typographyStraightClosingQuotes,
+	},
+	"de": {
+		typographyRemoveNbsp,
+		typographyThreeDots,
+		typographyNoSpaceBeforePunctuation,
+		{
+			Description: "straight quotes are German quotation marks",
+			Pattern:     regexp.MustCompile(`["“]` + typographySpaces + `*([^"“”\n]*?)` + typographySpaces + `*["”]`),
+			Replacement: "„$1“",
+		},
+	},
+	"es": {
+		typographyRemoveNbsp,
+		typographyThreeDots,
+		typographyNoSpaceBeforePunctuation,
+		{
+			Description: "no space after ¿ and ¡",
+			Pattern:     regexp.MustCompile(`([¿¡])` + typographySpaces + `+`),
+			Replacement: "$1",
+		},
+		{
+			Description: "straight and curly quotes are angle quotes",
+			Pattern:     regexp.MustCompile(`["“]` + typographySpaces + `*([^"“”\n]*?)` + typographySpaces + `*["”]`),
+			Replacement: "«$1»",
+		},
+		{
+			Description: "no space inside angle quotes",
+			Pattern:     regexp.MustCompile(`«` + typographySpaces + `*([^«»\n]*?)` + typographySpaces + `*»`),
+			Replacement: "«$1»",
+		},
+	},
+}
+
+// TypographyLanguages returns the languages having typography rules
+func TypographyLanguages() (languages []string) {
+	for language := range TypographyRules {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return
+}
+
+// ApplyTypography applies the typography rules of a language and returns the number of modified subtitles
+func ApplyTypography(srtSubs SRTSubtitles, language string) (fixed int) {
+	rules := TypographyRules[strings.ToLower(language)]
+	for index, sub := range srtSubs {
+		// URLs are replaced by placeholders (private use characters) during the rules
+		urls := typographyURLRegexp.FindAllString(sub.Text, -1)
+		urlIndex := 0
+		text := typographyURLRegexp.ReplaceAllStringFunc(sub.Text, func(string) string {
+			urlIndex++
+			return fmt.Sprintf("\ue000%d\ue001", urlIndex-1)
+		})
+		for _, rule := range rules {
+			text = rule.Pattern.ReplaceAllString(text, rule.Replacement)
+		}
+		for urlIndex, url := range urls {
+			text = strings.Replace(text, fmt.Sprintf("\ue000%d\ue001", urlIndex), url, 1)
+		}
+		if text != sub.Text {
+			srtSubs[index].Text = text
+			fixed++
+		}
+	}
+	return
+}
@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestApplyTypography(t *testing.T) {
+	tests := []struct {
+		language string
+		name     string
+		text     string
+		want     string
+	}{
+		// French
+		{"fr", "question mark", "Quoi?", "Quoi" + narrowNbsp + "?"},
+		{"fr", "exclamation marks", "Non !!", "Non" + narrowNbsp + "!!"},
+		{"fr", "semicolon", "Oui; non", "Oui" + narrowNbsp + "; non"},
+		{"fr", "colon", "Lui: non", "Lui" + nbsp + ": non"},
+		{"fr", "spaced colon", "Lui : non", "Lui" + nbsp + ": non"},
+		{"fr", "guillemets", "Il a dit « bonjour »", "Il a dit «" + nbsp + "bonjour" + nbsp + "»"},
+		{"fr", "straight quotes", `Il a dit "bonjour"`, "Il a dit «" + nbsp + "bonjour" + nbsp + "»"},
+		{"fr", "ellipsis", "Eh bien...", "Eh bien…"},
+		{"fr", "already correct", "Quoi" + narrowNbsp + "? «" + nbsp + "Oui" + nbsp + "»" + nbsp + ": non…", "Quoi" + narrowNbsp + "? «" + nbsp + "Oui" + nbsp + "»" + nbsp + ": non…"},
+		{"fr", "time", "Rendez-vous à 12:30.", "Rendez-vous à 12:30."},
+		{"fr", "URL", "Va sur https://example.com/?q=1!", "Va sur https://example.com/?q=1" + narrowNbsp + "!"},
+		{"fr", "line breaks are not crossed", "Oui\n? non", "Oui\n? non"},
+		// English
+		{"en", "space before punctuation", "What ?", "What?"},
+		{"en", "ellipsis", "Well…", "Well..."},
+		{"en", "curly quotes", "He said “hello”", `He said "hello"`},
+		{"en", "no-break spaces", "Wait" + nbsp + "!", "Wait!"},
+		{"en", "already correct", `He said "hello"... What?`, `He said "hello"... What?`},
+		{"en", "time", "At 12:30.", "At 12:30."},
+		{"en", "URL", "Go to http://example.com:8080/a?b", "Go to http://example.com:8080/a?b"},
+		// German
+		{"de", "quotes", `Er sagte "Hallo"`, "Er sagte „Hallo“"},
+		{"de", "ellipsis", "Na ja…", "Na ja..."},
+		{"de", "already correct", "Er sagte „Hallo“...", "Er sagte „Hallo“..."},
+		{"de", "time", "Um 12:30 Uhr.", "Um 12:30 Uhr."},
+		// Spanish
+		{"es", "inverted marks", "¿ Qué ?", "¿Qué?"},
+		{"es", "quotes", `Dijo "hola"`, "Dijo «hola»"},
+		{"es", "spaced angle quotes", "Dijo « hola »", "Dijo «hola»"},
+		{"es", "ellipsis", "Bueno…", "Bueno..."},
+		{"es", "already correct", "¡Hola! Dijo «hola»...", "¡Hola! Dijo «hola»..."},
+		{"es", "time", "A las 12:30.", "A las 12:30."},
+	}
+	for _, test := range tests {
+		t.Run(test.language+" "+test.name, func(t *testing.T) {
+			subs := SRTSubtitles{{Text: test.text}}
+			fixed := ApplyTypography(subs, test.language)
+			if subs[0].Text != test.want {
+				t.Fatalf("got %q, want %q", subs[0].Text, test.want)
+			}
+			if (fixed == 1) != (test.text != test.want) {
+				t.Errorf("%d subtitle(s) reported as fixed", fixed)
+			}
+			// idempotence
+			if ApplyTypography(subs, test.language) != 0 {
+				t.Errorf("second pass changed the text to %q", subs[0].Text)
+			}
+		})
+	}
+}
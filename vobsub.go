@@ -1,28 +1,141 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/hekmon/go-vobsub"
 )
 
-func ParseVobSubFile(filePath string) (subs map[int][]ImageSubtitle, err error) {
-	dvdSubtitles, _, err := vobsub.Decode(filePath, true) // some images are too small for Qwen2.5-VL, using video stream resolution instead
+// ParseVobSubFile decodes all the streams of a .sub file, their language is read from the .idx file
+func ParseVobSubFile(filePath string) (streams map[int]SubtitleStream, err error) {
+	idxFile, found := vobSubIdxPath(filePath)
+	if !found {
+		return nil, errors.New("no .idx file found next to the .sub file")
+	}
+	metadata, err := vobsub.ReadIdxFile(idxFile)
 	if err != nil {
+		err = fmt.Errorf("failed to read .idx file: %w", err)
+		return
+	}
+	languages, err := readIdxLanguages(idxFile)
+	if err != nil {
+		err = fmt.Errorf("failed to read .idx file languages: %w", err)
+		return
+	}
+	packets, err := vobsub.ReadSubFile(filePath)
+	if err != nil {
+		err = fmt.Errorf("failed to read .sub file: %w", err)
+		return
+	}
+	if streams, err = decodeVobSubPackets(packets, metadata); err != nil {
 		err = fmt.Errorf("failed to decode vobsub file: %w", err)
 		return
 	}
-	subs = make(map[int][]ImageSubtitle, len(dvdSubtitles))
-	for streamID, streamSubs := range dvdSubtitles {
-		adaptedSubs := make([]ImageSubtitle, len(streamSubs))
-		for i, sub := range streamSubs {
-			adaptedSubs[i] = ImageSubtitle{
-				Image:     sub.Image,
-				StartTime: sub.Start,
-				EndTime:   sub.Stop,
+	for id, stream := range streams {
+		stream.Language = languages[id]
+		streams[id] = stream
+	}
+	return
+}
+
+// vobSubIdxPath returns the path of the .idx file of a .sub file
+func vobSubIdxPath(filePath string) (idxFile string, found bool) {
+	base := filePath[:len(filePath)-len(filepath.Ext(filePath))]
+	for _, extension := range []string{".idx", ".IDX"} {
+		if _, err := os.Stat(base + extension); err == nil {
+			return base + extension, true
+		}
+	}
+	return
+}
+
+// decodeVobSubPackets turns private stream 1 packets into subtitles, grouped by stream. It follows
+// vobsub.Decode but keeps the forced flag of each subtitle.
+func decodeVobSubPackets(packets []vobsub.PESPacket, metadata vobsub.IdxMetadata) (streams map[int]SubtitleStream, err error) {
+	// Concat splitted packets, the packets of the streams can be interleaved
+	subtitlesPackets := make([]vobsub.PESPacket, 0, len(packets))
+	currentSubs := make(map[int]int) // index of the current sub of each stream
+	for _, pkt := range packets {
+		streamID := pkt.Header.SubStreamID.SubtitleID()
+		if pkt.Header.Extension.Data.ComputePTS() != 0 {
+			// New subtitle
+			currentSubs[streamID] = len(subtitlesPackets)
+			subtitlesPackets = append(subtitlesPackets, pkt)
+		} else if index, found := currentSubs[streamID]; found {
+			// Subtitle has been split in multiples packets, concat to current sub
+			subtitlesPackets[index].Payload = append(subtitlesPackets[index].Payload, pkt.Payload...)
+		}
+		// else skip invalid subtitle packet
+	}
+	streams = make(map[int]SubtitleStream, 1)
+	for _, subPkt := range subtitlesPackets {
+		rawSub, err := subPkt.ExtractSubtitle()
+		if err != nil {
+			// Some bad packets can be found in the wild, other tools skip them too
+			continue
+		}
+		// some images are too small for Qwen2.5-VL, using video stream resolution instead
+		img, startDelay, stopDelay, err := rawSub.Decode(metadata, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode subtitle: %w", err)
+		}
+		var forced bool
+		for _, cs := range rawSub.ControlSequences {
+			forced = forced || cs.ForceDisplaying
+		}
+		pts := subPkt.Header.Extension.Data.ComputePTS()
+		stream := streams[subPkt.Header.SubStreamID.SubtitleID()]
+		stream.ID = subPkt.Header.SubStreamID.SubtitleID()
+		stream.Subtitles = append(stream.Subtitles, ImageSubtitle{
+			Image:     img,
+			StartTime: metadata.TimeOffset + pts + startDelay,
+			EndTime:   metadata.TimeOffset + pts + stopDelay,
+			Forced:    forced,
+		})
+		streams[stream.ID] = stream
+	}
+	// Some (rare) subtitles do not have a stop date: use the next subtitle start date minus 100ms
+	for _, stream := range streams {
+		for index, sub := range stream.Subtitles {
+			if sub.StartTime == sub.EndTime && index+1 < len(stream.Subtitles) {
+				if potentialStop := stream.Subtitles[index+1].StartTime - 100*time.Millisecond; potentialStop > sub.StartTime {
+					stream.Subtitles[index].EndTime = potentialStop
+				}
 			}
 		}
-		subs[streamID] = adaptedSubs
 	}
 	return
 }
+
+// idx stream declaration, eg. "id: fr, index: 0"
+var idxLanguageRegexp = regexp.MustCompile(`^id: ([a-zA-Z]{2,3}|--), index: (\d+)`)
+
+// readIdxLanguages returns the language code of each stream declared in an .idx file
+func readIdxLanguages(idxFile string) (languages map[int]string, err error) {
+	fd, err := os.Open(idxFile)
+	if err != nil {
+		err = fmt.Errorf("failed to open file: %w", err)
+		return
+	}
+	defer fd.Close()
+	languages = make(map[int]string)
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		matches := idxLanguageRegexp.FindStringSubmatch(scanner.Text())
+		if matches == nil || matches[1] == "--" {
+			continue
+		}
+		index, _ := strconv.Atoi(matches[2])
+		languages[index] = strings.ToLower(matches[1])
+	}
+	err = scanner.Err()
+	return
+}
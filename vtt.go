@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	// vttHeader starts a WebVTT file, the style block renders the SDH annotations layer
+	vttHeader = "WEBVTT\n\nSTYLE\n::cue(.sdh) {\n  color: yellow;\n  font-style: italic;\n}\n\n"
+	// vttSDHOpen and vttSDHClose delimit the SDH annotations, see markSDHText
+	vttSDHOpen  = "<c.sdh>"
+	vttSDHClose = "</c>"
+)
+
+// vttTagRegexp matches the tags kept in the WebVTT cues text, anything else is escaped
+var vttTagRegexp = regexp.MustCompile(`</?i>|<c\.sdh>|</c>`)
+
+// MarshalVTT writes the subtitles as WebVTT. The italic and class tags are kept, the cues at the top of the
+// screen are positioned on the first line.
+func (subtitles SRTSubtitles) MarshalVTT(output io.Writer) (err error) {
+	writer := bufio.NewWriter(output)
+	writer.WriteString(vttHeader)
+	for i, sub := range subtitles {
+		fmt.Fprintf(writer, "%d\n%s --> %s", i+1, vttTimestamp(sub.Start), vttTimestamp(sub.End))
+		if sub.Top {
+			writer.WriteString(" line:0")
+		}
+		writer.WriteString("\n")
+		// an empty line would end the cue
+		for _, line := range strings.Split(sub.Text, "\n") {
+			if strings.TrimSpace(line) != "" {
+				fmt.Fprintf(writer, "%s\n", vttEscape(line))
+			}
+		}
+		writer.WriteString("\n")
+	}
+	return writer.Flush()
+}
+
+// vttTimestamp formats a timestamp the WebVTT way: a dot before the milliseconds
+func vttTimestamp(timestamp SRTTimestamp) string {
+	return strings.Replace(timestamp.String(), ",", ".", 1)
+}
+
+// vttEscape escapes the characters of a line reserved by WebVTT, but the kept tags
+func vttEscape(line string) string {
+	escape := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	var escaped strings.Builder
+	last := 0
+	for _, loc := range vttTagRegexp.FindAllStringIndex(line, -1) {
+		escaped.WriteString(escape.Replace(line[last:loc[0]]))
+		escaped.WriteString(line[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	escaped.WriteString(escape.Replace(line[last:]))
+	return escaped.String()
+}
+
+func saveVTT(outputPath string, subtitles SRTSubtitles) (err error) {
+	fd, err := os.Create(outputPath)
+	if err != nil {
+		err = fmt.Errorf("failed to save the WebVTT: %w", err)
+		return
+	}
+	defer fd.Close()
+	if err = subtitles.MarshalVTT(fd); err != nil {
+		err = fmt.Errorf("failed to save the WebVTT: %w", err)
+	}
+	return
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestMarshalVTT(t *testing.T) {
+	subs := SRTSubtitles{
+		{Start: SRTTimestamp(time.Second), End: SRTTimestamp(2500 * time.Millisecond), Text: "<c.sdh>[MUSIC]</c>\n\n<i>Tom & Jerry <3</i>"},
+		{Start: SRTTimestamp(time.Hour), End: SRTTimestamp(time.Hour + time.Second), Text: "EXIT", Top: true},
+	}
+	var output bytes.Buffer
+	if err := subs.MarshalVTT(&output); err != nil {
+		t.Fatal(err)
+	}
+	want := vttHeader +
+		"1\n00:00:01.000 --> 00:00:02.500\n<c.sdh>[MUSIC]</c>\n<i>Tom &amp; Jerry &lt;3</i>\n\n" +
+		"2\n01:00:00.000 --> 01:00:01.000 line:0\nEXIT\n\n"
+	if output.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", output.String(), want)
+	}
+}
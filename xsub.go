@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"time"
+)
+
+const (
+	xsubTimestampsLength = 27 // "[HH:MM:SS.mmm-HH:MM:SS.mmm]"
+	xsubHeaderLength     = 12 // width, height, x, y, x2, y2 (little endian)
+	xsubColors           = 4
+)
+
+// decodeXSUB decodes a XSUB packet: its display times, its position and its 2 bits image. DXSA packets
+// (alpha) carry the alpha of each palette entry, otherwise the first entry is the transparent background.
+func decodeXSUB(packet []byte, alpha bool) (sub ImageSubtitle, err error) {
+	if len(packet) < xsubTimestampsLength+xsubHeaderLength+2 || packet[0] != '[' || packet[13] != '-' || packet[26] != ']' {
+		return sub, errors.New("invalid XSUB packet header")
+	}
+	if sub.StartTime, err = xsubTimestamp(string(packet[1:13])); err != nil {
+		return
+	}
+	if sub.EndTime, err = xsubTimestamp(string(packet[14:26])); err != nil {
+		return
+	}
+	header := packet[xsubTimestampsLength:]
+	width := int(binary.LittleEndian.Uint16(header[0:2]))
+	height := int(binary.LittleEndian.Uint16(header[2:4]))
+	position := image.Pt(int(binary.LittleEndian.Uint16(header[4:6])), int(binary.LittleEndian.Uint16(header[6:8])))
+	// the bottom right position and the offset of the second field (often bogus) are not needed
+	data := header[xsubHeaderLength+2:]
+	paletteLength := xsubColors * 3
+	if alpha {
+		paletteLength += xsubColors
+	}
+	if width == 0 || height == 0 || len(data) < paletteLength {
+		return sub, errors.New("invalid XSUB bitmap header")
+	}
+	palette := make(color.Palette, xsubColors)
+	for i := range xsubColors {
+		entryColor := color.NRGBA{R: data[i*3], G: data[i*3+1], B: data[i*3+2], A: 255}
+		switch {
+		case alpha:
+			entryColor.A = data[xsubColors*3+i]
+		case i == 0:
+			entryColor.A = 0
+		}
+		palette[i] = entryColor
+	}
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+	// Run length encoded fields: even lines then odd lines. Codes are 4, 8, 12 or 16 bits long: the number
+	// of leading zeros gives the size of the run length, followed by the 2 bits color.
+	reader := &bitReader{data: data[paletteLength:]}
+	for line := range height {
+		y := line * 2
+		if line >= (height+1)/2 {
+			y = (line-(height+1)/2)*2 + 1
+		}
+		for x := 0; x < width; {
+			peek := *reader
+			var runBits int
+			switch next := peek.read(8); {
+			case next >= 0x40:
+				runBits = 2
+			case next >= 0x10:
+				runBits = 6
+			case next >= 0x04:
+				runBits = 10
+			default:
+				runBits = 14
+			}
+			run := reader.read(runBits)
+			code := byte(reader.read(2))
+			if run == 0 || run > width-x {
+				// 0: until the end of the line
+				run = width - x
+			}
+			for range run {
+				img.Pix[y*img.Stride+x] = code
+				x++
+			}
+		}
+		reader.align()
+	}
+	sub.Image = img
+	sub.Screen = img.Rect.Add(position)
+	return
+}
+
+// xsubTimestamp parses a "HH:MM:SS.mmm" timestamp
+func xsubTimestamp(timestamp string) (value time.Duration, err error) {
+	var hours, minutes, seconds, milliseconds int
+	if _, err = fmt.Sscanf(timestamp, "%02d:%02d:%02d.%03d", &hours, &minutes, &seconds, &milliseconds); err != nil {
+		return 0, fmt.Errorf("invalid XSUB timestamp %q: %w", timestamp, err)
+	}
+	value = time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds)*time.Second + time.Duration(milliseconds)*time.Millisecond
+	return
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// xsubTestRLE is a 4x3 bitmap: fields of even lines (0, 2) then odd lines (1), each line byte aligned
+var xsubTestRLE = []byte{
+	0x11,             // line 0: run of 4 in color 1 (6 bits run length)
+	0xa0, 0x00, 0x30, // line 2: run of 2 in color 2, then color 3 until the end of line (14 bits run length)
+	0x7c, // line 1: run of 1 in color 3, run of 3 in color 0 (2 bits run lengths)
+}
+
+// xsubTestPacket returns a XSUB packet of the 4x3 test bitmap displayed at (10, 20)
+func xsubTestPacket(timestamps string, alpha bool) []byte {
+	packet := []byte(timestamps)
+	for _, value := range []uint16{4, 3, 10, 20, 13, 22, 0} {
+		packet = binary.LittleEndian.AppendUint16(packet, value)
+	}
+	packet = append(packet, 0, 0, 0, 255, 255, 255, 0, 0, 255, 255, 0, 0)
+	if alpha {
+		packet = append(packet, 0, 255, 128, 255)
+	}
+	return append(packet, xsubTestRLE...)
+}
+
+func TestDecodeXSUB(t *testing.T) {
+	for _, alpha := range []bool{false, true} {
+		sub, err := decodeXSUB(xsubTestPacket("[00:00:01.000-01:02:03.450]", alpha), alpha)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sub.StartTime != time.Second || sub.EndTime != time.Hour+2*time.Minute+3450*time.Millisecond {
+			t.Errorf("got %v --> %v", sub.StartTime, sub.EndTime)
+		}
+		if sub.Screen != image.Rect(10, 20, 14, 23) {
+			t.Errorf("got screen %v", sub.Screen)
+		}
+		img := sub.Image.(*image.Paletted)
+		expected := []uint8{
+			1, 1, 1, 1,
+			3, 0, 0, 0,
+			2, 2, 3, 3,
+		}
+		if !reflect.DeepEqual(img.Pix, expected) {
+			t.Errorf("alpha %v: got pixels %v, expected %v", alpha, img.Pix, expected)
+		}
+		expectedAlpha := []uint8{0, 255, 255, 255}
+		if alpha {
+			expectedAlpha = []uint8{0, 255, 128, 255}
+		}
+		for index, entry := range img.Palette {
+			if entry.(color.NRGBA).A != expectedAlpha[index] {
+				t.Errorf("alpha %v: palette entry %d has alpha %d, expected %d", alpha, index, entry.(color.NRGBA).A, expectedAlpha[index])
+			}
+		}
+	}
+	for _, packet := range [][]byte{
+		xsubTestPacket("[00:00:01.000 00:00:02.000]", false),
+		xsubTestPacket("[00:00:01.000-00:0a:02.000]", false),
+		[]byte("[00:00:01.000-00:00:02.000]"),
+	} {
+		if _, err := decodeXSUB(packet, false); err == nil {
+			t.Errorf("invalid packet %q must fail", packet[:27])
+		}
+	}
+}